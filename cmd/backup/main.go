@@ -0,0 +1,156 @@
+package main
+
+import (
+	"bigtable/internal/backup"
+	"bigtable/internal/kvstore"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const usage = `Usage: backup <command> [flags]
+
+Commands:
+  create -server URL      ask a running server to back up into its -backup-dir
+  create -db DIR -dir DIR back up a stopped database into a backup directory
+  verify DIR              check a backup against its manifest
+  list -dir DIR           list the backups in a backup directory
+  prune -dir DIR -keep N  remove all but the newest N backups
+
+A backup is a database directory plus manifest.json; to restore one, stop
+the server and use a copy of it as -db.
+`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	var err error
+	switch command, args := os.Args[1], os.Args[2:]; command {
+	case "create":
+		err = create(args)
+	case "verify":
+		err = verify(args)
+	case "list":
+		err = list(args)
+	case "prune":
+		err = prune(args)
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "backup %s: %v\n", os.Args[1], err)
+		os.Exit(1)
+	}
+}
+
+func create(args []string) error {
+	flags := flag.NewFlagSet("create", flag.ExitOnError)
+	server := flags.String("server", "", "Base URL of a running server, such as http://localhost:6195")
+	dbPath := flags.String("db", "", "Database directory of a stopped server")
+	dir := flags.String("dir", "kv_backups", "Backup directory, with -db")
+	flags.Parse(args)
+
+	switch {
+	case *server != "" && *dbPath == "":
+		return createRemote(*server)
+	case *dbPath != "" && *server == "":
+		return createLocal(*dbPath, *dir)
+	}
+	return fmt.Errorf("give either -server or -db")
+}
+
+func createRemote(server string) error {
+	client := &http.Client{Timeout: time.Hour}
+	resp, err := client.Post(strings.TrimSuffix(server, "/")+"/v1/admin/backups", "application/json", nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusCreated {
+		return fmt.Errorf("server answered %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	var info backup.Info
+	if err := json.Unmarshal(body, &info); err != nil {
+		return err
+	}
+	printInfo(info)
+	return nil
+}
+
+func createLocal(dbPath, dir string) error {
+	// Opening fails while a server holds the database
+	store, err := kvstore.NewKVStore(dbPath)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	path, manifest, err := backup.Create(store, dir)
+	if err != nil {
+		return err
+	}
+	printInfo(manifest.Info(filepath.Base(path)))
+	return nil
+}
+
+func verify(args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("expected one backup directory")
+	}
+	manifest, err := backup.Verify(args[0])
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%s: %d files, %d bytes, OK\n", args[0], len(manifest.Files), manifest.Size())
+	return nil
+}
+
+func list(args []string) error {
+	flags := flag.NewFlagSet("list", flag.ExitOnError)
+	dir := flags.String("dir", "kv_backups", "Backup directory")
+	flags.Parse(args)
+
+	backups, err := backup.List(*dir)
+	if err != nil {
+		return err
+	}
+	for _, info := range backups {
+		printInfo(info)
+	}
+	return nil
+}
+
+func prune(args []string) error {
+	flags := flag.NewFlagSet("prune", flag.ExitOnError)
+	dir := flags.String("dir", "kv_backups", "Backup directory")
+	keep := flags.Int("keep", 7, "Number of backups to keep")
+	flags.Parse(args)
+	if *keep < 1 {
+		return fmt.Errorf("-keep must be at least 1")
+	}
+
+	removed, err := backup.Prune(*dir, *keep)
+	for _, name := range removed {
+		fmt.Println("removed", name)
+	}
+	return err
+}
+
+func printInfo(info backup.Info) {
+	fmt.Printf("%s\t%s\t%d files\t%d bytes\n", info.Name, info.CreatedAt.Local().Format(time.RFC3339), info.Files, info.Size)
+}
@@ -1,11 +1,17 @@
 package main
 
 import (
+	"bigtable/internal/backup"
+	"bigtable/internal/bigtablev2"
+	"bigtable/internal/kvstore"
 	"bigtable/internal/node"
+	"bigtable/internal/resp"
 	"bigtable/internal/rest"
+	"bigtable/internal/rpc"
 	"flag"
 	"fmt"
 	"log"
+	"net"
 	"path/filepath"
 )
 
@@ -14,8 +20,20 @@ func main() {
 	dbPath := flag.String("db", "kv_data", "Path to the database directory")
 
 	port := flag.Int("port", 6195, "Port number for the server")
+	grpcPort := flag.Int("grpc-port", 6196, "Port number for the gRPC server, 0 to disable")
+	redisPort := flag.Int("redis-port", 0, "Port number for the Redis protocol server, 0 to disable")
+	durability := flag.String("durability", "sync", "Default durability of writes: sync, nosync or group-sync[:<duration>]")
+	changeRetention := flag.Duration("change-retention", kvstore.DefaultChangeRetention, "How long the change log keeps changes for watch resumes")
+	backupDir := flag.String("backup-dir", "kv_backups", "Directory for backups taken through /v1/admin/backups or the schedule")
+	backupInterval := flag.Duration("backup-interval", 0, "Take a backup this often, 0 to disable scheduled backups")
+	backupKeep := flag.Int("backup-keep", 7, "Number of backups to keep, 0 to keep all")
 	flag.Parse()
 
+	writeOptions, err := kvstore.ParseWriteOptions(*durability)
+	if err != nil {
+		log.Fatalf("Invalid -durability: %v", err)
+	}
+
 
 	absDbPath, err := filepath.Abs(*dbPath)
 	if err != nil {
@@ -29,8 +47,54 @@ func main() {
 	}
 
 	defer kvNode.Close()
+	kvNode.SetDefaultWriteOptions(writeOptions)
+	kvNode.SetChangeRetention(*changeRetention)
+
+	if *grpcPort != 0 {
+		listener, err := net.Listen("tcp", fmt.Sprintf(":%d", *grpcPort))
+		if err != nil {
+			log.Fatalf("Failed to listen for gRPC : %v", err)
+		}
+		grpcServer := rpc.NewServer(kvNode)
+		// Cloud Bigtable 클라이언트는 BIGTABLE_EMULATOR_HOST 로 이 포트에 접속
+		bigtablev2.Register(grpcServer, kvNode)
+		defer grpcServer.GracefulStop()
+		go func() {
+			log.Printf("Starting gRPC server on %s", listener.Addr())
+			if err := grpcServer.Serve(listener); err != nil {
+				log.Fatalf("gRPC server failed : %v", err)
+			}
+		}()
+	}
+
+	if *redisPort != 0 {
+		listener, err := net.Listen("tcp", fmt.Sprintf(":%d", *redisPort))
+		if err != nil {
+			log.Fatalf("Failed to listen for Redis : %v", err)
+		}
+		redisServer := resp.NewServer(kvNode)
+		defer redisServer.Close()
+		go func() {
+			log.Printf("Starting Redis protocol server on %s", listener.Addr())
+			if err := redisServer.Serve(listener); err != nil {
+				log.Fatalf("Redis protocol server failed : %v", err)
+			}
+		}()
+	}
+
+	absBackupDir, err := filepath.Abs(*backupDir)
+	if err != nil {
+		log.Fatalf("Failed to get absolute path: %v", err)
+	}
+	backups := backup.NewManager(kvNode, absBackupDir, *backupKeep)
+	if *backupInterval > 0 {
+		backups.Schedule(*backupInterval)
+		log.Printf("Backing up to %s every %v", absBackupDir, *backupInterval)
+	}
+	defer backups.Close()
 
 	kvService := rest.NewKVStoreService(kvNode)
+	kvService.SetBackups(backups)
 
 	server := rest.NewServer(kvService)
 	address := fmt.Sprintf(":%d", *port)
@@ -0,0 +1,291 @@
+package backup
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// ManifestFile is written into a backup last, so a backup without one is
+	// incomplete.
+	ManifestFile = "manifest.json"
+
+	namePrefix    = "backup-"
+	nameFormat    = "20060102T150405.000Z"
+	partialSuffix = ".partial"
+	partialMaxAge = time.Hour
+)
+
+var (
+	// ErrCorrupt means a backup does not match its manifest.
+	ErrCorrupt     = errors.New("backup does not match its manifest")
+	ErrInvalidName = errors.New("invalid backup name")
+)
+
+// Source is what can be backed up, a KVNode or a KVStore.
+type Source interface {
+	Checkpoint(dir string) error
+}
+
+// Manifest lists every file of a backup with its size and SHA-256.
+type Manifest struct {
+	Version   int       `json:"version"`
+	CreatedAt time.Time `json:"createdAt"`
+	Files     []File    `json:"files"`
+}
+
+type File struct {
+	Path   string `json:"path"` // slash separated, relative to the backup
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// Size returns the total size of the files.
+func (m *Manifest) Size() int64 {
+	var size int64
+	for _, f := range m.Files {
+		size += f.Size
+	}
+	return size
+}
+
+// Create checkpoints source into a new directory under root named after the
+// current time and returns its path. The checkpoint is written under a
+// .partial name and renamed once its manifest is in place.
+func Create(source Source, root string) (string, *Manifest, error) {
+	if err := os.MkdirAll(root, 0o755); err != nil {
+		return "", nil, err
+	}
+	now := time.Now().UTC()
+	dir := filepath.Join(root, namePrefix+now.Format(nameFormat))
+	if _, err := os.Stat(dir); err == nil {
+		return "", nil, fmt.Errorf("backup %s already exists", dir)
+	}
+	partial := dir + partialSuffix
+	if err := os.RemoveAll(partial); err != nil {
+		return "", nil, err
+	}
+
+	if err := source.Checkpoint(partial); err != nil {
+		os.RemoveAll(partial)
+		return "", nil, fmt.Errorf("checkpoint failed: %w", err)
+	}
+	manifest, err := writeManifest(partial, now)
+	if err != nil {
+		os.RemoveAll(partial)
+		return "", nil, err
+	}
+	if err := os.Rename(partial, dir); err != nil {
+		os.RemoveAll(partial)
+		return "", nil, err
+	}
+	return dir, manifest, nil
+}
+
+func writeManifest(dir string, createdAt time.Time) (*Manifest, error) {
+	files, err := checksumFiles(dir)
+	if err != nil {
+		return nil, err
+	}
+	manifest := &Manifest{Version: 1, CreatedAt: createdAt, Files: files}
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Create(filepath.Join(dir, ManifestFile))
+	if err != nil {
+		return nil, err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return nil, err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return manifest, f.Close()
+}
+
+// checksumFiles lists every file under dir but the manifest, sorted by path.
+func checksumFiles(dir string) ([]File, error) {
+	var files []File
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		if rel == ManifestFile {
+			return nil
+		}
+		file, err := checksum(path)
+		if err != nil {
+			return err
+		}
+		file.Path = filepath.ToSlash(rel)
+		files = append(files, file)
+		return nil
+	})
+	sort.Slice(files, func(i, j int) bool { return files[i].Path < files[j].Path })
+	return files, err
+}
+
+func checksum(path string) (File, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return File{}, err
+	}
+	defer f.Close()
+
+	hash := sha256.New()
+	size, err := io.Copy(hash, f)
+	if err != nil {
+		return File{}, err
+	}
+	return File{Size: size, SHA256: hex.EncodeToString(hash.Sum(nil))}, nil
+}
+
+// ReadManifest reads the manifest of the backup in dir.
+func ReadManifest(dir string) (*Manifest, error) {
+	data, err := os.ReadFile(filepath.Join(dir, ManifestFile))
+	if err != nil {
+		return nil, err
+	}
+	var manifest Manifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("invalid manifest: %w", err)
+	}
+	if manifest.Version != 1 {
+		return nil, fmt.Errorf("unsupported manifest version %d", manifest.Version)
+	}
+	return &manifest, nil
+}
+
+// Verify checks every file of the backup in dir against its manifest. A
+// mismatch, or a manifest that is missing or unreadable, returns an error
+// wrapping ErrCorrupt that lists every problem.
+func Verify(dir string) (*Manifest, error) {
+	if _, err := os.Stat(dir); err != nil {
+		return nil, err
+	}
+	manifest, err := ReadManifest(dir)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrCorrupt, err)
+	}
+	files, err := checksumFiles(dir)
+	if err != nil {
+		return manifest, err
+	}
+
+	found := make(map[string]File, len(files))
+	for _, f := range files {
+		found[f.Path] = f
+	}
+	var problems []string
+	for _, want := range manifest.Files {
+		got, ok := found[want.Path]
+		delete(found, want.Path)
+		switch {
+		case !ok:
+			problems = append(problems, want.Path+" is missing")
+		case got.Size != want.Size:
+			problems = append(problems, fmt.Sprintf("%s has %d bytes, expected %d", want.Path, got.Size, want.Size))
+		case got.SHA256 != want.SHA256:
+			problems = append(problems, want.Path+" has a different checksum")
+		}
+	}
+	for path := range found {
+		problems = append(problems, path+" is not in the manifest")
+	}
+	if len(problems) > 0 {
+		sort.Strings(problems)
+		return manifest, fmt.Errorf("%w: %s", ErrCorrupt, strings.Join(problems, "; "))
+	}
+	return manifest, nil
+}
+
+// Info describes a complete backup.
+type Info struct {
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"createdAt"`
+	Files     int       `json:"files"`
+	Size      int64     `json:"size"`
+}
+
+// Info describes the backup called name with manifest m.
+func (m *Manifest) Info(name string) Info {
+	return Info{Name: name, CreatedAt: m.CreatedAt, Files: len(m.Files), Size: m.Size()}
+}
+
+// List returns the complete backups under root, oldest first. Directories
+// without a readable manifest are skipped.
+func List(root string) ([]Info, error) {
+	entries, err := os.ReadDir(root)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var backups []Info
+	for _, entry := range entries {
+		name := entry.Name()
+		if !entry.IsDir() || !strings.HasPrefix(name, namePrefix) || strings.HasSuffix(name, partialSuffix) {
+			continue
+		}
+		manifest, err := ReadManifest(filepath.Join(root, name))
+		if err != nil {
+			continue
+		}
+		backups = append(backups, manifest.Info(name))
+	}
+	sort.Slice(backups, func(i, j int) bool { return backups[i].CreatedAt.Before(backups[j].CreatedAt) })
+	return backups, nil
+}
+
+// Prune removes all but the newest keep backups under root, and leftovers of
+// backups that never completed once they are an hour old, so one being
+// written is left alone. It returns the names it removed.
+func Prune(root string, keep int) ([]string, error) {
+	backups, err := List(root)
+	if err != nil {
+		return nil, err
+	}
+	var removed []string
+	for i := 0; i < len(backups)-keep; i++ {
+		if err := os.RemoveAll(filepath.Join(root, backups[i].Name)); err != nil {
+			return removed, err
+		}
+		removed = append(removed, backups[i].Name)
+	}
+
+	partials, err := filepath.Glob(filepath.Join(root, namePrefix+"*"+partialSuffix))
+	if err != nil {
+		return removed, err
+	}
+	for _, partial := range partials {
+		if info, err := os.Stat(partial); err != nil || time.Since(info.ModTime()) < partialMaxAge {
+			continue
+		}
+		if err := os.RemoveAll(partial); err != nil {
+			return removed, err
+		}
+		removed = append(removed, filepath.Base(partial))
+	}
+	return removed, nil
+}
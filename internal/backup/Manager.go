@@ -0,0 +1,89 @@
+package backup
+
+import (
+	"fmt"
+	"log"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Manager keeps the backups of one source under a root directory: it
+// creates them on demand or on a schedule and keeps the newest few.
+type Manager struct {
+	source Source
+	root   string
+	keep   int // 0 keeps every backup
+
+	mu   sync.Mutex // one backup at a time
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+func NewManager(source Source, root string, keep int) *Manager {
+	return &Manager{source: source, root: root, keep: keep, stop: make(chan struct{})}
+}
+
+func (m *Manager) Root() string {
+	return m.root
+}
+
+// Create writes a new backup, then prunes the old ones.
+func (m *Manager) Create() (Info, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	dir, manifest, err := Create(m.source, m.root)
+	if err != nil {
+		return Info{}, err
+	}
+	if m.keep > 0 {
+		if removed, err := Prune(m.root, m.keep); err != nil {
+			log.Printf("Backup pruning failed: %v", err)
+		} else if len(removed) > 0 {
+			log.Printf("Pruned backups %s", strings.Join(removed, ", "))
+		}
+	}
+	return manifest.Info(filepath.Base(dir)), nil
+}
+
+func (m *Manager) List() ([]Info, error) {
+	return List(m.root)
+}
+
+// Verify checks the backup called name against its manifest.
+func (m *Manager) Verify(name string) (*Manifest, error) {
+	if !strings.HasPrefix(name, namePrefix) || strings.ContainsAny(name, `/\`) || strings.HasSuffix(name, partialSuffix) {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidName, name)
+	}
+	return Verify(filepath.Join(m.root, name))
+}
+
+// Schedule creates a backup every interval until Close.
+func (m *Manager) Schedule(interval time.Duration) {
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-m.stop:
+				return
+			case <-ticker.C:
+				if info, err := m.Create(); err != nil {
+					log.Printf("Scheduled backup failed: %v", err)
+				} else {
+					log.Printf("Created backup %s (%d bytes)", info.Name, info.Size)
+				}
+			}
+		}
+	}()
+}
+
+// Close stops the schedule and waits for a running backup.
+func (m *Manager) Close() {
+	close(m.stop)
+	m.wg.Wait()
+}
@@ -0,0 +1,298 @@
+package bigtablev2
+
+import (
+	"bigtable/internal/kvstore"
+	"bigtable/internal/node"
+	"context"
+	"sort"
+	"time"
+
+	"cloud.google.com/go/bigtable/admin/apiv2/adminpb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+// consistencyToken is handed out by GenerateConsistencyToken. There is a
+// single node, so every write is already consistent and one token will do.
+const consistencyToken = "consistent"
+
+// AdminServer implements the table RPCs of
+// google.bigtable.admin.v2.BigtableTableAdmin. Backups, snapshots,
+// authorized views and IAM are left unimplemented.
+type AdminServer struct {
+	adminpb.UnimplementedBigtableTableAdminServer
+	node *node.KVNode
+}
+
+func NewAdminServer(node *node.KVNode) *AdminServer {
+	return &AdminServer{node: node}
+}
+
+// toGCRule converts a v2 GC rule. MaxAge is kept in whole seconds, rounding
+// up so a sub-second age still expires cells.
+func toGCRule(rule *adminpb.GcRule) (*kvstore.GCRule, error) {
+	switch r := rule.GetRule().(type) {
+	case nil:
+		return nil, nil
+	case *adminpb.GcRule_MaxNumVersions:
+		return &kvstore.GCRule{MaxVersions: int(r.MaxNumVersions)}, nil
+	case *adminpb.GcRule_MaxAge:
+		age := r.MaxAge.AsDuration()
+		return &kvstore.GCRule{MaxAge: int64((age + time.Second - 1) / time.Second)}, nil
+	case *adminpb.GcRule_Union_:
+		rules, err := toGCRules(r.Union.GetRules())
+		return &kvstore.GCRule{Union: rules}, err
+	case *adminpb.GcRule_Intersection_:
+		rules, err := toGCRules(r.Intersection.GetRules())
+		return &kvstore.GCRule{Intersection: rules}, err
+	default:
+		return nil, status.Errorf(codes.Unimplemented, "unsupported gc rule %T", r)
+	}
+}
+
+func toGCRules(rules []*adminpb.GcRule) ([]kvstore.GCRule, error) {
+	result := make([]kvstore.GCRule, 0, len(rules))
+	for _, r := range rules {
+		rule, err := toGCRule(r)
+		if err != nil {
+			return nil, err
+		}
+		if rule == nil {
+			return nil, status.Error(codes.InvalidArgument, "nested gc rule is empty")
+		}
+		result = append(result, *rule)
+	}
+	return result, nil
+}
+
+func fromGCRule(rule *kvstore.GCRule) *adminpb.GcRule {
+	switch {
+	case rule == nil:
+		return &adminpb.GcRule{}
+	case rule.MaxVersions > 0:
+		return &adminpb.GcRule{Rule: &adminpb.GcRule_MaxNumVersions{MaxNumVersions: int32(rule.MaxVersions)}}
+	case rule.MaxAge > 0:
+		return &adminpb.GcRule{Rule: &adminpb.GcRule_MaxAge{MaxAge: durationpb.New(time.Duration(rule.MaxAge) * time.Second)}}
+	case rule.Union != nil:
+		union := &adminpb.GcRule_Union{}
+		for i := range rule.Union {
+			union.Rules = append(union.Rules, fromGCRule(&rule.Union[i]))
+		}
+		return &adminpb.GcRule{Rule: &adminpb.GcRule_Union_{Union: union}}
+	default:
+		intersection := &adminpb.GcRule_Intersection{}
+		for i := range rule.Intersection {
+			intersection.Rules = append(intersection.Rules, fromGCRule(&rule.Intersection[i]))
+		}
+		return &adminpb.GcRule{Rule: &adminpb.GcRule_Intersection_{Intersection: intersection}}
+	}
+}
+
+func toColumnFamily(name string, family *adminpb.ColumnFamily) (kvstore.ColumnFamily, error) {
+	rule, err := toGCRule(family.GetGcRule())
+	if err != nil {
+		return kvstore.ColumnFamily{}, err
+	}
+	return kvstore.ColumnFamily{Name: name, GCRule: rule}, nil
+}
+
+// fromTable renders info under parent. NAME_ONLY leaves out the families.
+func fromTable(parent string, info *kvstore.TableInfo, view adminpb.Table_View) *adminpb.Table {
+	table := &adminpb.Table{Name: parent + "/tables/" + info.Name}
+	if view == adminpb.Table_NAME_ONLY {
+		return table
+	}
+	table.ColumnFamilies = make(map[string]*adminpb.ColumnFamily, len(info.ColumnFamilies))
+	for name, family := range info.ColumnFamilies {
+		table.ColumnFamilies[name] = &adminpb.ColumnFamily{GcRule: fromGCRule(family.GCRule)}
+	}
+	return table
+}
+
+// splitTableName returns the instance part of a table name and the table ID.
+func splitTableName(name string) (string, string, error) {
+	table, err := tableID(name)
+	if err != nil {
+		return "", "", err
+	}
+	return name[:len(name)-len("/tables/"+table)], table, nil
+}
+
+func (s *AdminServer) CreateTable(ctx context.Context, req *adminpb.CreateTableRequest) (*adminpb.Table, error) {
+	if err := checkParent(req.Parent); err != nil {
+		return nil, err
+	}
+	if len(req.InitialSplits) > 0 {
+		return nil, status.Error(codes.Unimplemented, "initial splits are not supported")
+	}
+
+	families := make([]kvstore.ColumnFamily, 0, len(req.Table.GetColumnFamilies()))
+	for name, family := range req.Table.GetColumnFamilies() {
+		cf, err := toColumnFamily(name, family)
+		if err != nil {
+			return nil, err
+		}
+		families = append(families, cf)
+	}
+	sort.Slice(families, func(i, j int) bool { return families[i].Name < families[j].Name })
+
+	if err := s.node.CreateTable(req.TableId, families); err != nil {
+		return nil, toStatus(err, codes.InvalidArgument)
+	}
+	info, err := s.node.GetTable(req.TableId)
+	if err != nil {
+		return nil, toStatus(err, codes.Internal)
+	}
+	return fromTable(req.Parent, info, adminpb.Table_SCHEMA_VIEW), nil
+}
+
+func (s *AdminServer) ListTables(ctx context.Context, req *adminpb.ListTablesRequest) (*adminpb.ListTablesResponse, error) {
+	if err := checkParent(req.Parent); err != nil {
+		return nil, err
+	}
+	view := req.View
+	if view == adminpb.Table_VIEW_UNSPECIFIED {
+		view = adminpb.Table_NAME_ONLY
+	}
+
+	tables, err := s.node.ListTables()
+	if err != nil {
+		return nil, toStatus(err, codes.Internal)
+	}
+	resp := &adminpb.ListTablesResponse{}
+	for i := range tables {
+		resp.Tables = append(resp.Tables, fromTable(req.Parent, &tables[i], view))
+	}
+	return resp, nil
+}
+
+func (s *AdminServer) GetTable(ctx context.Context, req *adminpb.GetTableRequest) (*adminpb.Table, error) {
+	parent, table, err := splitTableName(req.Name)
+	if err != nil {
+		return nil, err
+	}
+	view := req.View
+	if view == adminpb.Table_VIEW_UNSPECIFIED {
+		view = adminpb.Table_SCHEMA_VIEW
+	}
+
+	info, err := s.node.GetTable(table)
+	if err != nil {
+		return nil, toStatus(err, codes.Internal)
+	}
+	return fromTable(parent, info, view), nil
+}
+
+func (s *AdminServer) DeleteTable(ctx context.Context, req *adminpb.DeleteTableRequest) (*emptypb.Empty, error) {
+	table, err := tableID(req.Name)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.node.DeleteTable(table); err != nil {
+		return nil, toStatus(err, codes.Internal)
+	}
+	return &emptypb.Empty{}, nil
+}
+
+// ModifyColumnFamilies applies the modifications in order. They are not
+// atomic: a failure leaves the earlier ones in place.
+func (s *AdminServer) ModifyColumnFamilies(ctx context.Context, req *adminpb.ModifyColumnFamiliesRequest) (*adminpb.Table, error) {
+	parent, table, err := splitTableName(req.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, m := range req.Modifications {
+		switch mod := m.Mod.(type) {
+		case *adminpb.ModifyColumnFamiliesRequest_Modification_Create:
+			info, err := s.node.GetTable(table)
+			if err != nil {
+				return nil, toStatus(err, codes.Internal)
+			}
+			if _, ok := info.ColumnFamilies[m.Id]; ok {
+				return nil, status.Errorf(codes.AlreadyExists, "column family already exists: %s", m.Id)
+			}
+			if err := s.setColumnFamily(table, m.Id, mod.Create); err != nil {
+				return nil, err
+			}
+		case *adminpb.ModifyColumnFamiliesRequest_Modification_Update:
+			if err := s.setColumnFamily(table, m.Id, mod.Update); err != nil {
+				return nil, err
+			}
+		case *adminpb.ModifyColumnFamiliesRequest_Modification_Drop:
+			if err := s.node.DropColumnFamily(table, m.Id); err != nil {
+				return nil, toStatus(err, codes.InvalidArgument)
+			}
+		default:
+			return nil, status.Error(codes.InvalidArgument, "modification needs create, update or drop")
+		}
+	}
+
+	info, err := s.node.GetTable(table)
+	if err != nil {
+		return nil, toStatus(err, codes.Internal)
+	}
+	return fromTable(parent, info, adminpb.Table_SCHEMA_VIEW), nil
+}
+
+func (s *AdminServer) setColumnFamily(table, name string, family *adminpb.ColumnFamily) error {
+	cf, err := toColumnFamily(name, family)
+	if err != nil {
+		return err
+	}
+	return toStatus(s.node.SetColumnFamily(table, cf), codes.InvalidArgument)
+}
+
+func (s *AdminServer) DropRowRange(ctx context.Context, req *adminpb.DropRowRangeRequest) (*emptypb.Empty, error) {
+	table, err := tableID(req.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	var prefix string
+	switch target := req.Target.(type) {
+	case *adminpb.DropRowRangeRequest_RowKeyPrefix:
+		if len(target.RowKeyPrefix) == 0 {
+			return nil, status.Error(codes.InvalidArgument, "row key prefix must not be empty")
+		}
+		prefix = string(target.RowKeyPrefix)
+	case *adminpb.DropRowRangeRequest_DeleteAllDataFromTable:
+		if !target.DeleteAllDataFromTable {
+			return nil, status.Error(codes.InvalidArgument, "delete_all_data_from_table must be true")
+		}
+	default:
+		return nil, status.Error(codes.InvalidArgument, "drop needs row_key_prefix or delete_all_data_from_table")
+	}
+
+	if err := s.node.DropRowRange(table, prefix); err != nil {
+		return nil, toStatus(err, codes.Internal)
+	}
+	return &emptypb.Empty{}, nil
+}
+
+func (s *AdminServer) GenerateConsistencyToken(ctx context.Context, req *adminpb.GenerateConsistencyTokenRequest) (*adminpb.GenerateConsistencyTokenResponse, error) {
+	table, err := tableID(req.Name)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := s.node.GetTable(table); err != nil {
+		return nil, toStatus(err, codes.Internal)
+	}
+	return &adminpb.GenerateConsistencyTokenResponse{ConsistencyToken: consistencyToken}, nil
+}
+
+func (s *AdminServer) CheckConsistency(ctx context.Context, req *adminpb.CheckConsistencyRequest) (*adminpb.CheckConsistencyResponse, error) {
+	table, err := tableID(req.Name)
+	if err != nil {
+		return nil, err
+	}
+	if req.ConsistencyToken != consistencyToken {
+		return nil, status.Errorf(codes.InvalidArgument, "unknown consistency token: %q", req.ConsistencyToken)
+	}
+	if _, err := s.node.GetTable(table); err != nil {
+		return nil, toStatus(err, codes.Internal)
+	}
+	return &adminpb.CheckConsistencyResponse{Consistent: true}, nil
+}
@@ -0,0 +1,335 @@
+package bigtablev2
+
+import (
+	"bigtable/internal/kvstore"
+	"bigtable/internal/node"
+	"bytes"
+	"context"
+	"sort"
+
+	btpb "cloud.google.com/go/bigtable/apiv2/bigtablepb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+// readRowsPageSize is how many rows ReadRows reads from the node, and sends
+// to the client, at a time.
+const readRowsPageSize = 128
+
+// DataServer implements the google.bigtable.v2.Bigtable data API on the
+// table model of KVStore.
+type DataServer struct {
+	btpb.UnimplementedBigtableServer
+	node *node.KVNode
+}
+
+func NewDataServer(node *node.KVNode) *DataServer {
+	return &DataServer{node: node}
+}
+
+// rowInterval is [start, end) in row key space; an empty end is unbounded.
+type rowInterval struct {
+	start, end string
+}
+
+// rowIntervals turns a RowSet into sorted, non-overlapping intervals. An
+// empty set reads the whole table.
+func rowIntervals(set *btpb.RowSet) []rowInterval {
+	if len(set.GetRowKeys()) == 0 && len(set.GetRowRanges()) == 0 {
+		return []rowInterval{{}}
+	}
+
+	var intervals []rowInterval
+	for _, key := range set.GetRowKeys() {
+		intervals = append(intervals, rowInterval{string(key), string(key) + "\x00"})
+	}
+	for _, r := range set.GetRowRanges() {
+		var interval rowInterval
+		switch start := r.StartKey.(type) {
+		case *btpb.RowRange_StartKeyClosed:
+			interval.start = string(start.StartKeyClosed)
+		case *btpb.RowRange_StartKeyOpen:
+			interval.start = string(start.StartKeyOpen) + "\x00"
+		}
+		switch end := r.EndKey.(type) {
+		case *btpb.RowRange_EndKeyOpen:
+			interval.end = string(end.EndKeyOpen)
+		case *btpb.RowRange_EndKeyClosed:
+			interval.end = string(end.EndKeyClosed) + "\x00"
+		}
+		if interval.end == "" || interval.start < interval.end {
+			intervals = append(intervals, interval)
+		}
+	}
+
+	sort.Slice(intervals, func(i, j int) bool { return intervals[i].start < intervals[j].start })
+	merged := intervals[:0]
+	for _, interval := range intervals {
+		if n := len(merged); n > 0 {
+			last := &merged[n-1]
+			if last.end == "" || interval.start <= last.end {
+				if last.end != "" && (interval.end == "" || interval.end > last.end) {
+					last.end = interval.end
+				}
+				continue
+			}
+		}
+		merged = append(merged, interval)
+	}
+	return merged
+}
+
+// rowChunks encodes row as cell chunks, naming the family and qualifier of
+// every cell and committing the row with its last one.
+func rowChunks(row kvstore.Row) []*btpb.ReadRowsResponse_CellChunk {
+	chunks := make([]*btpb.ReadRowsResponse_CellChunk, len(row.Cells))
+	for i, cell := range row.Cells {
+		chunks[i] = &btpb.ReadRowsResponse_CellChunk{
+			FamilyName:      wrapperspb.String(cell.Family),
+			Qualifier:       wrapperspb.Bytes([]byte(cell.Qualifier)),
+			TimestampMicros: cell.Timestamp,
+			Value:           []byte(cell.Value),
+		}
+	}
+	chunks[0].RowKey = []byte(row.Key)
+	chunks[len(chunks)-1].RowStatus = &btpb.ReadRowsResponse_CellChunk_CommitRow{CommitRow: true}
+	return chunks
+}
+
+func (s *DataServer) ReadRows(req *btpb.ReadRowsRequest, stream btpb.Bigtable_ReadRowsServer) error {
+	table, err := tableID(req.TableName)
+	if err != nil {
+		return err
+	}
+	if req.Reversed {
+		return status.Error(codes.Unimplemented, "reversed scans are not supported")
+	}
+	if req.RowsLimit < 0 {
+		return status.Errorf(codes.InvalidArgument, "invalid rows_limit: %d", req.RowsLimit)
+	}
+	filter, err := compileFilter(req.Filter)
+	if err != nil {
+		return err
+	}
+	opts := kvstore.ReadOptions{Filter: filter}
+
+	remaining := req.RowsLimit
+	for _, interval := range rowIntervals(req.Rows) {
+		startKey := interval.start
+		for {
+			if err := stream.Context().Err(); err != nil {
+				return status.FromContextError(err).Err()
+			}
+			pageSize := int64(readRowsPageSize)
+			if req.RowsLimit > 0 {
+				pageSize = min(pageSize, remaining)
+			}
+
+			rows, nextCursor, err := s.node.ReadRows(table, startKey, interval.end, int(pageSize), opts)
+			if err != nil {
+				return toStatus(err, codes.Internal)
+			}
+			if len(rows) > 0 {
+				resp := &btpb.ReadRowsResponse{}
+				for _, row := range rows {
+					resp.Chunks = append(resp.Chunks, rowChunks(row)...)
+				}
+				if err := stream.Send(resp); err != nil {
+					return err
+				}
+			}
+
+			remaining -= int64(len(rows))
+			if req.RowsLimit > 0 && remaining <= 0 {
+				return nil
+			}
+			if nextCursor == "" {
+				break
+			}
+			startKey = nextCursor
+		}
+	}
+	return nil
+}
+
+func (s *DataServer) SampleRowKeys(req *btpb.SampleRowKeysRequest, stream btpb.Bigtable_SampleRowKeysServer) error {
+	table, err := tableID(req.TableName)
+	if err != nil {
+		return err
+	}
+	samples, err := s.node.SampleRowKeys(table)
+	if err != nil {
+		return toStatus(err, codes.Internal)
+	}
+	for _, sample := range samples {
+		if err := stream.Send(&btpb.SampleRowKeysResponse{RowKey: []byte(sample.Key), OffsetBytes: int64(sample.Offset)}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func toMutations(mutations []*btpb.Mutation) ([]kvstore.Mutation, error) {
+	result := make([]kvstore.Mutation, len(mutations))
+	for i, m := range mutations {
+		switch mutation := m.Mutation.(type) {
+		case *btpb.Mutation_SetCell_:
+			set := mutation.SetCell
+			timestamp := set.TimestampMicros
+			if timestamp == -1 {
+				// -1 asks for the server time, which kvstore assigns for 0
+				timestamp = 0
+			}
+			result[i] = kvstore.Mutation{
+				Type:      "set",
+				Family:    set.FamilyName,
+				Qualifier: string(set.ColumnQualifier),
+				Value:     string(set.Value),
+				Timestamp: timestamp,
+			}
+		case *btpb.Mutation_DeleteFromColumn_:
+			del := mutation.DeleteFromColumn
+			result[i] = kvstore.Mutation{
+				Type:           "delete_cell",
+				Family:         del.FamilyName,
+				Qualifier:      string(del.ColumnQualifier),
+				StartTimestamp: del.TimeRange.GetStartTimestampMicros(),
+				EndTimestamp:   del.TimeRange.GetEndTimestampMicros(),
+			}
+		case *btpb.Mutation_DeleteFromFamily_:
+			result[i] = kvstore.Mutation{Type: "delete_family", Family: mutation.DeleteFromFamily.FamilyName}
+		case *btpb.Mutation_DeleteFromRow_:
+			result[i] = kvstore.Mutation{Type: "delete_row"}
+		case nil:
+			return nil, status.Error(codes.InvalidArgument, "empty mutation")
+		default:
+			return nil, status.Errorf(codes.Unimplemented, "unsupported mutation %T", mutation)
+		}
+	}
+	return result, nil
+}
+
+func (s *DataServer) mutateRow(tableName string, row []byte, mutations []*btpb.Mutation) error {
+	table, err := tableID(tableName)
+	if err != nil {
+		return err
+	}
+	if len(row) == 0 {
+		return status.Error(codes.InvalidArgument, "row key is required")
+	}
+	converted, err := toMutations(mutations)
+	if err != nil {
+		return err
+	}
+	return toStatus(s.node.MutateRow(table, string(row), converted), codes.InvalidArgument)
+}
+
+func (s *DataServer) MutateRow(ctx context.Context, req *btpb.MutateRowRequest) (*btpb.MutateRowResponse, error) {
+	if err := s.mutateRow(req.TableName, req.RowKey, req.Mutations); err != nil {
+		return nil, err
+	}
+	return &btpb.MutateRowResponse{}, nil
+}
+
+// MutateRows applies every entry on its own, like Bigtable: each row is
+// atomic, the request as a whole is not.
+func (s *DataServer) MutateRows(req *btpb.MutateRowsRequest, stream btpb.Bigtable_MutateRowsServer) error {
+	if _, err := tableID(req.TableName); err != nil {
+		return err
+	}
+	resp := &btpb.MutateRowsResponse{Entries: make([]*btpb.MutateRowsResponse_Entry, len(req.Entries))}
+	for i, entry := range req.Entries {
+		err := s.mutateRow(req.TableName, entry.RowKey, entry.Mutations)
+		entryStatus := status.New(codes.OK, "")
+		if err != nil {
+			entryStatus = status.Convert(err)
+		}
+		resp.Entries[i] = &btpb.MutateRowsResponse_Entry{Index: int64(i), Status: entryStatus.Proto()}
+	}
+	return stream.Send(resp)
+}
+
+func (s *DataServer) CheckAndMutateRow(ctx context.Context, req *btpb.CheckAndMutateRowRequest) (*btpb.CheckAndMutateRowResponse, error) {
+	table, err := tableID(req.TableName)
+	if err != nil {
+		return nil, err
+	}
+	if len(req.RowKey) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "row key is required")
+	}
+	filter, err := compileFilter(req.PredicateFilter)
+	if err != nil {
+		return nil, err
+	}
+	onTrue, err := toMutations(req.TrueMutations)
+	if err != nil {
+		return nil, err
+	}
+	onFalse, err := toMutations(req.FalseMutations)
+	if err != nil {
+		return nil, err
+	}
+
+	// Without a predicate the row matches when it has any cell
+	cond := kvstore.Condition{Type: "exists"}
+	if filter != nil {
+		cond = kvstore.Condition{Type: "filter", Filter: filter}
+	}
+	matched, err := s.node.CheckAndMutateRow(table, string(req.RowKey), cond, onTrue, onFalse)
+	if err != nil {
+		return nil, toStatus(err, codes.InvalidArgument)
+	}
+	return &btpb.CheckAndMutateRowResponse{PredicateMatched: matched}, nil
+}
+
+func (s *DataServer) ReadModifyWriteRow(ctx context.Context, req *btpb.ReadModifyWriteRowRequest) (*btpb.ReadModifyWriteRowResponse, error) {
+	table, err := tableID(req.TableName)
+	if err != nil {
+		return nil, err
+	}
+
+	rules := make([]kvstore.ReadModifyWriteRule, len(req.Rules))
+	for i, r := range req.Rules {
+		rules[i] = kvstore.ReadModifyWriteRule{Family: r.FamilyName, Qualifier: string(r.ColumnQualifier)}
+		switch rule := r.Rule.(type) {
+		case *btpb.ReadModifyWriteRule_AppendValue:
+			rules[i].Type, rules[i].Value = "append", string(rule.AppendValue)
+		case *btpb.ReadModifyWriteRule_IncrementAmount:
+			rules[i].Type, rules[i].Delta = "increment", rule.IncrementAmount
+		default:
+			return nil, status.Error(codes.InvalidArgument, "rule needs append_value or increment_amount")
+		}
+	}
+
+	row, err := s.node.ReadModifyWriteRow(table, string(req.RowKey), rules)
+	if err != nil {
+		return nil, toStatus(err, codes.InvalidArgument)
+	}
+	return &btpb.ReadModifyWriteRowResponse{Row: toRow(row)}, nil
+}
+
+// toRow groups the cells of row, which come in family and qualifier order,
+// into the nested v2 row.
+func toRow(row *kvstore.Row) *btpb.Row {
+	result := &btpb.Row{Key: []byte(row.Key)}
+	var family *btpb.Family
+	var column *btpb.Column
+	for _, cell := range row.Cells {
+		if family == nil || family.Name != cell.Family {
+			family = &btpb.Family{Name: cell.Family}
+			result.Families = append(result.Families, family)
+			column = nil
+		}
+		if column == nil || !bytes.Equal(column.Qualifier, []byte(cell.Qualifier)) {
+			column = &btpb.Column{Qualifier: []byte(cell.Qualifier)}
+			family.Columns = append(family.Columns, column)
+		}
+		column.Cells = append(column.Cells, &btpb.Cell{TimestampMicros: cell.Timestamp, Value: []byte(cell.Value)})
+	}
+	return result
+}
+
+func (s *DataServer) PingAndWarm(ctx context.Context, req *btpb.PingAndWarmRequest) (*btpb.PingAndWarmResponse, error) {
+	return &btpb.PingAndWarmResponse{}, nil
+}
@@ -0,0 +1,85 @@
+package bigtablev2
+
+import (
+	"bigtable/internal/kvstore"
+
+	btpb "cloud.google.com/go/bigtable/apiv2/bigtablepb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// fullMatch anchors a Bigtable regex: RowFilter regexes must match the whole
+// key, family, qualifier or value, while kvstore filters match anywhere.
+func fullMatch(pattern string) string {
+	return "^(?:" + pattern + ")$"
+}
+
+// toFilter maps a RowFilter onto a kvstore filter. Sink, conditions, row
+// sampling, column and value ranges and labels have no counterpart and are
+// rejected as unimplemented.
+func toFilter(f *btpb.RowFilter) (*kvstore.Filter, error) {
+	if f == nil {
+		return nil, nil
+	}
+
+	switch filter := f.Filter.(type) {
+	case *btpb.RowFilter_Chain_:
+		return toFilterList("chain", filter.Chain.GetFilters())
+	case *btpb.RowFilter_Interleave_:
+		return toFilterList("interleave", filter.Interleave.GetFilters())
+	case *btpb.RowFilter_PassAllFilter:
+		return &kvstore.Filter{Type: "pass_all"}, nil
+	case *btpb.RowFilter_BlockAllFilter:
+		return &kvstore.Filter{Type: "block_all"}, nil
+	case *btpb.RowFilter_StripValueTransformer:
+		return &kvstore.Filter{Type: "strip_value"}, nil
+	case *btpb.RowFilter_RowKeyRegexFilter:
+		return &kvstore.Filter{Type: "key_regex", Pattern: fullMatch(string(filter.RowKeyRegexFilter))}, nil
+	case *btpb.RowFilter_FamilyNameRegexFilter:
+		return &kvstore.Filter{Type: "family_regex", Pattern: fullMatch(filter.FamilyNameRegexFilter)}, nil
+	case *btpb.RowFilter_ColumnQualifierRegexFilter:
+		return &kvstore.Filter{Type: "qualifier_regex", Pattern: fullMatch(string(filter.ColumnQualifierRegexFilter))}, nil
+	case *btpb.RowFilter_ValueRegexFilter:
+		return &kvstore.Filter{Type: "value_regex", Pattern: fullMatch(string(filter.ValueRegexFilter))}, nil
+	case *btpb.RowFilter_TimestampRangeFilter:
+		return &kvstore.Filter{
+			Type:           "timestamp_range",
+			StartTimestamp: filter.TimestampRangeFilter.GetStartTimestampMicros(),
+			EndTimestamp:   filter.TimestampRangeFilter.GetEndTimestampMicros(),
+		}, nil
+	case *btpb.RowFilter_CellsPerRowOffsetFilter:
+		return &kvstore.Filter{Type: "cells_per_row_offset", Count: int(filter.CellsPerRowOffsetFilter)}, nil
+	case *btpb.RowFilter_CellsPerRowLimitFilter:
+		return &kvstore.Filter{Type: "cells_per_row_limit", Count: int(filter.CellsPerRowLimitFilter)}, nil
+	case *btpb.RowFilter_CellsPerColumnLimitFilter:
+		return &kvstore.Filter{Type: "cells_per_column_limit", Count: int(filter.CellsPerColumnLimitFilter)}, nil
+	case nil:
+		return nil, status.Error(codes.InvalidArgument, "empty row filter")
+	default:
+		return nil, status.Errorf(codes.Unimplemented, "unsupported row filter %T", filter)
+	}
+}
+
+func toFilterList(kind string, filters []*btpb.RowFilter) (*kvstore.Filter, error) {
+	result := &kvstore.Filter{Type: kind}
+	for _, f := range filters {
+		child, err := toFilter(f)
+		if err != nil {
+			return nil, err
+		}
+		result.Filters = append(result.Filters, *child)
+	}
+	return result, nil
+}
+
+// compileFilter converts and validates a request filter.
+func compileFilter(f *btpb.RowFilter) (*kvstore.Filter, error) {
+	filter, err := toFilter(f)
+	if err != nil || filter == nil {
+		return filter, err
+	}
+	if err := filter.Validate(); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid row filter: %v", err)
+	}
+	return filter, nil
+}
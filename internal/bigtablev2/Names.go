@@ -0,0 +1,49 @@
+package bigtablev2
+
+import (
+	"bigtable/internal/kvstore"
+	"errors"
+	"strings"
+
+	"github.com/cockroachdb/pebble"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Tables are named projects/{project}/instances/{instance}/tables/{table}.
+// Every project and instance share one set of tables, so only {table} is
+// kept, the way a single-instance emulator would behave.
+func tableID(name string) (string, error) {
+	parts := strings.Split(name, "/")
+	if len(parts) != 6 || parts[0] != "projects" || parts[2] != "instances" || parts[4] != "tables" || parts[5] == "" {
+		return "", status.Errorf(codes.InvalidArgument, "invalid table name: %q", name)
+	}
+	return parts[5], nil
+}
+
+func checkParent(parent string) error {
+	parts := strings.Split(parent, "/")
+	if len(parts) != 4 || parts[0] != "projects" || parts[2] != "instances" || parts[3] == "" {
+		return status.Errorf(codes.InvalidArgument, "invalid instance name: %q", parent)
+	}
+	return nil
+}
+
+func toStatus(err error, fallback codes.Code) error {
+	if err == nil {
+		return nil
+	}
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+
+	code := fallback
+	switch {
+	case errors.Is(err, kvstore.ErrTableNotFound), errors.Is(err, kvstore.ErrFamilyNotFound),
+		errors.Is(err, pebble.ErrNotFound):
+		code = codes.NotFound
+	case errors.Is(err, kvstore.ErrTableExists):
+		code = codes.AlreadyExists
+	}
+	return status.Error(code, err.Error())
+}
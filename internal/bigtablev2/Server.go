@@ -0,0 +1,16 @@
+package bigtablev2
+
+import (
+	"bigtable/internal/node"
+
+	"cloud.google.com/go/bigtable/admin/apiv2/adminpb"
+	btpb "cloud.google.com/go/bigtable/apiv2/bigtablepb"
+	"google.golang.org/grpc"
+)
+
+// Register adds the Cloud Bigtable v2 data and table admin services to
+// server, so the official client libraries can talk to node.
+func Register(server *grpc.Server, node *node.KVNode) {
+	btpb.RegisterBigtableServer(server, NewDataServer(node))
+	adminpb.RegisterBigtableTableAdminServer(server, NewAdminServer(node))
+}
@@ -0,0 +1,103 @@
+package kvstore
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const maxAggregateGroups = 10000
+
+var ErrTooManyGroups = fmt.Errorf("aggregation exceeds %d groups", maxAggregateGroups)
+
+// AggregateSpec describes what Aggregate computes over a range. Field is a
+// dotted path into the JSON value; empty means the value itself must be a
+// JSON number. GroupBy groups keys by that segment, counted from 1, of the key
+// split on Delimiter (":" by default); 0 puts every key in one group.
+type AggregateSpec struct {
+	Field     string
+	GroupBy   int
+	Delimiter string
+}
+
+// AggregateResult holds the statistics of one group. Count is every key in
+// the group; Sum, Min, Max and Avg only cover the Values keys whose field was
+// a number.
+type AggregateResult struct {
+	Group  string   `json:"group,omitempty"`
+	Count  int64    `json:"count"`
+	Values int64    `json:"values"`
+	Sum    float64  `json:"sum"`
+	Min    *float64 `json:"min,omitempty"`
+	Max    *float64 `json:"max,omitempty"`
+	Avg    *float64 `json:"avg,omitempty"`
+}
+
+func (r *AggregateResult) add(value float64) {
+	r.Values++
+	r.Sum += value
+	if r.Min == nil || value < *r.Min {
+		r.Min = &value
+	}
+	if r.Max == nil || value > *r.Max {
+		r.Max = &value
+	}
+}
+
+// Aggregate streams over the range in opts and returns one result per group,
+// ordered by group. Limit, Cursor and Reverse are ignored.
+func (s *KVStore) Aggregate(ctx context.Context, opts RangeOptions, spec AggregateSpec) ([]AggregateResult, error) {
+	opts.Limit, opts.Cursor, opts.Reverse = 0, "", false
+
+	var path []string
+	if spec.Field != "" {
+		path = strings.Split(spec.Field, ".")
+	}
+	delimiter := []byte(spec.Delimiter)
+	if len(delimiter) == 0 {
+		delimiter = []byte(":")
+	}
+
+	groups := make(map[string]*AggregateResult)
+	_, err := s.StreamRange(ctx, opts, func(key, value []byte) error {
+		group := ""
+		if spec.GroupBy > 0 {
+			if segments := bytes.Split(key, delimiter); spec.GroupBy <= len(segments) {
+				group = string(segments[spec.GroupBy-1])
+			}
+		}
+
+		result, ok := groups[group]
+		if !ok {
+			if len(groups) == maxAggregateGroups {
+				return ErrTooManyGroups
+			}
+			result = &AggregateResult{Group: group}
+			groups[group] = result
+		}
+
+		result.Count++
+		if field, ok := lookupJSONField(value, path); ok {
+			if number, ok := field.(float64); ok {
+				result.add(number)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]AggregateResult, 0, len(groups))
+	for _, result := range groups {
+		if result.Values > 0 {
+			avg := result.Sum / float64(result.Values)
+			result.Avg = &avg
+		}
+		results = append(results, *result)
+	}
+	sort.Slice(results, func(i, j int) bool { return results[i].Group < results[j].Group })
+	return results, nil
+}
@@ -0,0 +1,452 @@
+package kvstore
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/cockroachdb/pebble"
+)
+
+const (
+	changeLogPrefix = "\x00l"
+
+	DefaultChangeRetention = 24 * time.Hour
+	changeTrimInterval     = time.Minute
+)
+
+// ErrChangesTrimmed means a watch asked to resume from a sequence number the
+// change log no longer holds.
+var ErrChangesTrimmed = errors.New("changes were trimmed from the change log")
+
+// ErrChangeAhead means a watch asked to resume from a sequence number the
+// change log has not reached.
+var ErrChangeAhead = errors.New("sequence number is ahead of the change log")
+
+var errStoreClosed = errors.New("store closed")
+
+// Change is one committed write of a flat key. Set changes carry the new
+// value, delete_range changes cover [Key, EndKey). Every change of one batch
+// has its own sequence number, in the order the batch made them.
+type Change struct {
+	Seq       uint64
+	Type      string // "set", "delete" or "delete_range"
+	Key       string
+	EndKey    string // delete_range only
+	Value     string // set only
+	Version   int64  // set only
+	ExpiresAt int64  // set only, unix milliseconds, 0 when the key never expires
+	Time      int64  // commit time, unix milliseconds
+}
+
+const (
+	changeSet byte = iota + 1
+	changeDelete
+	changeDeleteRange
+)
+
+var changeTypes = map[byte]string{changeSet: "set", changeDelete: "delete", changeDeleteRange: "delete_range"}
+
+func changeKey(seq uint64) []byte {
+	return binary.BigEndian.AppendUint64([]byte(changeLogPrefix), seq)
+}
+
+// encodeChange stores the type, commit time and key, then the raw value of a
+// set (header included) or the end key of a delete_range.
+func encodeChange(kind byte, at int64, key, rest []byte) []byte {
+	buf := make([]byte, 0, 1+2*binary.MaxVarintLen64+len(key)+len(rest))
+	buf = append(buf, kind)
+	buf = binary.AppendVarint(buf, at)
+	buf = binary.AppendUvarint(buf, uint64(len(key)))
+	buf = append(buf, key...)
+	return append(buf, rest...)
+}
+
+func decodeChange(seq uint64, data []byte) (Change, error) {
+	corrupted := fmt.Errorf("corrupted change %d", seq)
+	if len(data) == 0 || changeTypes[data[0]] == "" {
+		return Change{}, corrupted
+	}
+	change := Change{Seq: seq, Type: changeTypes[data[0]]}
+	at, n := binary.Varint(data[1:])
+	if n <= 0 {
+		return Change{}, corrupted
+	}
+	data = data[1+n:]
+	keyLen, n := binary.Uvarint(data)
+	if n <= 0 || uint64(len(data)-n) < keyLen {
+		return Change{}, corrupted
+	}
+	change.Time = at
+	change.Key = string(data[n : n+int(keyLen)])
+	rest := data[n+int(keyLen):]
+
+	switch change.Type {
+	case "set":
+		value, meta, err := decodeValue(rest)
+		if err != nil {
+			return Change{}, err
+		}
+		change.Value, change.Version, change.ExpiresAt = string(value), meta.version, meta.expiresAt
+	case "delete_range":
+		change.EndKey = string(rest)
+	}
+	return change, nil
+}
+
+// changeLog appends every write of a flat key to the "\x00l" keyspace in the
+// batch that makes it, so the log is as durable as the write. Sequence
+// numbers are handed out under mu but batches commit concurrently; last only
+// moves past a range once every earlier range has committed too, so watchers
+// tail the log in order. Writes of one key are ordered by the key locks of
+// KVNode, which are held across the commit.
+type changeLog struct {
+	mu      sync.Mutex
+	first   uint64 // oldest sequence number still in the log
+	last    uint64 // newest sequence number below which every commit finished
+	next    uint64 // next sequence number to hand out
+	pending []*pendingChanges
+	updated chan struct{}
+
+	closed   bool
+	watchers sync.WaitGroup // Close waits for them before closing the db
+}
+
+// pendingChanges is a range of sequence numbers handed to a batch that is
+// still committing. A failed commit leaves its range as a hole in the log.
+type pendingChanges struct {
+	last uint64
+	done bool
+}
+
+func loadChangeLog(db *pebble.DB) (*changeLog, error) {
+	iter, err := db.NewIter(&pebble.IterOptions{
+		LowerBound: []byte(changeLogPrefix),
+		UpperBound: prefixEnd([]byte(changeLogPrefix)),
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer iter.Close()
+
+	l := &changeLog{updated: make(chan struct{})}
+	if iter.First() {
+		l.first = binary.BigEndian.Uint64(iter.Key()[len(changeLogPrefix):])
+		iter.Last()
+		l.last = binary.BigEndian.Uint64(iter.Key()[len(changeLogPrefix):])
+	} else {
+		l.first = 1
+	}
+	l.next = l.last + 1
+	return l, iter.Error()
+}
+
+// userKey reports whether key belongs to the flat keyspace rather than to
+// tables, indexes or other internal records.
+func userKey(key []byte) bool {
+	return len(key) == 0 || key[0] != internalPrefix[0]
+}
+
+// commit logs the flat key writes of batch and commits it without syncing.
+func (l *changeLog) commit(batch *pebble.Batch) error {
+	type record struct {
+		kind      byte
+		key, rest []byte
+	}
+	var records []record
+	reader := batch.Reader()
+	for {
+		kind, key, value, ok, err := reader.Next()
+		if err != nil {
+			return err
+		}
+		if !ok {
+			break
+		}
+		switch kind {
+		case pebble.InternalKeyKindSet:
+			if userKey(key) {
+				records = append(records, record{changeSet, key, value})
+			}
+		case pebble.InternalKeyKindDelete, pebble.InternalKeyKindSingleDelete:
+			if userKey(key) {
+				records = append(records, record{changeDelete, key, nil})
+			}
+		case pebble.InternalKeyKindRangeDelete:
+			// value is the end key; skip ranges that lie inside internal keys
+			if userKey(key) || bytes.Compare(value, prefixEnd([]byte(internalPrefix))) > 0 {
+				records = append(records, record{changeDeleteRange, key, value})
+			}
+		}
+	}
+
+	if len(records) == 0 {
+		return batch.Commit(pebble.NoSync)
+	}
+
+	l.mu.Lock()
+	seq := l.next
+	l.next += uint64(len(records))
+	p := &pendingChanges{last: l.next - 1}
+	l.pending = append(l.pending, p)
+	l.mu.Unlock()
+	defer l.publish(p)
+
+	at := time.Now().UnixMilli()
+	for i, r := range records {
+		if err := batch.Set(changeKey(seq+uint64(i)), encodeChange(r.kind, at, r.key, r.rest), nil); err != nil {
+			return err
+		}
+	}
+	return batch.Commit(pebble.NoSync)
+}
+
+// publish marks p as done and moves last past every leading range that is
+// done, waking the watchers when it moved.
+func (l *changeLog) publish(p *pendingChanges) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	p.done = true
+
+	moved := false
+	for len(l.pending) > 0 && l.pending[0].done {
+		l.last = l.pending[0].last
+		l.pending[0] = nil
+		l.pending = l.pending[1:]
+		moved = true
+	}
+	if moved {
+		close(l.updated)
+		l.updated = make(chan struct{})
+	}
+}
+
+func (l *changeLog) state() (first, last uint64, updated <-chan struct{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.first, l.last, l.updated
+}
+
+// CheckResume reports whether a watch can resume after the sequence number
+// after: ErrChangesTrimmed when changes following it are gone, and
+// ErrChangeAhead when the log never reached it.
+func (s *KVStore) CheckResume(after uint64) error {
+	first, last, _ := s.changes.state()
+	return checkResume(after, first, last)
+}
+
+func checkResume(after, first, last uint64) error {
+	if after+1 < first {
+		return fmt.Errorf("%w: oldest change is %d", ErrChangesTrimmed, first)
+	}
+	if after > last {
+		return fmt.Errorf("%w: newest change is %d", ErrChangeAhead, last)
+	}
+	return nil
+}
+
+// LastChangeSeq returns the sequence number of the newest change, 0 when
+// nothing was written yet.
+func (s *KVStore) LastChangeSeq() uint64 {
+	_, last, _ := s.changes.state()
+	return last
+}
+
+// WatchChanges calls emit with every change of a key under prefix whose
+// sequence number is above after, in order: first the ones already in the
+// log, then new ones as they commit. Changes are emitted once committed,
+// possibly before they are durable. A delete_range is emitted when it
+// overlaps prefix. It returns when ctx is done or emit fails, and with the
+// errors of CheckResume when it cannot start after after.
+func (s *KVStore) WatchChanges(ctx context.Context, prefix string, after uint64, emit func(Change) error) error {
+	s.changes.mu.Lock()
+	if s.changes.closed {
+		s.changes.mu.Unlock()
+		return errStoreClosed
+	}
+	s.changes.watchers.Add(1)
+	s.changes.mu.Unlock()
+	defer s.changes.watchers.Done()
+
+	first, last, _ := s.changes.state()
+	if err := checkResume(after, first, last); err != nil {
+		return err
+	}
+	for {
+		first, last, updated := s.changes.state()
+		if after+1 < first {
+			return fmt.Errorf("%w: oldest change is %d", ErrChangesTrimmed, first)
+		}
+		if after < last {
+			next, err := s.readChanges(ctx, prefix, after, last, emit)
+			if err != nil {
+				return err
+			}
+			after = next
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-s.stop:
+			return errStoreClosed
+		case <-updated:
+		}
+	}
+}
+
+// readChanges emits the matching changes in (after, last] and returns last.
+// A missing sequence number was trimmed when first has moved past it, and
+// belongs to a failed commit otherwise.
+func (s *KVStore) readChanges(ctx context.Context, prefix string, after, last uint64, emit func(Change) error) (uint64, error) {
+	iter, err := s.db.NewIter(&pebble.IterOptions{
+		LowerBound: changeKey(after + 1),
+		UpperBound: changeKey(last + 1),
+	})
+	if err != nil {
+		return after, err
+	}
+	defer iter.Close()
+
+	read := 0
+	for iter.First(); iter.Valid(); iter.Next() {
+		read++
+		if read%streamCheckEvery == 0 {
+			if err := ctx.Err(); err != nil {
+				return after, err
+			}
+		}
+		seq := binary.BigEndian.Uint64(iter.Key()[len(changeLogPrefix):])
+		if seq != after+1 {
+			if err := s.checkHole(after + 1); err != nil {
+				return after, err
+			}
+		}
+		change, err := decodeChange(seq, iter.Value())
+		if err != nil {
+			return after, err
+		}
+		if changeMatches(change, prefix) {
+			if err := emit(change); err != nil {
+				return after, err
+			}
+		}
+		after = seq
+	}
+	if err := iter.Error(); err != nil {
+		return after, err
+	}
+	if after != last {
+		if err := s.checkHole(after + 1); err != nil {
+			return after, err
+		}
+	}
+	return last, nil
+}
+
+// checkHole returns ErrChangesTrimmed when seq is missing because it was
+// trimmed. TrimChanges raises first before it deletes anything.
+func (s *KVStore) checkHole(seq uint64) error {
+	if first, _, _ := s.changes.state(); seq < first {
+		return fmt.Errorf("%w: change %d is gone", ErrChangesTrimmed, seq)
+	}
+	return nil
+}
+
+func changeMatches(change Change, prefix string) bool {
+	if prefix == "" {
+		return true
+	}
+	if change.Type != "delete_range" {
+		return len(change.Key) >= len(prefix) && change.Key[:len(prefix)] == prefix
+	}
+	end := prefixEnd([]byte(prefix))
+	return (end == nil || change.Key < string(end)) && change.EndKey > prefix
+}
+
+// TrimChanges drops changes older than retention, always keeping the newest
+// one so sequence numbers keep counting up across restarts. It returns the
+// number of changes dropped.
+func (s *KVStore) TrimChanges(retention time.Duration) (int, error) {
+	first, last, _ := s.changes.state()
+	if last <= first {
+		return 0, nil
+	}
+	cutoff := time.Now().Add(-retention).UnixMilli()
+
+	iter, err := s.db.NewIter(&pebble.IterOptions{
+		LowerBound: changeKey(first),
+		UpperBound: changeKey(last),
+	})
+	if err != nil {
+		return 0, err
+	}
+	keep := first
+	for iter.First(); iter.Valid(); iter.Next() {
+		seq := binary.BigEndian.Uint64(iter.Key()[len(changeLogPrefix):])
+		change, err := decodeChange(seq, iter.Value())
+		if err != nil {
+			iter.Close()
+			return 0, err
+		}
+		if change.Time >= cutoff {
+			break
+		}
+		keep = seq + 1
+	}
+	if err := iter.Close(); err != nil {
+		return 0, err
+	}
+	if keep == first {
+		return 0, nil
+	}
+
+	// Raise first before the entries go, so a watcher never reads a hole
+	s.changes.mu.Lock()
+	s.changes.first = keep
+	s.changes.mu.Unlock()
+	if err := s.db.DeleteRange(changeKey(first), changeKey(keep), pebble.NoSync); err != nil {
+		return 0, err
+	}
+	return int(keep - first), nil
+}
+
+// SetChangeRetention sets how long the change log keeps changes,
+// DefaultChangeRetention unless changed.
+func (s *KVStore) SetChangeRetention(retention time.Duration) {
+	s.changeRetention.Store(int64(retention))
+}
+
+func (s *KVStore) runChangeTrimmer() {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(changeTrimInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+			if n, err := s.TrimChanges(time.Duration(s.changeRetention.Load())); err != nil {
+				log.Printf("Change log trimming failed: %v", err)
+			} else if n > 0 {
+				log.Printf("Trimmed %d changes from the change log", n)
+			}
+		}
+	}
+}
+
+// close ends every watch; the database must stay open until it returns.
+func (l *changeLog) close() {
+	l.mu.Lock()
+	l.closed = true
+	l.mu.Unlock()
+	l.watchers.Wait()
+}
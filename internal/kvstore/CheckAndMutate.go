@@ -0,0 +1,140 @@
+package kvstore
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/cockroachdb/pebble"
+)
+
+// Condition is the predicate of a check-and-mutate call. Family and Qualifier
+// only apply to table rows: without them "exists" checks the whole row, with
+// them every condition looks at the newest visible version of that column.
+// A "filter" condition, also table rows only, holds when Filter leaves any
+// cell of the row.
+type Condition struct {
+	Type      string  `json:"type"` // "exists", "not_exists", "value_equals", "version_equals" or "filter"
+	Value     string  `json:"value,omitempty"`
+	Version   int64   `json:"version,omitempty"`
+	Family    string  `json:"family,omitempty"`
+	Qualifier string  `json:"qualifier,omitempty"`
+	Filter    *Filter `json:"filter,omitempty"`
+}
+
+func (c Condition) evaluate(exists bool, value string, version int64) (bool, error) {
+	switch c.Type {
+	case "exists":
+		return exists, nil
+	case "not_exists":
+		return !exists, nil
+	case "value_equals":
+		return exists && value == c.Value, nil
+	case "version_equals":
+		// Version 0 stands for "no value yet"
+		if !exists {
+			return c.Version == 0, nil
+		}
+		return version == c.Version, nil
+	case "filter":
+		return false, fmt.Errorf("%w: filter conditions only apply to table rows", ErrInvalidOperation)
+	default:
+		return false, fmt.Errorf("%w: unknown condition type: %q", ErrInvalidOperation, c.Type)
+	}
+}
+
+// CheckAndMutate applies onTrue when cond holds for key and onFalse
+// otherwise, in a single batch. It reports whether the condition matched.
+// Callers must serialize it with other writers of key; KVNode does.
+func (s *KVStore) CheckAndMutate(key string, cond Condition, onTrue, onFalse []BatchOperation) (bool, error) {
+	value, version, err := s.GetWithVersion(key)
+	exists := err == nil
+	if err != nil && !errors.Is(err, pebble.ErrNotFound) {
+		return false, err
+	}
+
+	matched, err := cond.evaluate(exists, value, version)
+	if err != nil {
+		return false, err
+	}
+
+	operations := onFalse
+	if matched {
+		operations = onTrue
+	}
+	if len(operations) == 0 {
+		return matched, nil
+	}
+	return matched, s.BatchOperation(operations)
+}
+
+// SetIf writes key with the given TTL only when cond holds, which is how
+// Redis SET NX and XX behave. It reports whether the value was written.
+// Callers must serialize it with other writers of key; KVNode does.
+func (s *KVStore) SetIf(key, value string, ttl time.Duration, cond Condition) (bool, error) {
+	current, version, err := s.GetWithVersion(key)
+	exists := err == nil
+	if err != nil && !errors.Is(err, pebble.ErrNotFound) {
+		return false, err
+	}
+
+	matched, err := cond.evaluate(exists, current, version)
+	if err != nil || !matched {
+		return false, err
+	}
+	return true, s.SetWithTTL(key, value, ttl)
+}
+
+// CheckAndMutateRow is the table-row variant of CheckAndMutate.
+func (s *KVStore) CheckAndMutateRow(table, row string, cond Condition, onTrue, onFalse []Mutation) (bool, error) {
+	info, err := s.GetTable(table)
+	if err != nil {
+		return false, err
+	}
+
+	lower, upper := rowKeyPrefix(table, row), prefixEnd(rowKeyPrefix(table, row))
+	readOpts := ReadOptions{MaxVersions: 1}
+	if cond.Type == "filter" {
+		readOpts = ReadOptions{Filter: cond.Filter}
+		cond = Condition{Type: "exists"}
+	}
+	if cond.Family != "" {
+		lower = columnKeyPrefix(table, row, cond.Family, cond.Qualifier)
+		upper = prefixEnd(lower)
+	} else if cond.Type == "value_equals" || cond.Type == "version_equals" {
+		return false, fmt.Errorf("%s conditions need a family and qualifier", cond.Type)
+	}
+
+	rows, _, err := s.readRows(table, lower, upper, 1, readOpts)
+	if err != nil {
+		return false, err
+	}
+
+	var value string
+	var version int64
+	exists := len(rows) > 0
+	if exists {
+		value, version = rows[0].Cells[0].Value, rows[0].Cells[0].Timestamp
+	}
+
+	matched, err := cond.evaluate(exists, value, version)
+	if err != nil {
+		return false, err
+	}
+
+	mutations := onFalse
+	if matched {
+		mutations = onTrue
+	}
+	if len(mutations) == 0 {
+		return matched, nil
+	}
+
+	batch := s.db.NewBatch()
+	defer batch.Close()
+
+	if err := applyMutations(batch, info, row, mutations); err != nil {
+		return false, err
+	}
+	return matched, s.commit(batch)
+}
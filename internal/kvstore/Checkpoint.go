@@ -0,0 +1,11 @@
+package kvstore
+
+import "github.com/cockroachdb/pebble"
+
+// Checkpoint writes a consistent copy of the database to dir, which must not
+// exist yet, while writes go on. Every write acknowledged before the call is
+// in it, nosync ones included. Table files are hard linked when dir is on the
+// same filesystem. The copy is a database NewKVStore can open.
+func (s *KVStore) Checkpoint(dir string) error {
+	return s.db.Checkpoint(dir, pebble.WithFlushedWAL())
+}
@@ -0,0 +1,322 @@
+package kvstore
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/cockroachdb/pebble"
+)
+
+const (
+	counterPrefix = "\x00n"
+
+	maxPrefixCounters = 64
+)
+
+var ErrTooManyCounters = fmt.Errorf("at most %d prefix counters can be enabled", maxPrefixCounters)
+
+// prefixCounters keeps the number of stored keys under selected prefixes up
+// to date on every write, so counting them does not need a scan. Expired keys
+// are counted until the reaper removes them.
+type prefixCounters struct {
+	// Commits that touch a counted prefix hold mu exclusively between reading
+	// the previous state of their keys and committing; all others share it.
+	mu     sync.RWMutex
+	counts map[string]int64
+}
+
+func counterKey(prefix string) []byte {
+	return []byte(counterPrefix + prefix)
+}
+
+func loadPrefixCounters(db *pebble.DB) (*prefixCounters, error) {
+	iter, err := db.NewIter(&pebble.IterOptions{
+		LowerBound: []byte(counterPrefix),
+		UpperBound: prefixEnd([]byte(counterPrefix)),
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer iter.Close()
+
+	c := &prefixCounters{counts: make(map[string]int64)}
+	for iter.First(); iter.Valid(); iter.Next() {
+		if len(iter.Value()) != 8 {
+			return nil, fmt.Errorf("corrupted counter %q", iter.Key())
+		}
+		prefix := string(iter.Key()[len(counterPrefix):])
+		c.counts[prefix] = int64(binary.BigEndian.Uint64(iter.Value()))
+	}
+	return c, iter.Error()
+}
+
+// matching calls fn for every counted prefix of key.
+func (c *prefixCounters) matching(key []byte, fn func(prefix string)) {
+	for prefix := range c.counts {
+		if bytes.HasPrefix(key, []byte(prefix)) {
+			fn(prefix)
+		}
+	}
+}
+
+// overlapping calls fn with the part of [start, end) under every counted
+// prefix it overlaps.
+func (c *prefixCounters) overlapping(start, end []byte, fn func(lower, upper []byte)) {
+	for prefix := range c.counts {
+		lower, upper := []byte(prefix), prefixEnd([]byte(prefix))
+		if bytes.Compare(start, lower) > 0 {
+			lower = start
+		}
+		if upper == nil || bytes.Compare(end, upper) < 0 {
+			upper = end
+		}
+		if bytes.Compare(lower, upper) < 0 {
+			fn(lower, upper)
+		}
+	}
+}
+
+func (c *prefixCounters) touches(batch *pebble.Batch) bool {
+	if len(c.counts) == 0 {
+		return false
+	}
+	touched := false
+	reader := batch.Reader()
+	for !touched {
+		kind, key, value, ok, err := reader.Next()
+		if !ok || err != nil {
+			// A malformed batch fails in Commit anyway
+			return false
+		}
+		if kind == pebble.InternalKeyKindRangeDelete {
+			c.overlapping(key, value, func(_, _ []byte) { touched = true })
+		} else {
+			c.matching(key, func(string) { touched = true })
+		}
+	}
+	return true
+}
+
+// deltas replays batch against db and returns how each counted prefix
+// changes when it commits. Range tombstones over a counted prefix cost a scan
+// of the keys they cover.
+func (c *prefixCounters) deltas(db *pebble.DB, batch *pebble.Batch) (map[string]int64, error) {
+	deltas := make(map[string]int64)
+	present := make(map[string]bool)
+	var cleared [][2][]byte
+
+	existed := func(key []byte) (bool, error) {
+		if before, seen := present[string(key)]; seen {
+			return before, nil
+		}
+		for _, span := range cleared {
+			if bytes.Compare(key, span[0]) >= 0 && bytes.Compare(key, span[1]) < 0 {
+				return false, nil
+			}
+		}
+		_, closer, err := db.Get(key)
+		if err == nil {
+			closer.Close()
+			return true, nil
+		}
+		if errors.Is(err, pebble.ErrNotFound) {
+			return false, nil
+		}
+		return false, err
+	}
+	update := func(key []byte, before, after bool) {
+		present[string(key)] = after
+		if before == after {
+			return
+		}
+		delta := int64(1)
+		if before {
+			delta = -1
+		}
+		c.matching(key, func(prefix string) { deltas[prefix] += delta })
+	}
+
+	reader := batch.Reader()
+	for {
+		kind, key, value, ok, err := reader.Next()
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return deltas, nil
+		}
+
+		switch kind {
+		case pebble.InternalKeyKindSet, pebble.InternalKeyKindDelete, pebble.InternalKeyKindSingleDelete:
+			before, err := existed(key)
+			if err != nil {
+				return nil, err
+			}
+			update(key, before, kind == pebble.InternalKeyKindSet)
+		case pebble.InternalKeyKindRangeDelete:
+			removed, err := c.keysInRange(db, key, value, existed, present)
+			if err != nil {
+				return nil, err
+			}
+			for _, k := range removed {
+				update([]byte(k), true, false)
+			}
+			cleared = append(cleared, [2][]byte{key, value})
+		}
+	}
+}
+
+// keysInRange lists the counted keys in [start, end) that exist at this point
+// of the batch replay.
+func (c *prefixCounters) keysInRange(db *pebble.DB, start, end []byte, existed func([]byte) (bool, error), present map[string]bool) ([]string, error) {
+	found := make(map[string]bool)
+	var err error
+	c.overlapping(start, end, func(lower, upper []byte) {
+		if err != nil {
+			return
+		}
+		var iter *pebble.Iterator
+		if iter, err = db.NewIter(&pebble.IterOptions{LowerBound: lower, UpperBound: upper}); err != nil {
+			return
+		}
+		for iter.First(); iter.Valid() && err == nil; iter.Next() {
+			var exists bool
+			if exists, err = existed(iter.Key()); exists {
+				found[string(iter.Key())] = true
+			}
+		}
+		if closeErr := iter.Close(); err == nil {
+			err = closeErr
+		}
+		// Keys written earlier in the batch are not in db yet
+		for k, exists := range present {
+			if exists && k >= string(lower) && k < string(upper) {
+				found[k] = true
+			}
+		}
+	})
+
+	keys := make([]string, 0, len(found))
+	for k := range found {
+		keys = append(keys, k)
+	}
+	return keys, err
+}
+
+// commit commits a batch with the default write options.
+func (s *KVStore) commit(batch *pebble.Batch) error {
+	return s.commitWith(batch, WriteOptions{})
+}
+
+// commitWith commits a batch and returns once it is as durable as opts ask.
+func (s *KVStore) commitWith(batch *pebble.Batch, opts WriteOptions) error {
+	if err := s.apply(batch); err != nil {
+		return err
+	}
+	opts = s.resolve(opts)
+	switch opts.Durability {
+	case DurabilityNoSync:
+		return nil
+	case DurabilityGroupSync:
+		return s.syncer.syncWithin(opts.GroupSyncWindow)
+	default:
+		return s.syncer.sync()
+	}
+}
+
+// apply commits batch without syncing and keeps the prefix counters and the
+// change log in step with it.
+func (s *KVStore) apply(batch *pebble.Batch) error {
+	c := s.counters
+	c.mu.RLock()
+	if !c.touches(batch) {
+		defer c.mu.RUnlock()
+		return s.changes.commit(batch)
+	}
+	c.mu.RUnlock()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	deltas, err := c.deltas(s.db, batch)
+	if err != nil {
+		return err
+	}
+	counts := make(map[string]int64, len(deltas))
+	for prefix, delta := range deltas {
+		counts[prefix] = c.counts[prefix] + delta
+		if err := batch.Set(counterKey(prefix), binary.BigEndian.AppendUint64(nil, uint64(counts[prefix])), nil); err != nil {
+			return err
+		}
+	}
+	if err := s.changes.commit(batch); err != nil {
+		return err
+	}
+	for prefix, count := range counts {
+		c.counts[prefix] = count
+	}
+	return nil
+}
+
+// EnableCounter starts maintaining the key count of prefix. The first count
+// is a full scan; writes are blocked while it runs.
+func (s *KVStore) EnableCounter(prefix string) (int64, error) {
+	if prefix == "" || strings.HasPrefix(prefix, internalPrefix) {
+		return 0, fmt.Errorf("invalid counter prefix: %q", prefix)
+	}
+
+	c := s.counters
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if count, ok := c.counts[prefix]; ok {
+		return count, nil
+	}
+	if len(c.counts) >= maxPrefixCounters {
+		return 0, ErrTooManyCounters
+	}
+
+	iter, err := s.db.NewIter(prefixIterOptions(prefix))
+	if err != nil {
+		return 0, err
+	}
+	var count int64
+	for iter.First(); iter.Valid(); iter.Next() {
+		count++
+	}
+	if err := iter.Close(); err != nil {
+		return 0, err
+	}
+
+	if err := s.db.Set(counterKey(prefix), binary.BigEndian.AppendUint64(nil, uint64(count)), pebble.Sync); err != nil {
+		return 0, err
+	}
+	c.counts[prefix] = count
+	return count, nil
+}
+
+func (s *KVStore) DisableCounter(prefix string) error {
+	c := s.counters
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := s.db.Delete(counterKey(prefix), pebble.Sync); err != nil {
+		return err
+	}
+	delete(c.counts, prefix)
+	return nil
+}
+
+// Counter returns the maintained key count of prefix, if it has one.
+func (s *KVStore) Counter(prefix string) (int64, bool) {
+	c := s.counters
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	count, ok := c.counts[prefix]
+	return count, ok
+}
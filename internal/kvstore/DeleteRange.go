@@ -0,0 +1,74 @@
+package kvstore
+
+import (
+	"errors"
+	"fmt"
+)
+
+var ErrInvalidRange = errors.New("invalid key range")
+
+// deleteRangeBounds validates a user key range for a range tombstone. The
+// range never reaches into the internal keyspace.
+func deleteRangeBounds(startKey, endKey string) ([]byte, []byte, error) {
+	if endKey == "" {
+		return nil, nil, fmt.Errorf("%w: delete range needs an end key", ErrInvalidRange)
+	}
+	if err := checkKey(startKey); err != nil {
+		return nil, nil, err
+	}
+	lower, upper := RangeOptions{StartKey: startKey, EndKey: endKey}.rangeBounds()
+	if string(lower) >= string(upper) {
+		return nil, nil, fmt.Errorf("%w: [%q, %q) is empty", ErrInvalidRange, startKey, endKey)
+	}
+	return lower, upper, nil
+}
+
+func deletePrefixBounds(prefix string) ([]byte, []byte, error) {
+	if prefix == "" {
+		return nil, nil, fmt.Errorf("%w: delete prefix needs a prefix", ErrInvalidRange)
+	}
+	upper := prefixEnd([]byte(prefix))
+	if upper == nil {
+		return nil, nil, fmt.Errorf("%w: no keys follow prefix %q", ErrInvalidRange, prefix)
+	}
+	return deleteRangeBounds(prefix, string(upper))
+}
+
+// DeleteRange removes every key in [startKey, endKey) with a single range
+// tombstone. Expiry index entries of the removed keys are left for the
+// reaper, which skips keys that no longer exist.
+func (s *KVStore) DeleteRange(startKey, endKey string) error {
+	lower, upper, err := deleteRangeBounds(startKey, endKey)
+	if err != nil {
+		return err
+	}
+	return s.deleteRange(lower, upper)
+}
+
+func (s *KVStore) DeletePrefix(prefix string) error {
+	lower, upper, err := deletePrefixBounds(prefix)
+	if err != nil {
+		return err
+	}
+	return s.deleteRange(lower, upper)
+}
+
+func (s *KVStore) deleteRange(lower, upper []byte) error {
+	batch := s.db.NewBatch()
+	defer batch.Close()
+
+	if err := batch.DeleteRange(lower, upper, nil); err != nil {
+		return err
+	}
+	return s.commit(batch)
+}
+
+// CountRange counts the live keys in [startKey, endKey) like CountKeys does
+// for a prefix. It is what a DeleteRange would remove.
+func (s *KVStore) CountRange(startKey, endKey string, maxScan int) (int, bool, error) {
+	lower, upper, err := deleteRangeBounds(startKey, endKey)
+	if err != nil {
+		return 0, false, err
+	}
+	return s.countKeys(lower, upper, maxScan)
+}
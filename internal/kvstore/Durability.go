@@ -0,0 +1,100 @@
+package kvstore
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Durability says when a write is acknowledged.
+type Durability int
+
+const (
+	// DurabilityDefault uses the store default, see SetDefaultWriteOptions.
+	DurabilityDefault Durability = iota
+	// DurabilitySync returns once the write is fsynced. Concurrent writes
+	// share one WAL sync.
+	DurabilitySync
+	// DurabilityNoSync returns once the write is in the WAL buffer; a crash
+	// of the machine can lose it.
+	DurabilityNoSync
+	// DurabilityGroupSync returns once the write is fsynced, but waits up to
+	// GroupSyncWindow for other writes to share the sync.
+	DurabilityGroupSync
+)
+
+const DefaultGroupSyncWindow = 2 * time.Millisecond
+
+// WriteOptions control how a single write is committed. The zero value uses
+// the store default.
+type WriteOptions struct {
+	Durability      Durability
+	GroupSyncWindow time.Duration // group sync only, DefaultGroupSyncWindow when 0
+}
+
+// ParseWriteOptions reads "sync", "nosync", "group-sync" or
+// "group-sync:<duration>" such as "group-sync:10ms". An empty string is the
+// store default.
+func ParseWriteOptions(s string) (WriteOptions, error) {
+	mode, window, hasWindow := strings.Cut(s, ":")
+	switch mode {
+	case "":
+		if !hasWindow {
+			return WriteOptions{}, nil
+		}
+	case "sync":
+		if !hasWindow {
+			return WriteOptions{Durability: DurabilitySync}, nil
+		}
+	case "nosync":
+		if !hasWindow {
+			return WriteOptions{Durability: DurabilityNoSync}, nil
+		}
+	case "group-sync":
+		opts := WriteOptions{Durability: DurabilityGroupSync}
+		if !hasWindow {
+			return opts, nil
+		}
+		d, err := time.ParseDuration(window)
+		if err != nil || d <= 0 || d > time.Second {
+			return WriteOptions{}, fmt.Errorf("invalid group sync window %q, want a duration up to 1s", window)
+		}
+		opts.GroupSyncWindow = d
+		return opts, nil
+	}
+	return WriteOptions{}, fmt.Errorf("invalid durability %q, want sync, nosync or group-sync[:<duration>]", s)
+}
+
+func (o WriteOptions) String() string {
+	switch o.Durability {
+	case DurabilitySync:
+		return "sync"
+	case DurabilityNoSync:
+		return "nosync"
+	case DurabilityGroupSync:
+		if o.GroupSyncWindow == 0 {
+			return "group-sync"
+		}
+		return "group-sync:" + o.GroupSyncWindow.String()
+	}
+	return ""
+}
+
+// SetDefaultWriteOptions sets the durability of writes that do not choose
+// one, DurabilitySync unless changed.
+func (s *KVStore) SetDefaultWriteOptions(opts WriteOptions) {
+	if opts.Durability == DurabilityDefault {
+		opts.Durability = DurabilitySync
+	}
+	s.writeDefaults.Store(&opts)
+}
+
+func (s *KVStore) resolve(opts WriteOptions) WriteOptions {
+	if opts.Durability == DurabilityDefault {
+		opts = *s.writeDefaults.Load()
+	}
+	if opts.Durability == DurabilityGroupSync && opts.GroupSyncWindow == 0 {
+		opts.GroupSyncWindow = DefaultGroupSyncWindow
+	}
+	return opts
+}
@@ -0,0 +1,155 @@
+package kvstore
+
+import (
+	"bytes"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/cockroachdb/pebble"
+)
+
+// KeyEstimate is a cheap approximation of how many keys live under a prefix
+// and how much disk they use.
+type KeyEstimate struct {
+	Keys   int64  `json:"keys"`
+	Bytes  uint64 `json:"bytes"`
+	Source string `json:"source"` // "counter" or "sstables"
+}
+
+// EstimateKeys answers from the prefix counter when one is enabled. Otherwise
+// it scales the entry counts in the table properties of every sstable
+// overlapping the prefix by the share of the table the prefix covers. Writes
+// still in the memtable are not part of that estimate until they are flushed.
+func (s *KVStore) EstimateKeys(prefix string) (KeyEstimate, error) {
+	if err := checkKey(prefix); err != nil {
+		return KeyEstimate{}, err
+	}
+	lower, upper := flatPrefixBounds(prefix)
+	if upper == nil {
+		upper = bytes.Repeat([]byte{0xff}, len(prefix)+1)
+	}
+
+	var estimate KeyEstimate
+	var err error
+	if estimate.Bytes, err = s.db.EstimateDiskUsage(lower, upper); err != nil {
+		return estimate, err
+	}
+
+	if count, ok := s.Counter(prefix); ok {
+		estimate.Keys, estimate.Source = count, "counter"
+		return estimate, nil
+	}
+
+	levels, err := s.db.SSTables(
+		pebble.WithProperties(),
+		pebble.WithKeyRangeFilter(lower, upper),
+		pebble.WithApproximateSpanBytes(),
+	)
+	if err != nil {
+		return estimate, err
+	}
+
+	var keys float64
+	for _, tables := range levels {
+		for _, table := range tables {
+			props := table.Properties
+			if props == nil || table.Size == 0 || props.NumEntries <= props.NumDeletions {
+				continue
+			}
+			span, err := strconv.ParseUint(props.UserProperties["approximate-span-bytes"], 10, 64)
+			if err != nil {
+				continue
+			}
+			live := float64(props.NumEntries - props.NumDeletions)
+			keys += live * float64(min(span, table.Size)) / float64(table.Size)
+		}
+	}
+	estimate.Keys, estimate.Source = int64(keys+0.5), "sstables"
+	return estimate, nil
+}
+
+// CountKeys counts the live keys under prefix exactly, giving up after
+// visiting maxScan entries (0 for no limit). complete is false when it gave
+// up; count then covers the part it scanned.
+func (s *KVStore) CountKeys(prefix string, maxScan int) (count int, complete bool, err error) {
+	if err := checkKey(prefix); err != nil {
+		return 0, false, err
+	}
+	lower, upper := flatPrefixBounds(prefix)
+	return s.countKeys(lower, upper, maxScan)
+}
+
+func (s *KVStore) countKeys(lower, upper []byte, maxScan int) (count int, complete bool, err error) {
+	iter, err := s.db.NewIter(&pebble.IterOptions{LowerBound: lower, UpperBound: upper})
+	if err != nil {
+		return 0, false, err
+	}
+	defer iter.Close()
+
+	now := time.Now().UnixMilli()
+	scanned := 0
+	for iter.First(); iter.Valid(); iter.Next() {
+		if maxScan > 0 && scanned == maxScan {
+			return count, false, iter.Error()
+		}
+		scanned++
+		if _, live, err := liveValue(iter.Value(), now); err != nil {
+			return 0, false, err
+		} else if live {
+			count++
+		}
+	}
+	return count, true, iter.Error()
+}
+
+// RowSample is a row key that splits a table into chunks of roughly Offset
+// bytes before it, as in Bigtable's SampleRowKeys.
+type RowSample struct {
+	Key    string
+	Offset uint64
+}
+
+// SampleRowKeys takes the last row of every sstable of the table as a split
+// point. The final sample has an empty key and the size of the whole table.
+func (s *KVStore) SampleRowKeys(table string) ([]RowSample, error) {
+	if _, err := s.GetTable(table); err != nil {
+		return nil, err
+	}
+	lower := tableKeyPrefix(table)
+	upper := prefixEnd(lower)
+
+	levels, err := s.db.SSTables(pebble.WithKeyRangeFilter(lower, upper))
+	if err != nil {
+		return nil, err
+	}
+	var samples []RowSample
+	for _, tables := range levels {
+		for _, t := range tables {
+			row, _, _, _, err := decodeCellKey(table, t.Largest.UserKey)
+			if err != nil {
+				// Range tombstone bounds or keys of a neighbouring table
+				continue
+			}
+			samples = append(samples, RowSample{Key: row, Offset: t.Size})
+		}
+	}
+	sort.Slice(samples, func(i, j int) bool { return samples[i].Key < samples[j].Key })
+
+	var offset uint64
+	deduped := samples[:0]
+	for _, sample := range samples {
+		offset += sample.Offset
+		if n := len(deduped); n > 0 && deduped[n-1].Key == sample.Key {
+			deduped[n-1].Offset = offset
+			continue
+		}
+		deduped = append(deduped, RowSample{Key: sample.Key, Offset: offset})
+	}
+
+	total, err := s.db.EstimateDiskUsage(lower, upper)
+	if err != nil {
+		return nil, err
+	}
+	return append(deduped, RowSample{Offset: max(total, offset)}), nil
+}
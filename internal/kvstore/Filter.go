@@ -0,0 +1,284 @@
+package kvstore
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Filter selects cells of a row during a scan, modeled on Bigtable's
+// RowFilter. A flat key/value entry is a row with a single cell that has no
+// family or qualifier and the write version as its timestamp.
+//
+//	key_regex, value_regex, family_regex, qualifier_regex: Pattern
+//	json_field:             Field (dotted path), Op, Value
+//	timestamp_range:        StartTimestamp (inclusive), EndTimestamp (exclusive)
+//	cells_per_row_limit, cells_per_row_offset, cells_per_column_limit: Count
+//	strip_value, pass_all, block_all
+//	chain, interleave:      Filters
+type Filter struct {
+	Type           string          `json:"type"`
+	Pattern        string          `json:"pattern,omitempty"`
+	Field          string          `json:"field,omitempty"`
+	Op             string          `json:"op,omitempty"` // eq, ne, lt, lte, gt, gte or exists
+	Value          json.RawMessage `json:"value,omitempty"`
+	StartTimestamp int64           `json:"startTimestamp,omitempty"`
+	EndTimestamp   int64           `json:"endTimestamp,omitempty"`
+	Count          int             `json:"count,omitempty"`
+	Filters        []Filter        `json:"filters,omitempty"`
+}
+
+func (f *Filter) Validate() error {
+	_, err := f.compile()
+	return err
+}
+
+type compiledFilter struct {
+	kind       string
+	re         *regexp.Regexp
+	path       []string
+	op         string
+	operand    interface{}
+	start, end int64
+	count      int
+	children   []*compiledFilter
+}
+
+// compile checks the filter and prepares its regular expressions. A nil
+// filter compiles to nil, which passes everything.
+func (f *Filter) compile() (*compiledFilter, error) {
+	if f == nil {
+		return nil, nil
+	}
+
+	c := &compiledFilter{kind: f.Type}
+	switch f.Type {
+	case "pass_all", "block_all", "strip_value":
+	case "key_regex", "value_regex", "family_regex", "qualifier_regex":
+		re, err := regexp.Compile(f.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("%s filter: %v", f.Type, err)
+		}
+		c.re = re
+	case "json_field":
+		if f.Field == "" {
+			return nil, fmt.Errorf("json_field filter needs a field")
+		}
+		c.path, c.op = strings.Split(f.Field, "."), f.Op
+		switch f.Op {
+		case "exists":
+		case "eq", "ne", "lt", "lte", "gt", "gte":
+			if err := json.Unmarshal(f.Value, &c.operand); err != nil {
+				return nil, fmt.Errorf("json_field filter needs a JSON value: %v", err)
+			}
+		default:
+			return nil, fmt.Errorf("unknown json_field op: %s", f.Op)
+		}
+	case "timestamp_range":
+		if f.StartTimestamp < 0 || f.EndTimestamp < 0 {
+			return nil, fmt.Errorf("timestamp_range bounds must be positive")
+		}
+		c.start, c.end = f.StartTimestamp, f.EndTimestamp
+	case "cells_per_row_limit", "cells_per_row_offset", "cells_per_column_limit":
+		if f.Count < 0 {
+			return nil, fmt.Errorf("%s count must be positive", f.Type)
+		}
+		c.count = f.Count
+	case "chain", "interleave":
+		for i := range f.Filters {
+			child, err := f.Filters[i].compile()
+			if err != nil {
+				return nil, err
+			}
+			c.children = append(c.children, child)
+		}
+	default:
+		return nil, fmt.Errorf("unknown filter type: %s", f.Type)
+	}
+	return c, nil
+}
+
+// apply returns the cells of row that pass the filter. cells are in column
+// order with the newest version first, and so is the result.
+func (c *compiledFilter) apply(row []byte, cells []Cell) []Cell {
+	if c == nil || len(cells) == 0 {
+		return cells
+	}
+
+	switch c.kind {
+	case "pass_all":
+		return cells
+	case "block_all":
+		return nil
+	case "key_regex":
+		if c.re.Match(row) {
+			return cells
+		}
+		return nil
+	case "value_regex":
+		return keepCells(cells, func(cell Cell) bool { return c.re.MatchString(cell.Value) })
+	case "family_regex":
+		return keepCells(cells, func(cell Cell) bool { return c.re.MatchString(cell.Family) })
+	case "qualifier_regex":
+		return keepCells(cells, func(cell Cell) bool { return c.re.MatchString(cell.Qualifier) })
+	case "json_field":
+		return keepCells(cells, func(cell Cell) bool { return c.matchJSON(cell.Value) })
+	case "timestamp_range":
+		return keepCells(cells, func(cell Cell) bool {
+			return cell.Timestamp >= c.start && (c.end == 0 || cell.Timestamp < c.end)
+		})
+	case "cells_per_row_limit":
+		return cells[:min(c.count, len(cells))]
+	case "cells_per_row_offset":
+		return cells[min(c.count, len(cells)):]
+	case "cells_per_column_limit":
+		var seen int
+		return keepCellsIndexed(cells, func(i int, cell Cell) bool {
+			if i == 0 || cells[i-1].Family != cell.Family || cells[i-1].Qualifier != cell.Qualifier {
+				seen = 0
+			}
+			seen++
+			return seen <= c.count
+		})
+	case "strip_value":
+		stripped := make([]Cell, len(cells))
+		for i, cell := range cells {
+			cell.Value = ""
+			stripped[i] = cell
+		}
+		return stripped
+	case "chain":
+		for _, child := range c.children {
+			cells = child.apply(row, cells)
+		}
+		return cells
+	case "interleave":
+		// Like Bigtable, a cell that passes several branches shows up once
+		// per branch.
+		var merged []Cell
+		for _, child := range c.children {
+			merged = append(merged, child.apply(row, cells)...)
+		}
+		sort.SliceStable(merged, func(i, j int) bool {
+			a, b := merged[i], merged[j]
+			if a.Family != b.Family {
+				return a.Family < b.Family
+			}
+			if a.Qualifier != b.Qualifier {
+				return a.Qualifier < b.Qualifier
+			}
+			return a.Timestamp > b.Timestamp
+		})
+		return merged
+	}
+	return nil
+}
+
+// visible decodes the raw value of a flat entry and reports whether it is
+// live and passes the filter. The returned value may be stripped.
+func (c *compiledFilter) visible(key, raw []byte, now int64) ([]byte, bool, error) {
+	value, meta, err := decodeValue(raw)
+	if err != nil {
+		return nil, false, err
+	}
+	if isExpired(meta.expiresAt, now) {
+		return nil, false, nil
+	}
+	if c == nil {
+		return value, true, nil
+	}
+
+	cells := c.apply(key, []Cell{{Timestamp: meta.version, Value: string(value)}})
+	if len(cells) == 0 {
+		return nil, false, nil
+	}
+	return []byte(cells[0].Value), true, nil
+}
+
+func (c *compiledFilter) matchJSON(value string) bool {
+	doc, ok := lookupJSONField([]byte(value), c.path)
+	if !ok {
+		return false
+	}
+
+	switch c.op {
+	case "exists":
+		return true
+	case "eq":
+		return reflect.DeepEqual(doc, c.operand)
+	case "ne":
+		return !reflect.DeepEqual(doc, c.operand)
+	}
+
+	// Ordered comparisons need two numbers or two strings
+	var cmp int
+	switch a := doc.(type) {
+	case float64:
+		b, ok := c.operand.(float64)
+		if !ok {
+			return false
+		}
+		switch {
+		case a < b:
+			cmp = -1
+		case a > b:
+			cmp = 1
+		}
+	case string:
+		b, ok := c.operand.(string)
+		if !ok {
+			return false
+		}
+		cmp = strings.Compare(a, b)
+	default:
+		return false
+	}
+
+	switch c.op {
+	case "lt":
+		return cmp < 0
+	case "lte":
+		return cmp <= 0
+	case "gt":
+		return cmp > 0
+	case "gte":
+		return cmp >= 0
+	}
+	return false
+}
+
+// lookupJSONField decodes value and follows path through nested objects. An
+// empty path returns the whole document.
+func lookupJSONField(value []byte, path []string) (interface{}, bool) {
+	var doc interface{}
+	if err := json.Unmarshal(value, &doc); err != nil {
+		return nil, false
+	}
+	for _, name := range path {
+		object, ok := doc.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if doc, ok = object[name]; !ok {
+			return nil, false
+		}
+	}
+	return doc, true
+}
+
+func keepCells(cells []Cell, keep func(Cell) bool) []Cell {
+	return keepCellsIndexed(cells, func(_ int, cell Cell) bool { return keep(cell) })
+}
+
+func keepCellsIndexed(cells []Cell, keep func(int, Cell) bool) []Cell {
+	var kept []Cell
+	for i, cell := range cells {
+		if keep(i, cell) {
+			kept = append(kept, cell)
+		}
+	}
+	return kept
+}
@@ -0,0 +1,199 @@
+package kvstore
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/cockroachdb/pebble"
+)
+
+const gcInterval = time.Minute
+
+// GCRule decides which versions of a column are garbage. Exactly one field
+// should be set; Union and Intersection combine nested rules.
+type GCRule struct {
+	MaxVersions  int      `json:"maxVersions,omitempty"`
+	MaxAge       int64    `json:"maxAge,omitempty"` // seconds
+	Union        []GCRule `json:"union,omitempty"`
+	Intersection []GCRule `json:"intersection,omitempty"`
+}
+
+func (r *GCRule) Validate() error {
+	set := 0
+	if r.MaxVersions != 0 {
+		set++
+	}
+	if r.MaxAge != 0 {
+		set++
+	}
+	if r.Union != nil {
+		set++
+	}
+	if r.Intersection != nil {
+		set++
+	}
+	if set != 1 {
+		return fmt.Errorf("gc rule must set exactly one of maxVersions, maxAge, union or intersection")
+	}
+	if r.MaxVersions < 0 || r.MaxAge < 0 {
+		return fmt.Errorf("gc rule limits must be positive")
+	}
+	if (r.Union != nil && len(r.Union) == 0) || (r.Intersection != nil && len(r.Intersection) == 0) {
+		return fmt.Errorf("gc rule union and intersection need at least one nested rule")
+	}
+	for i := range r.Union {
+		if err := r.Union[i].Validate(); err != nil {
+			return err
+		}
+	}
+	for i := range r.Intersection {
+		if err := r.Intersection[i].Validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// isGarbage reports whether the version at position index (0 is the newest)
+// with the given timestamp can be dropped. Every rule is monotonic: once a
+// version is garbage, all older versions of the same column are too.
+func (r *GCRule) isGarbage(index int, timestamp, now int64) bool {
+	switch {
+	case r.MaxVersions > 0:
+		return index >= r.MaxVersions
+	case r.MaxAge > 0:
+		return timestamp < now-r.MaxAge*int64(time.Second/time.Microsecond)
+	case len(r.Union) > 0:
+		for i := range r.Union {
+			if r.Union[i].isGarbage(index, timestamp, now) {
+				return true
+			}
+		}
+		return false
+	case len(r.Intersection) > 0:
+		for i := range r.Intersection {
+			if !r.Intersection[i].isGarbage(index, timestamp, now) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+func (info *TableInfo) gcRule(family string) *GCRule {
+	if cf, ok := info.ColumnFamilies[family]; ok {
+		return cf.GCRule
+	}
+	return nil
+}
+
+func (info *TableInfo) hasGCRules() bool {
+	for _, cf := range info.ColumnFamilies {
+		if cf.GCRule != nil {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *KVStore) runGarbageCollector() {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(gcInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+			if n, err := s.CollectGarbage(); err != nil {
+				log.Printf("Garbage collection failed: %v", err)
+			} else if n > 0 {
+				log.Printf("Garbage collection removed versions from %d columns", n)
+			}
+		}
+	}
+}
+
+// CollectGarbage physically removes the versions hidden by the column family
+// GC rules and returns the number of columns it trimmed. Reads already skip
+// those versions, so this only reclaims space.
+func (s *KVStore) CollectGarbage() (int, error) {
+	tables, err := s.ListTables()
+	if err != nil {
+		return 0, err
+	}
+
+	total := 0
+	for i := range tables {
+		if !tables[i].hasGCRules() {
+			continue
+		}
+		n, err := s.collectTableGarbage(&tables[i])
+		if err != nil {
+			return total, fmt.Errorf("table %s: %v", tables[i].Name, err)
+		}
+		total += n
+	}
+	return total, nil
+}
+
+func (s *KVStore) collectTableGarbage(info *TableInfo) (int, error) {
+	prefix := tableKeyPrefix(info.Name)
+	iter, err := s.db.NewIter(&pebble.IterOptions{
+		LowerBound: prefix,
+		UpperBound: prefixEnd(prefix),
+	})
+	if err != nil {
+		return 0, err
+	}
+	defer iter.Close()
+
+	batch := s.db.NewBatch()
+	defer batch.Close()
+
+	now := nowMicros()
+	trimmed := 0
+	var column []byte
+	var index int
+
+	for valid := iter.First(); valid; {
+		key := iter.Key()
+		_, family, _, timestamp, err := decodeCellKey(info.Name, key)
+		if err != nil {
+			return 0, err
+		}
+
+		columnPrefix := key[:len(key)-8]
+		if !bytes.Equal(columnPrefix, column) {
+			column = append(column[:0], columnPrefix...)
+			index = 0
+		}
+
+		rule := info.gcRule(family)
+		if rule != nil && rule.isGarbage(index, timestamp, now) {
+			// Everything from here to the end of the column is garbage
+			end := prefixEnd(column)
+			if err := batch.DeleteRange(bytes.Clone(key), end, nil); err != nil {
+				return 0, err
+			}
+			trimmed++
+			valid = iter.SeekGE(end)
+			continue
+		}
+		index++
+		valid = iter.Next()
+	}
+	if err := iter.Error(); err != nil {
+		return 0, err
+	}
+
+	if trimmed == 0 {
+		return 0, nil
+	}
+	return trimmed, batch.Commit(pebble.Sync)
+}
@@ -0,0 +1,113 @@
+package kvstore
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/cockroachdb/pebble"
+)
+
+// groupSyncer makes committed batches durable with as few WAL fsyncs as
+// possible. Writers commit their batch without syncing and then call sync:
+// the first caller becomes the leader and syncs the WAL on behalf of every
+// batch committed before it started, while later callers wait for that sync
+// or lead the next one. Under concurrency one fsync covers many writes.
+//
+// A write is visible to readers as soon as it is committed, slightly before
+// it is durable; it is only acknowledged to its writer once durable.
+type groupSyncer struct {
+	db *pebble.DB
+
+	mu        sync.Mutex
+	cond      *sync.Cond
+	requested uint64 // tickets handed out
+	synced    uint64 // every ticket up to this one is durable
+	syncing   bool
+	err       error // a failed WAL sync is not retried
+
+	timer   *time.Timer    // pending sync of group-sync writes
+	pending sync.WaitGroup // timers not yet run
+}
+
+func newGroupSyncer(db *pebble.DB) *groupSyncer {
+	g := &groupSyncer{db: db}
+	g.cond = sync.NewCond(&g.mu)
+	return g
+}
+
+// sync returns once everything committed before the call is durable.
+func (g *groupSyncer) sync() error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.requested++
+	ticket := g.requested
+	for g.synced < ticket && g.err == nil {
+		if g.syncing {
+			g.cond.Wait()
+			continue
+		}
+
+		g.syncing = true
+		target := g.requested
+		g.mu.Unlock()
+		// An empty log record with Sync flushes and fsyncs the WAL up to and
+		// including every batch committed before it.
+		err := g.db.LogData(nil, pebble.Sync)
+		g.mu.Lock()
+		g.syncing = false
+		if err != nil {
+			g.err = fmt.Errorf("WAL sync failed: %w", err)
+		} else {
+			g.synced = target
+		}
+		g.cond.Broadcast()
+	}
+	if g.synced >= ticket {
+		return nil
+	}
+	return g.err
+}
+
+// syncWithin returns once everything committed before the call is durable,
+// letting the sync wait up to window so later writes can share it. A sync
+// requested in between, by any writer, ends the wait early.
+func (g *groupSyncer) syncWithin(window time.Duration) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.requested++
+	ticket := g.requested
+	if g.timer == nil {
+		g.pending.Add(1)
+		g.timer = time.AfterFunc(window, g.flush)
+	}
+	for g.synced < ticket && g.err == nil {
+		g.cond.Wait()
+	}
+	if g.synced >= ticket {
+		return nil
+	}
+	return g.err
+}
+
+func (g *groupSyncer) flush() {
+	defer g.pending.Done()
+	g.mu.Lock()
+	g.timer = nil
+	g.mu.Unlock()
+	g.sync()
+}
+
+// close runs the pending group sync at once; the database must stay open
+// until it returns.
+func (g *groupSyncer) close() {
+	g.mu.Lock()
+	timer := g.timer
+	g.mu.Unlock()
+	if timer != nil && timer.Stop() {
+		g.flush()
+	}
+	g.pending.Wait()
+}
@@ -2,8 +2,14 @@ package kvstore
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/cockroachdb/pebble"
 )
@@ -11,13 +17,35 @@ import (
 
 type KVStore struct{
 	db *pebble.DB
+
+	lastVersion   atomic.Int64
+	syncer        *groupSyncer
+	writeDefaults atomic.Pointer[WriteOptions]
+	snapshots     *snapshotRegistry
+	txns          *txnRegistry
+	counters      *prefixCounters
+	changes       *changeLog
+	streams       streamRegistry
+
+	changeRetention atomic.Int64 // time.Duration
+	keyLocker       atomic.Pointer[func(keys ...string) func()]
+
+	stop chan struct{}
+	wg   sync.WaitGroup
 }
 
 
+// ErrInvalidOperation means a write operation, its value or its condition is
+// malformed or does not fit the stored value.
+var ErrInvalidOperation = errors.New("invalid operation")
+
 type BatchOperation struct {
-    Type  string      `json:"type"`  // "set" or "delete"
-    Key   string      `json:"key"`
-    Value interface{} `json:"value,omitempty"`  // omitempty를 사용하여 delete 작업 시 생략 가능
+    Type     string      `json:"type"`  // "set", "delete", "increment", "append", "delete_prefix" or "delete_range"
+    Key      string      `json:"key"`     // the prefix or start key for delete_prefix and delete_range
+    EndKey   string      `json:"endKey,omitempty"` // delete_range only, exclusive
+    Value    interface{} `json:"value,omitempty"`  // omitempty를 사용하여 delete 작업 시 생략 가능
+    TTL      int64       `json:"ttl,omitempty"`    // seconds, set only
+    Encoding string      `json:"encoding,omitempty"` // increment/append only
 }
 
 func NewKVStore(database string) (*KVStore, error) {
@@ -27,7 +55,34 @@ func NewKVStore(database string) (*KVStore, error) {
 	if err != nil {
 		return nil, err
 	}
-	return &KVStore{db: db}, nil
+	counters, err := loadPrefixCounters(db)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	changes, err := loadChangeLog(db)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	s := &KVStore{
+		db:        db,
+		syncer:    newGroupSyncer(db),
+		snapshots: newSnapshotRegistry(),
+		txns:      newTxnRegistry(),
+		counters:  counters,
+		changes:   changes,
+		stop:      make(chan struct{}),
+	}
+	s.SetDefaultWriteOptions(WriteOptions{})
+	s.SetChangeRetention(DefaultChangeRetention)
+	s.wg.Add(4)
+	go s.runGarbageCollector()
+	go s.runReaper()
+	go s.runSnapshotJanitor()
+	go s.runChangeTrimmer()
+	return s, nil
 }
 
 
@@ -48,75 +103,340 @@ func (s *KVStore) convertToString(value interface{}) (string, error) {
 }
 
 func (s *KVStore) Set(key string, value string) error {
-	return s.db.Set([]byte(key), []byte(value), pebble.Sync)
+	return s.SetWithTTL(key, value, 0)
+}
+
+func (s *KVStore) SetWithTTL(key string, value string, ttl time.Duration) error {
+	return s.SetWithOptions(key, value, ttl, WriteOptions{})
+}
+
+func (s *KVStore) SetWithOptions(key string, value string, ttl time.Duration, opts WriteOptions) error {
+	batch := s.db.NewBatch()
+	defer batch.Close()
+
+	if err := s.setInBatch(batch, key, value, expiresAtFor(ttl)); err != nil {
+		return err
+	}
+	return s.commitWith(batch, opts)
 }
 
 func (s *KVStore) BatchOperation(operations []BatchOperation) error {
-    batch := s.db.NewBatch()
+    _, err := s.BatchOperationWithResults(operations)
+    return err
+}
+
+// BatchOperationWithResults returns one entry per operation: the new value
+// for increment and append operations and "" for the others.
+func (s *KVStore) BatchOperationWithResults(operations []BatchOperation) ([]string, error) {
+    return s.BatchOperationWithOptions(operations, WriteOptions{})
+}
+
+func (s *KVStore) BatchOperationWithOptions(operations []BatchOperation, opts WriteOptions) ([]string, error) {
+    var batch *pebble.Batch
+    if hasReadModifyWrite(operations) {
+        batch = s.db.NewIndexedBatch()
+    } else {
+        batch = s.db.NewBatch()
+    }
     defer batch.Close()
 
+    results, err := s.applyOperations(batch, operations)
+    if err != nil {
+        return nil, err
+    }
+    return results, s.commitWith(batch, opts)
+}
+
+func hasReadModifyWrite(operations []BatchOperation) bool {
     for _, op := range operations {
+        if op.Type == "increment" || op.Type == "append" {
+            return true
+        }
+    }
+    return false
+}
+
+// applyOperations needs an indexed batch when operations contain increments
+// or appends, so they observe earlier writes of the same batch.
+func (s *KVStore) applyOperations(batch *pebble.Batch, operations []BatchOperation) ([]string, error) {
+    results := make([]string, len(operations))
+    for i, op := range operations {
         switch op.Type {
         case "set":
             valueStr, err := s.convertToString(op.Value)
             if err != nil {
-                return fmt.Errorf("failed to convert value for key %s: %v", op.Key, err)
+                return nil, fmt.Errorf("%w: failed to convert value for key %s: %v", ErrInvalidOperation, op.Key, err)
+            }
+            if op.TTL < 0 {
+                return nil, fmt.Errorf("%w: invalid ttl for key %s: %d", ErrInvalidOperation, op.Key, op.TTL)
             }
-            if err := batch.Set([]byte(op.Key), []byte(valueStr), pebble.Sync); err != nil {
-                return err
+            expiresAt := expiresAtFor(time.Duration(op.TTL) * time.Second)
+            if err := s.setInBatch(batch, op.Key, valueStr, expiresAt); err != nil {
+                return nil, err
             }
         case "delete":
+            if err := checkKey(op.Key); err != nil {
+                return nil, err
+            }
             if err := batch.Delete([]byte(op.Key), pebble.Sync); err != nil {
-                return err
+                return nil, err
+            }
+        case "delete_prefix", "delete_range":
+            lower, upper, err := deletePrefixBounds(op.Key)
+            if op.Type == "delete_range" {
+                lower, upper, err = deleteRangeBounds(op.Key, op.EndKey)
+            }
+            if err != nil {
+                return nil, err
+            }
+            if err := batch.DeleteRange(lower, upper, nil); err != nil {
+                return nil, err
             }
+        case "increment":
+            deltaStr, err := s.convertToString(op.Value)
+            if err != nil {
+                return nil, fmt.Errorf("%w: failed to convert delta for key %s: %v", ErrInvalidOperation, op.Key, err)
+            }
+            delta, err := strconv.ParseInt(deltaStr, 10, 64)
+            if err != nil {
+                return nil, fmt.Errorf("%w: delta for key %s is not an integer: %q", ErrInvalidOperation, op.Key, deltaStr)
+            }
+            value, err := s.incrementInBatch(batch, op.Key, delta, op.Encoding)
+            if err != nil {
+                return nil, err
+            }
+            results[i] = strconv.FormatInt(value, 10)
+        case "append":
+            suffix, err := s.convertToString(op.Value)
+            if err != nil {
+                return nil, fmt.Errorf("%w: failed to convert value for key %s: %v", ErrInvalidOperation, op.Key, err)
+            }
+            value, err := s.appendInBatch(batch, op.Key, suffix, op.Encoding)
+            if err != nil {
+                return nil, err
+            }
+            results[i] = value
         default:
-            return fmt.Errorf("unknown operation type: %s", op.Type)
+            return nil, fmt.Errorf("%w: unknown operation type: %q", ErrInvalidOperation, op.Type)
         }
     }
-    return batch.Commit(pebble.Sync)
+    return results, nil
 }
 
 func (s *KVStore) Get(key string) (string, error) {
-	value, closer, err := s.db.Get([]byte(key))
+	value, _, err := s.GetWithVersion(key)
+	return value, err
+}
+
+// GetWithVersion returns the value together with the version that
+// version_equals conditions compare against.
+func (s *KVStore) GetWithVersion(key string) (string, int64, error) {
+	value, meta, found, err := readLive(s.db, key)
 	if err != nil {
-		return "", err
+		return "", 0, err
+	}
+	if !found {
+		return "", 0, pebble.ErrNotFound
+	}
+	return string(value), meta.version, nil
+}
+
+// TTL returns how long key has left to live, or 0 when it never expires.
+func (s *KVStore) TTL(key string) (time.Duration, error) {
+	_, meta, found, err := readLive(s.db, key)
+	if err != nil {
+		return 0, err
+	}
+	if !found {
+		return 0, pebble.ErrNotFound
+	}
+	if meta.expiresAt == 0 {
+		return 0, nil
+	}
+	return time.Until(time.UnixMilli(meta.expiresAt)), nil
+}
+
+type MultiGetResult struct {
+	Key   string `json:"key"`
+	Value string `json:"value,omitempty"`
+	Found bool   `json:"found"`
+}
+
+// MultiGet reads all keys from one snapshot. Missing or expired keys are
+// reported with Found set to false instead of failing the whole call.
+func (s *KVStore) MultiGet(keys []string) ([]MultiGetResult, error) {
+	snap := s.db.NewSnapshot()
+	defer snap.Close()
+
+	results := make([]MultiGetResult, len(keys))
+	for i, key := range keys {
+		value, _, found, err := readLive(snap, key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read key %s: %w", key, err)
+		}
+		results[i] = MultiGetResult{Key: key, Value: string(value), Found: found}
 	}
-	defer closer.Close()
-	return string(value), nil
+	return results, nil
 }
 
-func (s *KVStore) RangeQuery(startKey, endKey string) (map[string]string,error){
-	iter,err := s.db.NewIter(&pebble.IterOptions{
-		LowerBound: []byte(startKey),
-		UpperBound: []byte(endKey),
+type KeyValue struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+// RangeOptions selects the keys of a RangeQuery. An empty StartKey or EndKey
+// leaves that side of the range open; the range is [StartKey, EndKey) unless
+// the exclusive/inclusive flags say otherwise.
+type RangeOptions struct {
+	StartKey       string
+	EndKey         string
+	StartExclusive bool
+	EndInclusive   bool
+	Limit          int    // 0 returns every key in the range
+	Cursor         string // nextCursor of the previous page
+	Reverse        bool
+	Filter         *Filter // nil passes every key
+}
+
+// rangeBounds turns the options into iterator bounds. Open ranges never
+// reach into the internal keyspace.
+func (o RangeOptions) rangeBounds() ([]byte, []byte) {
+	lower := []byte(o.StartKey)
+	if o.StartExclusive {
+		lower = append(lower, 0)
+	}
+	if len(lower) == 0 || lower[0] == internalPrefix[0] {
+		lower = prefixEnd([]byte(internalPrefix))
+	}
+
+	var upper []byte
+	if o.EndKey != "" {
+		upper = []byte(o.EndKey)
+		if o.EndInclusive {
+			upper = append(upper, 0)
+		}
+	}
+	return lower, upper
+}
+
+// RangeQuery returns the live keys of the range in key order, or in descending
+// order when Reverse is set, along with the cursor of the next page.
+func (s *KVStore) RangeQuery(opts RangeOptions) ([]KeyValue, string, error){
+	result := []KeyValue{}
+	nextCursor, err := scanRange(context.Background(), s.db, opts, func(key, value []byte) error {
+		result = append(result, KeyValue{Key: string(key), Value: string(value)})
+		return nil
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	return result, nextCursor, nil
+}
+
+// scanRange calls emit for every live key of the range, up to opts.Limit, and
+// returns the cursor of the next page. key and value are only valid during
+// the call. ctx is checked every streamCheckEvery visited entries, matching
+// or not.
+func scanRange(ctx context.Context, r pebble.Reader, opts RangeOptions, emit func(key, value []byte) error) (string, error) {
+	rf, err := opts.Filter.compile()
+	if err != nil {
+		return "", err
+	}
+
+	lower, upper := opts.rangeBounds()
+	if upper != nil && bytes.Compare(lower, upper) >= 0 {
+		return "", nil
+	}
+
+	iter,err := r.NewIter(&pebble.IterOptions{
+		LowerBound: lower,
+		UpperBound: upper,
 	})
 
 	if err!=nil{
-		return nil, err
+		return "", err
 	}
 
 	defer iter.Close()
 
-	result := make(map[string]string)
+	now := time.Now().UnixMilli()
 
-	for iter.First(); iter.Valid();iter.Next(){
-		key := string(iter.Key())
-		value := string(iter.Value())
-		result[key] = value
+	emitted, visited := 0, 0
+	advance := seekScanStart(iter, string(lower), opts.Cursor, opts.Reverse)
+	for iter.Valid() && (opts.Limit <= 0 || emitted < opts.Limit) {
+		visited++
+		if visited%streamCheckEvery == 0 {
+			if err := ctx.Err(); err != nil {
+				return "", err
+			}
+		}
+		value, live, err := rf.visible(iter.Key(), iter.Value(), now)
+		if err != nil {
+			return "", err
+		}
+		if live {
+			if err := emit(iter.Key(), value); err != nil {
+				return "", err
+			}
+			emitted++
+		}
+		advance()
+	}
+
+	var nextCursor string
+	if iter.Valid() {
+		nextCursor = string(iter.Key())
 	}
 
 	if err := iter.Error();err != nil{
-		return nil,err
+		return "", err
 	}
-	
-	return result, nil
 
+	return nextCursor, nil
 }
 
-func (s *KVStore) ScanKey(prefix string, cursor string, limit int) ([]string, string, error) {
-	iter,err := s.db.NewIter(&pebble.IterOptions{
-		LowerBound: []byte(prefix),
-	})
+// prefixIterOptions bounds an iterator to the flat keys starting with prefix.
+func prefixIterOptions(prefix string) *pebble.IterOptions {
+	lower, upper := flatPrefixBounds(prefix)
+	return &pebble.IterOptions{LowerBound: lower, UpperBound: upper}
+}
+
+// seekScanStart positions iter at cursor, which is the first key of the next
+// page in either direction, or at the first key of the scan. It returns the
+// function that moves to the following key.
+func seekScanStart(iter *pebble.Iterator, prefix, cursor string, reverse bool) func() bool {
+	if !reverse {
+		if cursor != "" {
+			iter.SeekGE([]byte(cursor))
+		} else {
+			iter.SeekGE([]byte(prefix))
+		}
+		return iter.Next
+	}
+
+	if cursor != "" {
+		// SeekLE(cursor)
+		iter.SeekLT(append([]byte(cursor), 0))
+	} else {
+		iter.Last()
+	}
+	return iter.Prev
+}
+
+func (s *KVStore) ScanKey(prefix string, cursor string, limit int, reverse bool, filter *Filter) ([]string, string, error) {
+	return scanKey(s.db, prefix, cursor, limit, reverse, filter)
+}
+
+func scanKey(r pebble.Reader, prefix string, cursor string, limit int, reverse bool, filter *Filter) ([]string, string, error) {
+	if err := checkKey(prefix); err != nil {
+		return nil, "", err
+	}
+	rf, err := filter.compile()
+	if err != nil {
+		return nil, "", err
+	}
+
+	iter,err := r.NewIter(prefixIterOptions(prefix))
 
 	if err != nil {
 		return nil, "", err
@@ -127,19 +447,21 @@ func (s *KVStore) ScanKey(prefix string, cursor string, limit int) ([]string, st
 	var keys []string
 	var nextCursor string
 
-	if cursor != "" {
-		iter.SeekGE([]byte(cursor))
-	} else {
-		iter.SeekGE([]byte(prefix))
-	}
+	advance := seekScanStart(iter, prefix, cursor, reverse)
 
-	for i := 0; i < limit && iter.Valid(); i++ {
+	now := time.Now().UnixMilli()
+	for i := 0; i < limit && iter.Valid(); advance() {
 		key := iter.Key()
 		if !bytes.HasPrefix(key, []byte(prefix)) {
 			break
 		}
+		if _, live, err := rf.visible(key, iter.Value(), now); err != nil {
+			return nil, "", err
+		} else if !live {
+			continue
+		}
 		keys = append(keys, string(key))
-		iter.Next()
+		i++
 	}
 
 	if iter.Valid() && bytes.HasPrefix(iter.Key(), []byte(prefix)) {
@@ -155,12 +477,13 @@ func (s *KVStore) ScanKey(prefix string, cursor string, limit int) ([]string, st
 
 
 func (s *KVStore) ScanOffset(prefix string, offset int) (string, error) {
+	if err := checkKey(prefix); err != nil {
+		return "", err
+	}
 	if offset==0{
 		return "", nil
 	}
-    iter, err := s.db.NewIter(&pebble.IterOptions{
-        LowerBound: []byte(prefix),
-    })
+    iter, err := s.db.NewIter(prefixIterOptions(prefix))
     if err != nil {
         return "", fmt.Errorf("failed to create iterator: %v", err)
     }
@@ -168,14 +491,28 @@ func (s *KVStore) ScanOffset(prefix string, offset int) (string, error) {
 
     iter.SeekGE([]byte(prefix))
 
-    for i := 0; i < offset && iter.Valid(); i++ {
+    now := time.Now().UnixMilli()
+    for i := 0; i < offset && iter.Valid(); iter.Next() {
         if !bytes.HasPrefix(iter.Key(), []byte(prefix)) {
             return "", nil // offset이 전체 결과 수를 초과하면 빈 문자열 반환
         }
+        if _, live, err := liveValue(iter.Value(), now); err != nil {
+            return "", err
+        } else if live {
+            i++
+        }
+    }
+    // 만료된 키는 커서로 돌려주지 않는다
+    for iter.Valid() && bytes.HasPrefix(iter.Key(), []byte(prefix)) {
+        if _, live, err := liveValue(iter.Value(), now); err != nil {
+            return "", err
+        } else if live {
+            break
+        }
         iter.Next()
     }
 
-    if !iter.Valid() {
+    if !iter.Valid() || !bytes.HasPrefix(iter.Key(), []byte(prefix)) {
         return "", nil
     }
 
@@ -183,35 +520,25 @@ func (s *KVStore) ScanOffset(prefix string, offset int) (string, error) {
 }
 
 func (s *KVStore) TotalKey(prefix string) (int,error){
-	iter, err := s.db.NewIter(&pebble.IterOptions{
-		LowerBound: []byte(prefix),
-	})
-	if err != nil{
-		return 0, err
-	}
-	defer iter.Close()
-
-	iter.SeekGE([]byte(prefix))
-	var cnt int
-    for iter.SeekGE([]byte(prefix)); iter.Valid(); iter.Next() {
-        if !bytes.HasPrefix(iter.Key(), []byte(prefix)) {
-            break
-        }
-        cnt++
-    }
+	count, _, err := s.CountKeys(prefix, 0)
+	return count, err
+}
 
-	if err := iter.Error(); err != nil {
-        return 0, err
-    }
 
-	return cnt,nil
+func (s *KVStore) ScanValueByKey(prefix string, cursor string, limit int, reverse bool, filter *Filter)([]map[string]string, string, error){
+    return scanValueByKey(s.db, prefix, cursor, limit, reverse, filter)
 }
 
+func scanValueByKey(r pebble.Reader, prefix string, cursor string, limit int, reverse bool, filter *Filter)([]map[string]string, string, error){
+    if err := checkKey(prefix); err != nil {
+        return nil, "", err
+    }
+    rf, err := filter.compile()
+    if err != nil {
+        return nil, "", err
+    }
 
-func (s *KVStore) ScanValueByKey(prefix string, cursor string, limit int)([]map[string]string, string, error){
-    iter, err := s.db.NewIter(&pebble.IterOptions{
-        LowerBound: []byte(prefix),
-    })
+    iter, err := r.NewIter(prefixIterOptions(prefix))
     if err != nil {
         return nil, "", fmt.Errorf("failed to create iterator: %v", err)
     }
@@ -221,27 +548,30 @@ func (s *KVStore) ScanValueByKey(prefix string, cursor string, limit int)([]map[
     var nextCursor string
 
     // 커서가 제공되면 해당 위치부터 시작
-    if cursor != "" {
-        iter.SeekGE([]byte(cursor))
-    } else {
-        iter.SeekGE([]byte(prefix))
-    }
+    advance := seekScanStart(iter, prefix, cursor, reverse)
 
-    for i := 0; i < limit && iter.Valid(); i++ {
+    now := time.Now().UnixMilli()
+    for i := 0; i < limit && iter.Valid(); advance() {
         key := iter.Key()
-        value := iter.Value()
 
         // prefix로 시작하지 않는 키를 만나면 종료
         if !bytes.HasPrefix(key, []byte(prefix)) {
             break
         }
 
+        value, live, err := rf.visible(key, iter.Value(), now)
+        if err != nil {
+            return nil, "", err
+        }
+        if !live {
+            continue
+        }
+
         results = append(results, map[string]string{
             "key":   string(key),
             "value": string(value),
         })
-
-        iter.Next()
+        i++
     }
 
     // 다음 페이지의 커서 설정
@@ -258,9 +588,14 @@ func (s *KVStore) ScanValueByKey(prefix string, cursor string, limit int)([]map[
 
 
 func (s *KVStore) ScanKeysLower(prefix string, maxTimestamp int64, cursor string, limit int) ([]string, string, error) {
-	iter, err := s.db.NewIter(&pebble.IterOptions{
-		LowerBound: []byte(prefix),
-	})
+	return scanKeysLower(s.db, prefix, maxTimestamp, cursor, limit)
+}
+
+func scanKeysLower(r pebble.Reader, prefix string, maxTimestamp int64, cursor string, limit int) ([]string, string, error) {
+	if err := checkKey(prefix); err != nil {
+		return nil, "", err
+	}
+	iter, err := r.NewIter(prefixIterOptions(prefix))
 	if err != nil {
 		return nil, "", err
 	}
@@ -275,14 +610,22 @@ func (s *KVStore) ScanKeysLower(prefix string, maxTimestamp int64, cursor string
 		iter.SeekGE([]byte(prefix))
 	}
 
-	for i := 0; i < limit && iter.Valid(); i++ {
+	now := time.Now().UnixMilli()
+	for len(keys) < limit && iter.Valid() {
 		key := iter.Key()
 		if !bytes.HasPrefix(key, []byte(prefix)) {
 			break
 		}
+		if _, live, err := liveValue(iter.Value(), now); err != nil {
+			return nil, "", err
+		} else if !live {
+			iter.Next()
+			continue
+		}
 
+		var name string
 		var timestamp int64
-		_, err := fmt.Sscanf(string(key), "%s%d:", &prefix, &timestamp)
+		_, err := fmt.Sscanf(string(key), "%s%d:", &name, &timestamp)
 		if err != nil {
 			iter.Next()
 			continue // Skip keys that don't match the expected format
@@ -310,12 +653,32 @@ func (s *KVStore) ScanKeysLower(prefix string, maxTimestamp int64, cursor string
 
 
 func (s *KVStore) Delete(key string) error {
-	return s.db.Delete([]byte(key), pebble.Sync)
+	return s.DeleteWithOptions(key, WriteOptions{})
+}
+
+func (s *KVStore) DeleteWithOptions(key string, opts WriteOptions) error {
+	if err := checkKey(key); err != nil {
+		return err
+	}
+	batch := s.db.NewBatch()
+	defer batch.Close()
+
+	if err := batch.Delete([]byte(key), nil); err != nil {
+		return err
+	}
+	return s.commitWith(batch, opts)
 }
 
 
 
 
 func (s *KVStore) Close() error {
+	close(s.stop)
+	s.wg.Wait()
+	s.changes.close()
+	s.streams.close()
+	s.snapshots.releaseAll()
+	s.txns.finishAll()
+	s.syncer.close()
 	return s.db.Close()
 }
@@ -0,0 +1,153 @@
+package kvstore
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Keys starting with 0x00 are reserved for internal data (catalog, table
+// cells, ...). The flat key/value API rejects them with ErrReservedKey.
+const (
+	internalPrefix = "\x00"
+	catalogPrefix  = "\x00c"
+	tablePrefix    = "\x00t"
+)
+
+var ErrReservedKey = errors.New("keys starting with 0x00 are reserved")
+
+// checkKey rejects a flat key, prefix or range start inside the internal
+// keyspace.
+func checkKey(key string) error {
+	if strings.HasPrefix(key, internalPrefix) {
+		return fmt.Errorf("%w: %q", ErrReservedKey, key)
+	}
+	return nil
+}
+
+// flatPrefixBounds returns the iterator bounds of the flat keys starting with
+// prefix. The empty prefix covers every flat key and no internal one.
+func flatPrefixBounds(prefix string) ([]byte, []byte) {
+	if prefix == "" {
+		return prefixEnd([]byte(internalPrefix)), nil
+	}
+	return []byte(prefix), prefixEnd([]byte(prefix))
+}
+
+const (
+	escapeByte    = 0x00
+	escapedZero   = 0xff
+	separatorByte = 0x01
+)
+
+// appendEscaped writes s so that the encoded components sort the same way as
+// the raw strings: 0x00 becomes 0x00 0xff and every component ends with 0x00 0x01.
+func appendEscaped(dst []byte, s string) []byte {
+	for i := 0; i < len(s); i++ {
+		if s[i] == escapeByte {
+			dst = append(dst, escapeByte, escapedZero)
+			continue
+		}
+		dst = append(dst, s[i])
+	}
+	return append(dst, escapeByte, separatorByte)
+}
+
+func decodeEscaped(b []byte) (string, []byte, error) {
+	var out []byte
+	for i := 0; i < len(b); i++ {
+		if b[i] != escapeByte {
+			out = append(out, b[i])
+			continue
+		}
+		if i+1 >= len(b) {
+			return "", nil, fmt.Errorf("truncated key component")
+		}
+		switch b[i+1] {
+		case escapedZero:
+			out = append(out, escapeByte)
+			i++
+		case separatorByte:
+			return string(out), b[i+2:], nil
+		default:
+			return "", nil, fmt.Errorf("invalid escape sequence in key")
+		}
+	}
+	return "", nil, fmt.Errorf("unterminated key component")
+}
+
+func catalogKey(table string) []byte {
+	return append([]byte(catalogPrefix), table...)
+}
+
+func tableKeyPrefix(table string) []byte {
+	return appendEscaped([]byte(tablePrefix), table)
+}
+
+func rowKeyPrefix(table, row string) []byte {
+	return appendEscaped(tableKeyPrefix(table), row)
+}
+
+// rowRangePrefix is the key prefix shared by every row whose key starts with
+// prefix: the escaped prefix without its terminator.
+func rowRangePrefix(table, prefix string) []byte {
+	key := rowKeyPrefix(table, prefix)
+	return key[:len(key)-2]
+}
+
+func familyKeyPrefix(table, row, family string) []byte {
+	return appendEscaped(rowKeyPrefix(table, row), family)
+}
+
+func columnKeyPrefix(table, row, family, qualifier string) []byte {
+	return appendEscaped(familyKeyPrefix(table, row, family), qualifier)
+}
+
+// cellKey appends the inverted timestamp so that the newest version of a
+// column sorts first.
+func cellKey(table, row, family, qualifier string, timestamp int64) []byte {
+	return binary.BigEndian.AppendUint64(columnKeyPrefix(table, row, family, qualifier), ^uint64(timestamp))
+}
+
+// decodeCellKey splits a key produced by cellKey. The table name is not
+// returned because callers always iterate inside a single table.
+func decodeCellKey(table string, key []byte) (row, family, qualifier string, timestamp int64, err error) {
+	prefix := tableKeyPrefix(table)
+	if !bytes.HasPrefix(key, prefix) {
+		return "", "", "", 0, fmt.Errorf("key does not belong to table %s", table)
+	}
+	rest := key[len(prefix):]
+	if row, rest, err = decodeEscaped(rest); err != nil {
+		return "", "", "", 0, err
+	}
+	if family, rest, err = decodeEscaped(rest); err != nil {
+		return "", "", "", 0, err
+	}
+	if qualifier, rest, err = decodeEscaped(rest); err != nil {
+		return "", "", "", 0, err
+	}
+	if len(rest) != 8 {
+		return "", "", "", 0, fmt.Errorf("invalid cell timestamp")
+	}
+	return row, family, qualifier, int64(^binary.BigEndian.Uint64(rest)), nil
+}
+
+// prefixEnd returns the smallest key greater than every key starting with prefix.
+func prefixEnd(prefix []byte) []byte {
+	end := append([]byte(nil), prefix...)
+	for i := len(end) - 1; i >= 0; i-- {
+		end[i]++
+		if end[i] != 0 {
+			return end[:i+1]
+		}
+	}
+	return nil
+}
+
+// PrefixEnd is the string form of prefixEnd. It returns "" when no upper
+// bound exists, which the range APIs treat as an open end.
+func PrefixEnd(prefix string) string {
+	return string(prefixEnd([]byte(prefix)))
+}
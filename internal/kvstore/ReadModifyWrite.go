@@ -0,0 +1,216 @@
+package kvstore
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/cockroachdb/pebble"
+)
+
+// Value encodings understood by Increment and Append.
+const (
+	EncodingJSON   = "json"   // JSON numbers and strings, as written by the REST API
+	EncodingBinary = "binary" // 8-byte big-endian int64 and raw bytes
+)
+
+// Increment adds delta to the counter stored at key, creating it at 0 when
+// missing, and returns the new value. The key keeps its TTL. Callers must
+// serialize it with other writers of key; KVNode does.
+func (s *KVStore) Increment(key string, delta int64, encoding string) (int64, error) {
+	batch := s.db.NewIndexedBatch()
+	defer batch.Close()
+
+	result, err := s.incrementInBatch(batch, key, delta, encoding)
+	if err != nil {
+		return 0, err
+	}
+	if err := s.commit(batch); err != nil {
+		return 0, err
+	}
+	return result, nil
+}
+
+// Append adds suffix to the value stored at key and returns the new value.
+// With EncodingJSON the stored value must be a JSON string and the suffix is
+// appended to its contents.
+func (s *KVStore) Append(key string, suffix string, encoding string) (string, error) {
+	batch := s.db.NewIndexedBatch()
+	defer batch.Close()
+
+	result, err := s.appendInBatch(batch, key, suffix, encoding)
+	if err != nil {
+		return "", err
+	}
+	if err := s.commit(batch); err != nil {
+		return "", err
+	}
+	return result, nil
+}
+
+func (s *KVStore) incrementInBatch(batch *pebble.Batch, key string, delta int64, encoding string) (int64, error) {
+	value, meta, exists, err := readLive(batch, key)
+	if err != nil {
+		return 0, err
+	}
+
+	var current int64
+	if exists {
+		switch encoding {
+		case EncodingBinary:
+			if len(value) != 8 {
+				return 0, fmt.Errorf("%w: value of %s is not an 8-byte counter", ErrInvalidOperation, key)
+			}
+			current = int64(binary.BigEndian.Uint64(value))
+		case "", EncodingJSON:
+			current, err = strconv.ParseInt(strings.TrimSpace(string(value)), 10, 64)
+			if err != nil {
+				return 0, fmt.Errorf("%w: value of %s is not an integer", ErrInvalidOperation, key)
+			}
+		default:
+			return 0, fmt.Errorf("%w: unknown encoding: %s", ErrInvalidOperation, encoding)
+		}
+	}
+
+	next := current + delta
+	if (delta > 0 && next < current) || (delta < 0 && next > current) {
+		return 0, fmt.Errorf("%w: increment of %s overflows int64", ErrInvalidOperation, key)
+	}
+
+	var encoded string
+	if encoding == EncodingBinary {
+		encoded = string(binary.BigEndian.AppendUint64(nil, uint64(next)))
+	} else {
+		encoded = strconv.FormatInt(next, 10)
+	}
+	if err := s.setInBatch(batch, key, encoded, meta.expiresAt); err != nil {
+		return 0, err
+	}
+	return next, nil
+}
+
+func (s *KVStore) appendInBatch(batch *pebble.Batch, key string, suffix string, encoding string) (string, error) {
+	value, meta, exists, err := readLive(batch, key)
+	if err != nil {
+		return "", err
+	}
+
+	var result, encoded string
+	switch encoding {
+	case EncodingBinary:
+		result = string(value) + suffix
+		encoded = result
+	case "", EncodingJSON:
+		var current string
+		if exists {
+			if err := json.Unmarshal(value, &current); err != nil {
+				return "", fmt.Errorf("%w: value of %s is not a JSON string", ErrInvalidOperation, key)
+			}
+		}
+		result = current + suffix
+		data, err := json.Marshal(result)
+		if err != nil {
+			return "", err
+		}
+		encoded = string(data)
+	default:
+		return "", fmt.Errorf("%w: unknown encoding: %s", ErrInvalidOperation, encoding)
+	}
+
+	if err := s.setInBatch(batch, key, encoded, meta.expiresAt); err != nil {
+		return "", err
+	}
+	return result, nil
+}
+
+// ReadModifyWriteRule changes the newest cell of one table column.
+// Increments treat the cell as an 8-byte big-endian int64, like Bigtable.
+type ReadModifyWriteRule struct {
+	Type      string `json:"type"` // "append" or "increment"
+	Family    string `json:"family"`
+	Qualifier string `json:"qualifier"`
+	Value     string `json:"value,omitempty"` // append only
+	Delta     int64  `json:"delta,omitempty"` // increment only
+}
+
+// ReadModifyWriteRow applies rules in order to the newest version of their
+// columns and writes the results as new versions. Later rules see the
+// results of earlier ones. It returns the written cells. Callers must
+// serialize it with other writers of the table; KVNode does.
+func (s *KVStore) ReadModifyWriteRow(table, row string, rules []ReadModifyWriteRule) (*Row, error) {
+	info, err := s.GetTable(table)
+	if err != nil {
+		return nil, err
+	}
+	if row == "" {
+		return nil, fmt.Errorf("row key is required")
+	}
+
+	now := nowMicros()
+	written := make(map[[2]string]*Cell)
+	var order [][2]string
+	for _, rule := range rules {
+		if _, ok := info.ColumnFamilies[rule.Family]; !ok {
+			return nil, fmt.Errorf("%w: %s", ErrFamilyNotFound, rule.Family)
+		}
+
+		column := [2]string{rule.Family, rule.Qualifier}
+		cell, ok := written[column]
+		if !ok {
+			cell = &Cell{Family: rule.Family, Qualifier: rule.Qualifier, Timestamp: now}
+			prefix := columnKeyPrefix(table, row, rule.Family, rule.Qualifier)
+			rows, _, err := s.readRows(table, prefix, prefixEnd(prefix), 1, ReadOptions{MaxVersions: 1})
+			if err != nil {
+				return nil, err
+			}
+			if len(rows) > 0 {
+				cell.Value = rows[0].Cells[0].Value
+				// Never write below the version being modified
+				cell.Timestamp = max(now, rows[0].Cells[0].Timestamp)
+			}
+			written[column] = cell
+			order = append(order, column)
+		}
+
+		switch rule.Type {
+		case "append":
+			cell.Value += rule.Value
+		case "increment":
+			var current int64
+			if cell.Value != "" {
+				if len(cell.Value) != 8 {
+					return nil, fmt.Errorf("cell %s:%s is not an 8-byte counter", rule.Family, rule.Qualifier)
+				}
+				current = int64(binary.BigEndian.Uint64([]byte(cell.Value)))
+			}
+			cell.Value = string(binary.BigEndian.AppendUint64(nil, uint64(current+rule.Delta)))
+		default:
+			return nil, fmt.Errorf("unknown read-modify-write rule: %s", rule.Type)
+		}
+	}
+
+	batch := s.db.NewBatch()
+	defer batch.Close()
+
+	sort.Slice(order, func(i, j int) bool {
+		if order[i][0] != order[j][0] {
+			return order[i][0] < order[j][0]
+		}
+		return order[i][1] < order[j][1]
+	})
+	result := &Row{Key: row}
+	for _, column := range order {
+		cell := written[column]
+		if err := batch.Set(cellKey(table, row, cell.Family, cell.Qualifier, cell.Timestamp), []byte(cell.Value), nil); err != nil {
+			return nil, err
+		}
+		result.Cells = append(result.Cells, *cell)
+	}
+	if err := s.commit(batch); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
@@ -0,0 +1,263 @@
+package kvstore
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/cockroachdb/pebble"
+)
+
+const (
+	snapshotLeaseTTL     = time.Minute
+	snapshotJanitorEvery = 10 * time.Second
+	maxSnapshotLeases    = 1024
+
+	snapshotIDLength = 16
+)
+
+var (
+	ErrSnapshotExpired  = errors.New("snapshot expired or unknown")
+	ErrTooManySnapshots = errors.New("too many open snapshots")
+	ErrInvalidCursor    = errors.New("invalid cursor")
+)
+
+// snapshotLease keeps a Pebble snapshot alive between the pages of a scan.
+// Every page renews the lease; the janitor closes leases nobody renewed.
+type snapshotLease struct {
+	snap      *pebble.Snapshot
+	scan      string // scanParams of the scan the lease belongs to
+	expiresAt time.Time
+	refs      int
+	released  bool
+}
+
+type snapshotRegistry struct {
+	mu     sync.Mutex
+	leases map[string]*snapshotLease
+}
+
+func newSnapshotRegistry() *snapshotRegistry {
+	return &snapshotRegistry{leases: make(map[string]*snapshotLease)}
+}
+
+func (r *snapshotRegistry) create(snap *pebble.Snapshot, scan string) (string, error) {
+	buf := make([]byte, snapshotIDLength/2)
+	if _, err := rand.Read(buf); err != nil {
+		snap.Close()
+		return "", err
+	}
+	id := hex.EncodeToString(buf)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.leases) >= maxSnapshotLeases {
+		snap.Close()
+		return "", ErrTooManySnapshots
+	}
+	r.leases[id] = &snapshotLease{snap: snap, scan: scan, expiresAt: time.Now().Add(snapshotLeaseTTL)}
+	return id, nil
+}
+
+// acquire renews the lease and pins the snapshot until done is called.
+func (r *snapshotRegistry) acquire(id string) (*snapshotLease, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	lease, ok := r.leases[id]
+	if !ok {
+		return nil, ErrSnapshotExpired
+	}
+	lease.refs++
+	lease.expiresAt = time.Now().Add(snapshotLeaseTTL)
+	return lease, nil
+}
+
+func (r *snapshotRegistry) done(lease *snapshotLease) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	lease.refs--
+	if lease.released && lease.refs == 0 {
+		lease.snap.Close()
+	}
+}
+
+func (r *snapshotRegistry) release(id string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if lease, ok := r.leases[id]; ok {
+		r.closeLocked(id, lease)
+	}
+}
+
+func (r *snapshotRegistry) expire(now time.Time) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	expired := 0
+	for id, lease := range r.leases {
+		if lease.refs == 0 && now.After(lease.expiresAt) {
+			r.closeLocked(id, lease)
+			expired++
+		}
+	}
+	return expired
+}
+
+func (r *snapshotRegistry) releaseAll() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for id, lease := range r.leases {
+		r.closeLocked(id, lease)
+	}
+}
+
+// closeLocked forgets the lease. A snapshot still used by a running page is
+// closed by that page's done call instead.
+func (r *snapshotRegistry) closeLocked(id string, lease *snapshotLease) {
+	delete(r.leases, id)
+	if !lease.released {
+		lease.released = true
+		if lease.refs == 0 {
+			lease.snap.Close()
+		}
+	}
+}
+
+func (s *KVStore) runSnapshotJanitor() {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(snapshotJanitorEvery)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.stop:
+			return
+		case now := <-ticker.C:
+			s.snapshots.expire(now)
+			s.txns.expire(now)
+		}
+	}
+}
+
+func encodeSnapshotCursor(id, position string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(id + position))
+}
+
+func decodeSnapshotCursor(cursor string) (string, string, error) {
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil || len(data) < snapshotIDLength {
+		return "", "", ErrInvalidCursor
+	}
+	return string(data[:snapshotIDLength]), string(data[snapshotIDLength:]), nil
+}
+
+// scanParams identifies a scan by everything but its limit, so a cursor
+// cannot carry on a different scan over the pinned view.
+func scanParams(kind, prefix string, reverse bool, filter *Filter, maxTimestamp int64) string {
+	filterJSON, _ := json.Marshal(filter)
+	return fmt.Sprintf("%s %q %t %d %s", kind, prefix, reverse, maxTimestamp, filterJSON)
+}
+
+// withSnapshotCursor runs one page of a scan against the snapshot bound to
+// cursor. An empty cursor starts a new snapshot for the scan described by
+// scan, and later cursors must come with the same scan. page receives the
+// position to resume from and returns the next position, "" when the scan is
+// done; the snapshot is released after the last page.
+func (s *KVStore) withSnapshotCursor(cursor, scan string, page func(r pebble.Reader, position string) (string, error)) (string, error) {
+	var id, position string
+	var err error
+	if cursor == "" {
+		if id, err = s.snapshots.create(s.db.NewSnapshot(), scan); err != nil {
+			return "", err
+		}
+	} else if id, position, err = decodeSnapshotCursor(cursor); err != nil {
+		return "", err
+	}
+
+	lease, err := s.snapshots.acquire(id)
+	if err != nil {
+		return "", err
+	}
+	if lease.scan != scan {
+		s.snapshots.done(lease)
+		return "", fmt.Errorf("%w: the cursor belongs to a scan with other prefix, order or filter", ErrInvalidCursor)
+	}
+	next, err := page(lease.snap, position)
+	s.snapshots.done(lease)
+	if err != nil {
+		if cursor == "" {
+			s.snapshots.release(id)
+		}
+		return "", err
+	}
+
+	if next == "" {
+		s.snapshots.release(id)
+		return "", nil
+	}
+	return encodeSnapshotCursor(id, next), nil
+}
+
+// ReleaseSnapshot ends a snapshot-bound scan early.
+func (s *KVStore) ReleaseSnapshot(cursor string) error {
+	id, _, err := decodeSnapshotCursor(cursor)
+	if err != nil {
+		return err
+	}
+	s.snapshots.release(id)
+	return nil
+}
+
+// ScanKeySnapshot is ScanKey with an opaque cursor that pins every page to
+// the point-in-time view taken for the first page.
+func (s *KVStore) ScanKeySnapshot(prefix string, cursor string, limit int, reverse bool, filter *Filter) ([]string, string, error) {
+	var keys []string
+	next, err := s.withSnapshotCursor(cursor, scanParams("keys", prefix, reverse, filter, 0), func(r pebble.Reader, position string) (string, error) {
+		var inner string
+		var err error
+		keys, inner, err = scanKey(r, prefix, position, limit, reverse, filter)
+		return inner, err
+	})
+	if err != nil {
+		return nil, "", fmt.Errorf("snapshot scan: %w", err)
+	}
+	return keys, next, nil
+}
+
+func (s *KVStore) ScanValueByKeySnapshot(prefix string, cursor string, limit int, reverse bool, filter *Filter) ([]map[string]string, string, error) {
+	var results []map[string]string
+	next, err := s.withSnapshotCursor(cursor, scanParams("values", prefix, reverse, filter, 0), func(r pebble.Reader, position string) (string, error) {
+		var inner string
+		var err error
+		results, inner, err = scanValueByKey(r, prefix, position, limit, reverse, filter)
+		return inner, err
+	})
+	if err != nil {
+		return nil, "", fmt.Errorf("snapshot scan: %w", err)
+	}
+	return results, next, nil
+}
+
+func (s *KVStore) ScanKeysLowerSnapshot(prefix string, maxTimestamp int64, cursor string, limit int) ([]string, string, error) {
+	var keys []string
+	next, err := s.withSnapshotCursor(cursor, scanParams("keys_lower", prefix, false, nil, maxTimestamp), func(r pebble.Reader, position string) (string, error) {
+		var inner string
+		var err error
+		keys, inner, err = scanKeysLower(r, prefix, maxTimestamp, position, limit)
+		return inner, err
+	})
+	if err != nil {
+		return nil, "", fmt.Errorf("snapshot scan: %w", err)
+	}
+	return keys, next, nil
+}
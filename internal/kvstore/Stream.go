@@ -0,0 +1,69 @@
+package kvstore
+
+import (
+	"context"
+	"sync"
+)
+
+// streamCheckEvery is how many entries a scan visits between checks of the
+// context.
+const streamCheckEvery = 256
+
+// streamRegistry tracks the open streams, which hold an iterator for as long
+// as their client reads, so Close can end them before closing the db.
+type streamRegistry struct {
+	mu     sync.Mutex
+	closed bool
+	active sync.WaitGroup
+}
+
+func (r *streamRegistry) add() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return false
+	}
+	r.active.Add(1)
+	return true
+}
+
+// close waits for the open streams; the caller must have closed s.stop so
+// that they stop at their next context check.
+func (r *streamRegistry) close() {
+	r.mu.Lock()
+	r.closed = true
+	r.mu.Unlock()
+	r.active.Wait()
+}
+
+// StreamRange is RangeQuery without buffering: emit sees every entry straight
+// from the iterator and may not keep key or value after it returns. The scan
+// stops with ctx's error once ctx is done, and with emit's error if it fails.
+// Closing the store stops it too. A Limit of 0 streams the whole range.
+func (s *KVStore) StreamRange(ctx context.Context, opts RangeOptions, emit func(key, value []byte) error) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	if !s.streams.add() {
+		return "", errStoreClosed
+	}
+	defer s.streams.active.Done()
+
+	return scanRange(stopContext{ctx, s.stop}, s.db, opts, emit)
+}
+
+// stopContext is ctx that also reports errStoreClosed once stop is closed,
+// so scans end at their next context check when the store closes.
+type stopContext struct {
+	context.Context
+	stop <-chan struct{}
+}
+
+func (c stopContext) Err() error {
+	select {
+	case <-c.stop:
+		return errStoreClosed
+	default:
+		return c.Context.Err()
+	}
+}
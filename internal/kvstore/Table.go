@@ -0,0 +1,438 @@
+package kvstore
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/cockroachdb/pebble"
+)
+
+var (
+	ErrTableNotFound  = errors.New("table not found")
+	ErrTableExists    = errors.New("table already exists")
+	ErrFamilyNotFound = errors.New("column family not found")
+)
+
+var (
+	tableNamePattern  = regexp.MustCompile(`^[a-zA-Z0-9_.-]{1,50}$`)
+	familyNamePattern = regexp.MustCompile(`^[_a-zA-Z0-9][-_.a-zA-Z0-9]{0,63}$`)
+)
+
+type ColumnFamily struct {
+	Name   string  `json:"name"`
+	GCRule *GCRule `json:"gcRule,omitempty"`
+}
+
+type TableInfo struct {
+	Name           string                  `json:"name"`
+	ColumnFamilies map[string]ColumnFamily `json:"columnFamilies"`
+	CreatedAt      int64                   `json:"createdAt"`
+}
+
+type Cell struct {
+	Family    string `json:"family"`
+	Qualifier string `json:"qualifier"`
+	Timestamp int64  `json:"timestamp"` // microseconds
+	Value     string `json:"value"`
+}
+
+type Row struct {
+	Key   string `json:"key"`
+	Cells []Cell `json:"cells"`
+}
+
+type Mutation struct {
+	Type      string `json:"type"` // "set", "delete_cell", "delete_family" or "delete_row"
+	Family    string `json:"family,omitempty"`
+	Qualifier string `json:"qualifier,omitempty"`
+	Value     string `json:"value,omitempty"`
+	Timestamp int64  `json:"timestamp,omitempty"` // set: 0 lets the server assign one
+
+	// delete_cell only removes versions in [StartTimestamp, EndTimestamp).
+	// Zero leaves that side open.
+	StartTimestamp int64 `json:"startTimestamp,omitempty"`
+	EndTimestamp   int64 `json:"endTimestamp,omitempty"`
+}
+
+type ReadOptions struct {
+	MaxVersions    int     // latest N versions per column, 0 for all
+	StartTimestamp int64   // inclusive, 0 for no lower bound
+	EndTimestamp   int64   // exclusive, 0 for no upper bound
+	Filter         *Filter // applied after the version selection above
+}
+
+func nowMicros() int64 {
+	return time.Now().UnixMicro()
+}
+
+func (s *KVStore) CreateTable(name string, families []ColumnFamily) error {
+	if !tableNamePattern.MatchString(name) {
+		return fmt.Errorf("invalid table name: %q", name)
+	}
+	if _, err := s.GetTable(name); err == nil {
+		return ErrTableExists
+	} else if !errors.Is(err, ErrTableNotFound) {
+		return err
+	}
+
+	info := TableInfo{
+		Name:           name,
+		ColumnFamilies: make(map[string]ColumnFamily),
+		CreatedAt:      time.Now().Unix(),
+	}
+	for _, family := range families {
+		if err := validateColumnFamily(family); err != nil {
+			return err
+		}
+		info.ColumnFamilies[family.Name] = family
+	}
+	return s.putTableInfo(&info)
+}
+
+func validateColumnFamily(family ColumnFamily) error {
+	if !familyNamePattern.MatchString(family.Name) {
+		return fmt.Errorf("invalid column family name: %q", family.Name)
+	}
+	if family.GCRule != nil {
+		if err := family.GCRule.Validate(); err != nil {
+			return fmt.Errorf("column family %s: %v", family.Name, err)
+		}
+	}
+	return nil
+}
+
+// SetColumnFamily adds a column family to a table, or replaces the GC rule of
+// an existing one.
+func (s *KVStore) SetColumnFamily(table string, family ColumnFamily) error {
+	info, err := s.GetTable(table)
+	if err != nil {
+		return err
+	}
+	if err := validateColumnFamily(family); err != nil {
+		return err
+	}
+	info.ColumnFamilies[family.Name] = family
+	return s.putTableInfo(info)
+}
+
+// DropColumnFamily removes a column family and all of its cells.
+func (s *KVStore) DropColumnFamily(table, family string) error {
+	info, err := s.GetTable(table)
+	if err != nil {
+		return err
+	}
+	if _, ok := info.ColumnFamilies[family]; !ok {
+		return fmt.Errorf("%w: %s", ErrFamilyNotFound, family)
+	}
+	delete(info.ColumnFamilies, family)
+
+	iter, err := s.db.NewIter(&pebble.IterOptions{
+		LowerBound: tableKeyPrefix(table),
+		UpperBound: prefixEnd(tableKeyPrefix(table)),
+	})
+	if err != nil {
+		return err
+	}
+	defer iter.Close()
+
+	batch := s.db.NewBatch()
+	defer batch.Close()
+
+	// Families are nested inside rows, so every row needs its own tombstone
+	for valid := iter.First(); valid; {
+		row, _, _, _, err := decodeCellKey(table, iter.Key())
+		if err != nil {
+			return err
+		}
+		prefix := familyKeyPrefix(table, row, family)
+		if err := batch.DeleteRange(prefix, prefixEnd(prefix), nil); err != nil {
+			return err
+		}
+		valid = iter.SeekGE(prefixEnd(rowKeyPrefix(table, row)))
+	}
+	if err := iter.Error(); err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(info)
+	if err != nil {
+		return fmt.Errorf("failed to marshal table info: %v", err)
+	}
+	if err := batch.Set(catalogKey(table), data, nil); err != nil {
+		return err
+	}
+	return batch.Commit(pebble.Sync)
+}
+
+func (s *KVStore) putTableInfo(info *TableInfo) error {
+	data, err := json.Marshal(info)
+	if err != nil {
+		return fmt.Errorf("failed to marshal table info: %v", err)
+	}
+	return s.db.Set(catalogKey(info.Name), data, pebble.Sync)
+}
+
+func (s *KVStore) GetTable(name string) (*TableInfo, error) {
+	data, closer, err := s.db.Get(catalogKey(name))
+	if errors.Is(err, pebble.ErrNotFound) {
+		return nil, ErrTableNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer closer.Close()
+
+	var info TableInfo
+	if err := json.Unmarshal(data, &info); err != nil {
+		return nil, fmt.Errorf("corrupted catalog entry for table %s: %v", name, err)
+	}
+	return &info, nil
+}
+
+func (s *KVStore) ListTables() ([]TableInfo, error) {
+	iter, err := s.db.NewIter(&pebble.IterOptions{
+		LowerBound: []byte(catalogPrefix),
+		UpperBound: prefixEnd([]byte(catalogPrefix)),
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer iter.Close()
+
+	tables := []TableInfo{}
+	for iter.First(); iter.Valid(); iter.Next() {
+		var info TableInfo
+		if err := json.Unmarshal(iter.Value(), &info); err != nil {
+			return nil, fmt.Errorf("corrupted catalog entry %q: %v", iter.Key(), err)
+		}
+		tables = append(tables, info)
+	}
+	if err := iter.Error(); err != nil {
+		return nil, err
+	}
+	return tables, nil
+}
+
+func (s *KVStore) DeleteTable(name string) error {
+	if _, err := s.GetTable(name); err != nil {
+		return err
+	}
+
+	batch := s.db.NewBatch()
+	defer batch.Close()
+
+	prefix := tableKeyPrefix(name)
+	if err := batch.DeleteRange(prefix, prefixEnd(prefix), nil); err != nil {
+		return err
+	}
+	if err := batch.Delete(catalogKey(name), nil); err != nil {
+		return err
+	}
+	return batch.Commit(pebble.Sync)
+}
+
+// DropRowRange removes every row of table whose key starts with prefix, or
+// all rows when prefix is empty. The table itself stays.
+func (s *KVStore) DropRowRange(table, prefix string) error {
+	if _, err := s.GetTable(table); err != nil {
+		return err
+	}
+	lower := rowRangePrefix(table, prefix)
+	if prefix == "" {
+		lower = tableKeyPrefix(table)
+	}
+	return s.db.DeleteRange(lower, prefixEnd(lower), pebble.Sync)
+}
+
+func (s *KVStore) MutateRow(table, row string, mutations []Mutation) error {
+	info, err := s.GetTable(table)
+	if err != nil {
+		return err
+	}
+	if row == "" {
+		return fmt.Errorf("row key is required")
+	}
+
+	batch := s.db.NewBatch()
+	defer batch.Close()
+
+	if err := applyMutations(batch, info, row, mutations); err != nil {
+		return err
+	}
+	return s.commit(batch)
+}
+
+func applyMutations(batch *pebble.Batch, info *TableInfo, row string, mutations []Mutation) error {
+	table := info.Name
+	now := nowMicros()
+
+	var err error
+	for _, m := range mutations {
+		if m.Timestamp < 0 {
+			return fmt.Errorf("invalid timestamp: %d", m.Timestamp)
+		}
+		if m.Type != "delete_row" {
+			if _, ok := info.ColumnFamilies[m.Family]; !ok {
+				return fmt.Errorf("%w: %s", ErrFamilyNotFound, m.Family)
+			}
+		}
+
+		switch m.Type {
+		case "set":
+			timestamp := m.Timestamp
+			if timestamp == 0 {
+				timestamp = now
+			}
+			err = batch.Set(cellKey(table, row, m.Family, m.Qualifier, timestamp), []byte(m.Value), nil)
+		case "delete_cell":
+			// Newer versions sort first, so EndTimestamp gives the lower key.
+			column := columnKeyPrefix(table, row, m.Family, m.Qualifier)
+			lower, upper := column, prefixEnd(column)
+			if m.EndTimestamp > 0 {
+				lower = cellKey(table, row, m.Family, m.Qualifier, m.EndTimestamp-1)
+			}
+			if m.StartTimestamp > 0 {
+				upper = prefixEnd(cellKey(table, row, m.Family, m.Qualifier, m.StartTimestamp))
+			}
+			err = batch.DeleteRange(lower, upper, nil)
+		case "delete_family":
+			prefix := familyKeyPrefix(table, row, m.Family)
+			err = batch.DeleteRange(prefix, prefixEnd(prefix), nil)
+		case "delete_row":
+			prefix := rowKeyPrefix(table, row)
+			err = batch.DeleteRange(prefix, prefixEnd(prefix), nil)
+		default:
+			return fmt.Errorf("unknown mutation type: %s", m.Type)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *KVStore) ReadRow(table, row string, opts ReadOptions) (*Row, error) {
+	rows, _, err := s.readRows(table, rowKeyPrefix(table, row), prefixEnd(rowKeyPrefix(table, row)), 1, opts)
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, pebble.ErrNotFound
+	}
+	return &rows[0], nil
+}
+
+// ReadRows returns up to limit rows in [startKey, endKey). An empty startKey or
+// endKey leaves that side of the range open.
+func (s *KVStore) ReadRows(table, startKey, endKey string, limit int, opts ReadOptions) ([]Row, string, error) {
+	lower := tableKeyPrefix(table)
+	upper := prefixEnd(lower)
+	if startKey != "" {
+		lower = rowKeyPrefix(table, startKey)
+	}
+	if endKey != "" {
+		upper = rowKeyPrefix(table, endKey)
+	}
+	return s.readRows(table, lower, upper, limit, opts)
+}
+
+func (s *KVStore) readRows(table string, lower, upper []byte, limit int, opts ReadOptions) ([]Row, string, error) {
+	info, err := s.GetTable(table)
+	if err != nil {
+		return nil, "", err
+	}
+	rf, err := opts.Filter.compile()
+	if err != nil {
+		return nil, "", err
+	}
+
+	iter, err := s.db.NewIter(&pebble.IterOptions{
+		LowerBound: lower,
+		UpperBound: upper,
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	defer iter.Close()
+
+	var rows []Row
+	var nextCursor string
+	var column []byte
+	var index, versions int
+	now := nowMicros()
+
+	// The filter sees a row once all of its cells are read; rows it empties
+	// do not count against limit.
+	finishRow := func() {
+		last := &rows[len(rows)-1]
+		if last.Cells = rf.apply([]byte(last.Key), last.Cells); len(last.Cells) == 0 {
+			rows = rows[:len(rows)-1]
+		}
+	}
+
+	for valid := iter.First(); valid; {
+		key := iter.Key()
+		row, family, qualifier, timestamp, err := decodeCellKey(info.Name, key)
+		if err != nil {
+			return nil, "", err
+		}
+
+		columnPrefix := key[:len(key)-8]
+		if !bytes.Equal(columnPrefix, column) {
+			column = append(column[:0], columnPrefix...)
+			index, versions = 0, 0
+		}
+
+		// Versions past the GC rule are hidden even before the sweeper removes them
+		if rule := info.gcRule(family); rule != nil && rule.isGarbage(index, timestamp, now) {
+			valid = iter.SeekGE(prefixEnd(column))
+			continue
+		}
+		index++
+
+		if opts.MaxVersions > 0 && versions >= opts.MaxVersions {
+			// Skip the remaining (older) versions of this column
+			valid = iter.SeekGE(prefixEnd(column))
+			continue
+		}
+		if opts.EndTimestamp > 0 && timestamp >= opts.EndTimestamp {
+			valid = iter.Next()
+			continue
+		}
+		if opts.StartTimestamp > 0 && timestamp < opts.StartTimestamp {
+			valid = iter.SeekGE(prefixEnd(column))
+			continue
+		}
+		versions++
+
+		if len(rows) == 0 || rows[len(rows)-1].Key != row {
+			if len(rows) > 0 {
+				finishRow()
+			}
+			if len(rows) == limit {
+				nextCursor = row
+				break
+			}
+			rows = append(rows, Row{Key: row})
+		}
+		current := &rows[len(rows)-1]
+		current.Cells = append(current.Cells, Cell{
+			Family:    family,
+			Qualifier: qualifier,
+			Timestamp: timestamp,
+			Value:     string(iter.Value()),
+		})
+		valid = iter.Next()
+	}
+	if err := iter.Error(); err != nil {
+		return nil, "", err
+	}
+	if nextCursor == "" && len(rows) > 0 {
+		finishRow()
+	}
+	return rows, nextCursor, nil
+}
@@ -0,0 +1,300 @@
+package kvstore
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/cockroachdb/pebble"
+)
+
+const (
+	DefaultTxnTimeout = 30 * time.Second
+	MaxTxnTimeout     = 10 * time.Minute
+	maxTransactions   = 1024
+)
+
+var (
+	ErrTxnNotFound         = errors.New("transaction expired or unknown")
+	ErrTxnConflict         = errors.New("transaction conflict")
+	ErrTooManyTransactions = errors.New("too many open transactions")
+)
+
+// transaction is an optimistic transaction on flat keys. Reads come from
+// the snapshot taken at begin and remember the version they saw; writes are
+// buffered until commit. Commit fails with ErrTxnConflict when a key that was
+// read or written changed after the snapshot, so two transactions that touch
+// the same key cannot both commit. Scans are not tracked, only point reads.
+type transaction struct {
+	mu       sync.Mutex
+	snap     *pebble.Snapshot
+	deadline time.Time
+	reads    map[string]int64 // version seen at the snapshot, 0 when missing
+	writes   map[string]BatchOperation
+	done     bool
+}
+
+type txnRegistry struct {
+	mu   sync.Mutex
+	txns map[string]*transaction
+}
+
+func newTxnRegistry() *txnRegistry {
+	return &txnRegistry{txns: make(map[string]*transaction)}
+}
+
+func (r *txnRegistry) create(txn *transaction) (string, error) {
+	buf := make([]byte, 8)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	id := hex.EncodeToString(buf)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.txns) >= maxTransactions {
+		return "", ErrTooManyTransactions
+	}
+	r.txns[id] = txn
+	return id, nil
+}
+
+// acquire locks the transaction for one call. The caller must unlock it.
+func (r *txnRegistry) acquire(id string) (*transaction, error) {
+	r.mu.Lock()
+	txn, ok := r.txns[id]
+	r.mu.Unlock()
+	if !ok {
+		return nil, ErrTxnNotFound
+	}
+
+	txn.mu.Lock()
+	if txn.done || time.Now().After(txn.deadline) {
+		txn.mu.Unlock()
+		r.finish(id, txn)
+		return nil, ErrTxnNotFound
+	}
+	return txn, nil
+}
+
+// finish forgets the transaction and releases its snapshot.
+func (r *txnRegistry) finish(id string, txn *transaction) {
+	r.mu.Lock()
+	if r.txns[id] == txn {
+		delete(r.txns, id)
+	}
+	r.mu.Unlock()
+
+	txn.mu.Lock()
+	defer txn.mu.Unlock()
+	if !txn.done {
+		txn.done = true
+		txn.snap.Close()
+	}
+}
+
+func (r *txnRegistry) expire(now time.Time) {
+	r.mu.Lock()
+	var expired []string
+	for id, txn := range r.txns {
+		if now.After(txn.deadline) {
+			expired = append(expired, id)
+		}
+	}
+	r.mu.Unlock()
+
+	for _, id := range expired {
+		r.mu.Lock()
+		txn, ok := r.txns[id]
+		r.mu.Unlock()
+		if ok {
+			r.finish(id, txn)
+		}
+	}
+}
+
+func (r *txnRegistry) finishAll() {
+	r.mu.Lock()
+	txns := r.txns
+	r.txns = make(map[string]*transaction)
+	r.mu.Unlock()
+
+	for id, txn := range txns {
+		r.finish(id, txn)
+	}
+}
+
+// BeginTransaction starts a transaction that expires after timeout, or
+// DefaultTxnTimeout when timeout is 0, and returns its ID.
+func (s *KVStore) BeginTransaction(timeout time.Duration) (string, error) {
+	if timeout == 0 {
+		timeout = DefaultTxnTimeout
+	}
+	if timeout < 0 || timeout > MaxTxnTimeout {
+		return "", fmt.Errorf("transaction timeout must be between 0 and %v", MaxTxnTimeout)
+	}
+
+	txn := &transaction{
+		snap:     s.db.NewSnapshot(),
+		deadline: time.Now().Add(timeout),
+		reads:    make(map[string]int64),
+		writes:   make(map[string]BatchOperation),
+	}
+	id, err := s.txns.create(txn)
+	if err != nil {
+		txn.snap.Close()
+		return "", err
+	}
+	return id, nil
+}
+
+// TxnGet reads key inside the transaction: its own buffered write if there
+// is one, the snapshot otherwise. The version is 0 for buffered writes.
+// Missing keys return pebble.ErrNotFound and are tracked too, so a concurrent
+// insert is a conflict.
+func (s *KVStore) TxnGet(id, key string) (string, int64, error) {
+	txn, err := s.txns.acquire(id)
+	if err != nil {
+		return "", 0, err
+	}
+	defer txn.mu.Unlock()
+
+	if op, ok := txn.writes[key]; ok {
+		if op.Type == "delete" {
+			return "", 0, pebble.ErrNotFound
+		}
+		value, err := s.convertToString(op.Value)
+		return value, 0, err
+	}
+
+	value, meta, found, err := readLive(txn.snap, key)
+	if err != nil {
+		return "", 0, err
+	}
+	if _, ok := txn.reads[key]; !ok {
+		txn.reads[key] = meta.version
+	}
+	if !found {
+		return "", 0, pebble.ErrNotFound
+	}
+	return string(value), meta.version, nil
+}
+
+// TxnWrite buffers set and delete operations. A later write to the same key
+// replaces the earlier one.
+func (s *KVStore) TxnWrite(id string, operations []BatchOperation) error {
+	for _, op := range operations {
+		if op.Type != "set" && op.Type != "delete" {
+			return fmt.Errorf("%w: transactions only support set and delete, got %q", ErrInvalidOperation, op.Type)
+		}
+		if op.Key == "" {
+			return fmt.Errorf("%w: key is required", ErrInvalidOperation)
+		}
+		if err := checkKey(op.Key); err != nil {
+			return err
+		}
+		if op.TTL < 0 {
+			return fmt.Errorf("%w: invalid ttl for key %s: %d", ErrInvalidOperation, op.Key, op.TTL)
+		}
+	}
+
+	txn, err := s.txns.acquire(id)
+	if err != nil {
+		return err
+	}
+	defer txn.mu.Unlock()
+
+	for _, op := range operations {
+		txn.writes[op.Key] = op
+	}
+	return nil
+}
+
+// CommitTransaction validates and applies the transaction in one batch. The
+// transaction is finished either way. lockKeys is called with every key the
+// transaction read or wrote and must keep other writers off them until the
+// returned unlock; KVNode passes its key locks.
+func (s *KVStore) CommitTransaction(id string, lockKeys func(keys ...string) func()) error {
+	txn, err := s.txns.acquire(id)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		txn.mu.Unlock()
+		s.txns.finish(id, txn)
+	}()
+
+	locked := make([]string, 0, len(txn.reads)+len(txn.writes))
+	for key := range txn.reads {
+		locked = append(locked, key)
+	}
+	for key := range txn.writes {
+		locked = append(locked, key)
+	}
+	defer lockKeys(locked...)()
+
+	// read-write conflicts: what was read changed since the snapshot
+	for key, seen := range txn.reads {
+		if err := s.checkUnchanged(key, seen); err != nil {
+			return err
+		}
+	}
+
+	keys := make([]string, 0, len(txn.writes))
+	for key := range txn.writes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	if len(keys) == 0 {
+		return nil
+	}
+
+	// write-write conflicts: a blind write still loses to a commit made
+	// after the snapshot
+	operations := make([]BatchOperation, len(keys))
+	for i, key := range keys {
+		if _, read := txn.reads[key]; !read {
+			_, meta, _, err := readLive(txn.snap, key)
+			if err != nil {
+				return err
+			}
+			if err := s.checkUnchanged(key, meta.version); err != nil {
+				return err
+			}
+		}
+		operations[i] = txn.writes[key]
+	}
+
+	batch := s.db.NewBatch()
+	defer batch.Close()
+	if _, err := s.applyOperations(batch, operations); err != nil {
+		return err
+	}
+	return s.commit(batch)
+}
+
+func (s *KVStore) checkUnchanged(key string, version int64) error {
+	_, meta, _, err := readLive(s.db, key)
+	if err != nil {
+		return err
+	}
+	if meta.version != version {
+		return fmt.Errorf("%w on key %s", ErrTxnConflict, key)
+	}
+	return nil
+}
+
+// RollbackTransaction drops the transaction and its buffered writes.
+func (s *KVStore) RollbackTransaction(id string) error {
+	txn, err := s.txns.acquire(id)
+	if err != nil {
+		return err
+	}
+	txn.mu.Unlock()
+	s.txns.finish(id, txn)
+	return nil
+}
@@ -0,0 +1,264 @@
+package kvstore
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/cockroachdb/pebble"
+)
+
+const (
+	expiryPrefix = "\x00e"
+
+	reapInterval  = 10 * time.Second
+	reapBatchSize = 256 // expired keys deleted per commit
+)
+
+// Values written through the flat key/value API carry a small header:
+// valueMagic, flags, [expiresAt], [version], value. Values without the magic
+// byte predate the header and are returned as-is with version 0.
+const (
+	valueMagic = 0x00
+
+	flagExpiry  = 1 << 0
+	flagVersion = 1 << 1
+)
+
+type valueMeta struct {
+	expiresAt int64 // unix milliseconds, 0 when the key never expires
+	version   int64 // write timestamp in microseconds, unique per store
+}
+
+func encodeValue(value string, meta valueMeta) []byte {
+	if meta == (valueMeta{}) && (len(value) == 0 || value[0] != valueMagic) {
+		return []byte(value)
+	}
+
+	buf := make([]byte, 0, len(value)+18)
+	buf = append(buf, valueMagic, 0)
+	if meta.expiresAt != 0 {
+		buf[1] |= flagExpiry
+		buf = binary.BigEndian.AppendUint64(buf, uint64(meta.expiresAt))
+	}
+	if meta.version != 0 {
+		buf[1] |= flagVersion
+		buf = binary.BigEndian.AppendUint64(buf, uint64(meta.version))
+	}
+	return append(buf, value...)
+}
+
+func decodeValue(raw []byte) ([]byte, valueMeta, error) {
+	var meta valueMeta
+	if len(raw) == 0 || raw[0] != valueMagic {
+		return raw, meta, nil
+	}
+	if len(raw) < 2 {
+		return nil, meta, fmt.Errorf("corrupted value header")
+	}
+
+	flags, rest := raw[1], raw[2:]
+	for _, field := range []struct {
+		flag byte
+		dst  *int64
+	}{{flagExpiry, &meta.expiresAt}, {flagVersion, &meta.version}} {
+		if flags&field.flag == 0 {
+			continue
+		}
+		if len(rest) < 8 {
+			return nil, meta, fmt.Errorf("corrupted value header")
+		}
+		*field.dst = int64(binary.BigEndian.Uint64(rest))
+		rest = rest[8:]
+	}
+	return rest, meta, nil
+}
+
+func isExpired(expiresAt, now int64) bool {
+	return expiresAt != 0 && expiresAt <= now
+}
+
+// liveValue decodes raw and reports whether the entry is still visible.
+func liveValue(raw []byte, now int64) ([]byte, bool, error) {
+	value, meta, err := decodeValue(raw)
+	if err != nil {
+		return nil, false, err
+	}
+	return value, !isExpired(meta.expiresAt, now), nil
+}
+
+// readLive returns a copy of the live value of key as seen by r. Batches
+// passed here must be indexed so that their own writes are visible.
+func readLive(r pebble.Reader, key string) ([]byte, valueMeta, bool, error) {
+	if err := checkKey(key); err != nil {
+		return nil, valueMeta{}, false, err
+	}
+	raw, closer, err := r.Get([]byte(key))
+	if errors.Is(err, pebble.ErrNotFound) {
+		return nil, valueMeta{}, false, nil
+	}
+	if err != nil {
+		return nil, valueMeta{}, false, err
+	}
+	defer closer.Close()
+
+	value, meta, err := decodeValue(raw)
+	if err != nil {
+		return nil, valueMeta{}, false, err
+	}
+	if isExpired(meta.expiresAt, time.Now().UnixMilli()) {
+		return nil, valueMeta{}, false, nil
+	}
+	return append([]byte(nil), value...), meta, true, nil
+}
+
+// nextVersion returns a strictly increasing write version based on the
+// wall clock.
+func (s *KVStore) nextVersion() int64 {
+	for {
+		last := s.lastVersion.Load()
+		next := nowMicros()
+		if next <= last {
+			next = last + 1
+		}
+		if s.lastVersion.CompareAndSwap(last, next) {
+			return next
+		}
+	}
+}
+
+func expiresAtFor(ttl time.Duration) int64 {
+	if ttl <= 0 {
+		return 0
+	}
+	return time.Now().Add(ttl).UnixMilli()
+}
+
+func expiryIndexKey(expiresAt int64, key string) []byte {
+	buf := binary.BigEndian.AppendUint64([]byte(expiryPrefix), uint64(expiresAt))
+	return append(buf, key...)
+}
+
+// setInBatch writes a flat key with a fresh version and, for expiring keys,
+// the index entry the reaper uses to find it.
+func (s *KVStore) setInBatch(batch *pebble.Batch, key, value string, expiresAt int64) error {
+	if err := checkKey(key); err != nil {
+		return err
+	}
+	meta := valueMeta{expiresAt: expiresAt, version: s.nextVersion()}
+	if err := batch.Set([]byte(key), encodeValue(value, meta), nil); err != nil {
+		return err
+	}
+	if expiresAt != 0 {
+		return batch.Set(expiryIndexKey(expiresAt, key), nil, nil)
+	}
+	return nil
+}
+
+func (s *KVStore) runReaper() {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(reapInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+			if n, err := s.ReapExpired(); err != nil {
+				log.Printf("Expired key reaping failed: %v", err)
+			} else if n > 0 {
+				log.Printf("Reaped %d expired keys", n)
+			}
+		}
+	}
+}
+
+// SetKeyLocker makes the reaper hold lock for the keys it deletes, so it
+// cannot delete a key a writer refreshes in the meantime. lock must take
+// the same locks as the writers of those keys; KVNode passes its key locks.
+func (s *KVStore) SetKeyLocker(lock func(keys ...string) func()) {
+	s.keyLocker.Store(&lock)
+}
+
+// ReapExpired physically deletes keys whose TTL has passed and returns how
+// many were removed. Reads already hide them.
+func (s *KVStore) ReapExpired() (int, error) {
+	now := time.Now().UnixMilli()
+	iter, err := s.db.NewIter(&pebble.IterOptions{
+		LowerBound: []byte(expiryPrefix),
+		UpperBound: expiryIndexKey(now+1, ""),
+	})
+	if err != nil {
+		return 0, err
+	}
+	defer iter.Close()
+
+	reaped := 0
+	var indexKeys [][]byte
+	for iter.First(); iter.Valid(); iter.Next() {
+		indexKeys = append(indexKeys, append([]byte(nil), iter.Key()...))
+		if len(indexKeys) < reapBatchSize {
+			continue
+		}
+		n, err := s.reapEntries(indexKeys)
+		reaped += n
+		if err != nil {
+			return reaped, err
+		}
+		indexKeys = indexKeys[:0]
+	}
+	if err := iter.Error(); err != nil {
+		return reaped, err
+	}
+	n, err := s.reapEntries(indexKeys)
+	return reaped + n, err
+}
+
+// reapEntries drops the given expiry index entries and deletes their keys
+// under the key locks, so the check that a key still carries the indexed
+// expiry and its delete commit together.
+func (s *KVStore) reapEntries(indexKeys [][]byte) (int, error) {
+	if len(indexKeys) == 0 {
+		return 0, nil
+	}
+	keys := make([]string, len(indexKeys))
+	for i, indexKey := range indexKeys {
+		keys[i] = string(indexKey[len(expiryPrefix)+8:])
+	}
+	if lock := s.keyLocker.Load(); lock != nil {
+		defer (*lock)(keys...)()
+	}
+
+	batch := s.db.NewBatch()
+	defer batch.Close()
+
+	reaped := 0
+	for i, indexKey := range indexKeys {
+		expiresAt := int64(binary.BigEndian.Uint64(indexKey[len(expiryPrefix):]))
+
+		// The key may have been overwritten since; only delete it if the
+		// stored expiry is still the one this index entry points at.
+		raw, closer, err := s.db.Get([]byte(keys[i]))
+		if err == nil {
+			_, current, decodeErr := decodeValue(raw)
+			closer.Close()
+			if decodeErr == nil && current.expiresAt == expiresAt {
+				if err := batch.Delete([]byte(keys[i]), nil); err != nil {
+					return 0, err
+				}
+				reaped++
+			}
+		} else if err != pebble.ErrNotFound {
+			return 0, err
+		}
+
+		if err := batch.Delete(indexKey, nil); err != nil {
+			return 0, err
+		}
+	}
+	return reaped, s.commit(batch)
+}
@@ -2,12 +2,20 @@ package node
 
 import (
 	"bigtable/internal/kvstore"
+	"context"
 	"sync"
+	"time"
 )
 
+// KVNode serializes writers per key rather than globally. Point writes hold
+// mu shared plus the lock stripes of their keys, so writes to different keys
+// run in parallel and share WAL syncs. mu is taken exclusively only by writes
+// that cover key ranges or the table catalog, and by Close. Reads hold mu
+// shared and never wait for a key lock.
 type KVNode struct {
 	store *kvstore.KVStore
 	mu    sync.RWMutex
+	locks *keyLocks
 }
 
 func NewKVNode(database string) (*KVNode, error) {
@@ -15,31 +23,76 @@ func NewKVNode(database string) (*KVNode, error) {
 	if err != nil {
 		return nil, err
 	}
-	return &KVNode{store: store}, nil
+	n := &KVNode{store: store, locks: newKeyLocks()}
+	// The reaper runs without mu, which Close holds while it waits for it
+	store.SetKeyLocker(n.locks.lock)
+	return n, nil
 }
 
 func (n *KVNode) Set(key string, value string) error {
-	n.mu.Lock()
-	defer n.mu.Unlock()
+	defer n.lockWrite([]string{key})()
 	return n.store.Set(key, value)
 }
 
+func (n *KVNode) SetWithTTL(key string, value string, ttl time.Duration) error {
+	defer n.lockWrite([]string{key})()
+	return n.store.SetWithTTL(key, value, ttl)
+}
+
+func (n *KVNode) SetWithOptions(key string, value string, ttl time.Duration, opts kvstore.WriteOptions) error {
+	defer n.lockWrite([]string{key})()
+	return n.store.SetWithOptions(key, value, ttl, opts)
+}
+
+// SetDefaultWriteOptions sets the durability of writes that do not choose one.
+func (n *KVNode) SetDefaultWriteOptions(opts kvstore.WriteOptions) {
+	n.store.SetDefaultWriteOptions(opts)
+}
+
 func (n *KVNode) Get(key string) (string, error) {
 	n.mu.RLock()
 	defer n.mu.RUnlock()
 	return n.store.Get(key)
 }
 
-func (n *KVNode) RangeQuery(startKey, endKey string) (map[string]string, error){
+func (n *KVNode) MultiGet(keys []string) ([]kvstore.MultiGetResult, error) {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	return n.store.MultiGet(keys)
+}
+
+func (n *KVNode) GetWithVersion(key string) (string, int64, error) {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	return n.store.GetWithVersion(key)
+}
+
+func (n *KVNode) CheckAndMutate(key string, cond kvstore.Condition, onTrue, onFalse []kvstore.BatchOperation) (bool, error) {
+	defer n.lockWrite([]string{key}, onTrue, onFalse)()
+	return n.store.CheckAndMutate(key, cond, onTrue, onFalse)
+}
+
+func (n *KVNode) SetIf(key, value string, ttl time.Duration, cond kvstore.Condition) (bool, error) {
+	defer n.lockWrite([]string{key})()
+	return n.store.SetIf(key, value, ttl, cond)
+}
+
+func (n *KVNode) TTL(key string) (time.Duration, error) {
 	n.mu.RLock()
 	defer n.mu.RUnlock()
-	return n.store.RangeQuery(startKey,endKey)
+	return n.store.TTL(key)
 }
 
-func (n *KVNode) ScanKey(prefix string, cursor string, limit int) ([]string, string, error) {
+func (n *KVNode) RangeQuery(opts kvstore.RangeOptions) ([]kvstore.KeyValue, string, error){
 	n.mu.RLock()
 	defer n.mu.RUnlock()
-	return n.store.ScanKey(prefix,cursor, limit)
+	return n.store.RangeQuery(opts)
+}
+
+func (n *KVNode) ScanKey(prefix string, cursor string, limit int, reverse bool, filter *kvstore.Filter) ([]string, string, error) {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	return n.store.ScanKey(prefix,cursor, limit, reverse, filter)
 }
 
 func (n *KVNode) ScanKeysLower(prefix string, maxTimestamp int64, cursor string, limit int) ([]string, string, error){
@@ -48,23 +101,150 @@ func (n *KVNode) ScanKeysLower(prefix string, maxTimestamp int64, cursor string,
 	return n.store.ScanKeysLower(prefix,maxTimestamp,cursor, limit)
 }
 
-func (n *KVNode) ScanValueByKey(prefix string, cursor string, limit int) ([]map[string]string, string, error) {
+func (n *KVNode) ScanValueByKey(prefix string, cursor string, limit int, reverse bool, filter *kvstore.Filter) ([]map[string]string, string, error) {
     n.mu.RLock()
     defer n.mu.RUnlock()
-    return n.store.ScanValueByKey(prefix, cursor, limit)
+    return n.store.ScanValueByKey(prefix, cursor, limit, reverse, filter)
+}
+
+
+func (n *KVNode) ScanKeySnapshot(prefix string, cursor string, limit int, reverse bool, filter *kvstore.Filter) ([]string, string, error) {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	return n.store.ScanKeySnapshot(prefix, cursor, limit, reverse, filter)
+}
+
+func (n *KVNode) ScanValueByKeySnapshot(prefix string, cursor string, limit int, reverse bool, filter *kvstore.Filter) ([]map[string]string, string, error) {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	return n.store.ScanValueByKeySnapshot(prefix, cursor, limit, reverse, filter)
+}
+
+func (n *KVNode) ScanKeysLowerSnapshot(prefix string, maxTimestamp int64, cursor string, limit int) ([]string, string, error) {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	return n.store.ScanKeysLowerSnapshot(prefix, maxTimestamp, cursor, limit)
 }
 
+// StreamRange lasts as long as its client reads, so it does not hold the node
+// lock: the iterator already reads a consistent view, and a slow client must
+// not stall range writes or Close. Closing the store ends the stream.
+func (n *KVNode) StreamRange(ctx context.Context, opts kvstore.RangeOptions, emit func(key, value []byte) error) (string, error) {
+	return n.store.StreamRange(ctx, opts, emit)
+}
+
+// Aggregate streams like StreamRange and does not hold the node lock either.
+func (n *KVNode) Aggregate(ctx context.Context, opts kvstore.RangeOptions, spec kvstore.AggregateSpec) ([]kvstore.AggregateResult, error) {
+	return n.store.Aggregate(ctx, opts, spec)
+}
+
+// WatchChanges lasts as long as the subscriber, so it does not hold the node
+// lock either.
+func (n *KVNode) WatchChanges(ctx context.Context, prefix string, after uint64, emit func(kvstore.Change) error) error {
+	return n.store.WatchChanges(ctx, prefix, after, emit)
+}
+
+func (n *KVNode) LastChangeSeq() uint64 {
+	return n.store.LastChangeSeq()
+}
+
+func (n *KVNode) CheckResume(after uint64) error {
+	return n.store.CheckResume(after)
+}
+
+// Checkpoint only keeps Close away; writers go on while it runs.
+func (n *KVNode) Checkpoint(dir string) error {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	return n.store.Checkpoint(dir)
+}
+
+func (n *KVNode) SetChangeRetention(retention time.Duration) {
+	n.store.SetChangeRetention(retention)
+}
+
+func (n *KVNode) ReleaseSnapshot(cursor string) error {
+	return n.store.ReleaseSnapshot(cursor)
+}
+
+func (n *KVNode) BeginTransaction(timeout time.Duration) (string, error) {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	return n.store.BeginTransaction(timeout)
+}
+
+func (n *KVNode) TxnGet(id, key string) (string, int64, error) {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	return n.store.TxnGet(id, key)
+}
+
+// TxnWrite only buffers the operations, so it does not take the write lock.
+func (n *KVNode) TxnWrite(id string, operations []kvstore.BatchOperation) error {
+	return n.store.TxnWrite(id, operations)
+}
+
+func (n *KVNode) CommitTransaction(id string) error {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	return n.store.CommitTransaction(id, n.locks.lock)
+}
+
+func (n *KVNode) RollbackTransaction(id string) error {
+	return n.store.RollbackTransaction(id)
+}
 
 func (n *KVNode) BatchWrite(operations []kvstore.BatchOperation) error {
-	n.mu.Lock()
-	defer n.mu.Unlock()
+	defer n.lockWrite(nil, operations)()
 	return n.store.BatchOperation(operations)
 }
 
+func (n *KVNode) BatchWriteWithResults(operations []kvstore.BatchOperation) ([]string, error) {
+	defer n.lockWrite(nil, operations)()
+	return n.store.BatchOperationWithResults(operations)
+}
+
+func (n *KVNode) BatchWriteWithOptions(operations []kvstore.BatchOperation, opts kvstore.WriteOptions) ([]string, error) {
+	defer n.lockWrite(nil, operations)()
+	return n.store.BatchOperationWithOptions(operations, opts)
+}
+
+func (n *KVNode) Increment(key string, delta int64, encoding string) (int64, error) {
+	defer n.lockWrite([]string{key})()
+	return n.store.Increment(key, delta, encoding)
+}
+
+func (n *KVNode) Append(key string, suffix string, encoding string) (string, error) {
+	defer n.lockWrite([]string{key})()
+	return n.store.Append(key, suffix, encoding)
+}
+
 func (n *KVNode) Delete(key string) error {
+	defer n.lockWrite([]string{key})()
+	return n.store.Delete(key)
+}
+
+func (n *KVNode) DeleteWithOptions(key string, opts kvstore.WriteOptions) error {
+	defer n.lockWrite([]string{key})()
+	return n.store.DeleteWithOptions(key, opts)
+}
+
+func (n *KVNode) DeletePrefix(prefix string) error {
 	n.mu.Lock()
 	defer n.mu.Unlock()
-	return n.store.Delete(key)
+	return n.store.DeletePrefix(prefix)
+}
+
+func (n *KVNode) DeleteRange(startKey, endKey string) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.store.DeleteRange(startKey, endKey)
+}
+
+func (n *KVNode) CountRange(startKey, endKey string, maxScan int) (int, bool, error) {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	return n.store.CountRange(startKey, endKey, maxScan)
 }
 
 func (n *KVNode) ScanOffset(prefix string, offset int) (string, error) {
@@ -79,6 +259,111 @@ func (n *KVNode) TotalKey(prefix string) (int,error){
 	return n.store.TotalKey(prefix)
 }
 
+func (n *KVNode) EstimateKeys(prefix string) (kvstore.KeyEstimate, error) {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	return n.store.EstimateKeys(prefix)
+}
+
+func (n *KVNode) CountKeys(prefix string, maxScan int) (int, bool, error) {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	return n.store.CountKeys(prefix, maxScan)
+}
+
+func (n *KVNode) EnableCounter(prefix string) (int64, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.store.EnableCounter(prefix)
+}
+
+func (n *KVNode) DisableCounter(prefix string) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.store.DisableCounter(prefix)
+}
+
+func (n *KVNode) CreateTable(name string, families []kvstore.ColumnFamily) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.store.CreateTable(name, families)
+}
+
+func (n *KVNode) SetColumnFamily(table string, family kvstore.ColumnFamily) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.store.SetColumnFamily(table, family)
+}
+
+func (n *KVNode) DropColumnFamily(table, family string) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.store.DropColumnFamily(table, family)
+}
+
+func (n *KVNode) DeleteTable(name string) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.store.DeleteTable(name)
+}
+
+func (n *KVNode) GetTable(name string) (*kvstore.TableInfo, error) {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	return n.store.GetTable(name)
+}
+
+func (n *KVNode) DropRowRange(table, prefix string) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.store.DropRowRange(table, prefix)
+}
+
+func (n *KVNode) SampleRowKeys(table string) ([]kvstore.RowSample, error) {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	return n.store.SampleRowKeys(table)
+}
+
+func (n *KVNode) ListTables() ([]kvstore.TableInfo, error) {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	return n.store.ListTables()
+}
+
+func (n *KVNode) MutateRow(table, row string, mutations []kvstore.Mutation) error {
+	defer n.lockWrite([]string{rowLockKey(table, row)})()
+	return n.store.MutateRow(table, row, mutations)
+}
+
+func (n *KVNode) CheckAndMutateRow(table, row string, cond kvstore.Condition, onTrue, onFalse []kvstore.Mutation) (bool, error) {
+	defer n.lockWrite([]string{rowLockKey(table, row)})()
+	return n.store.CheckAndMutateRow(table, row, cond, onTrue, onFalse)
+}
+
+func (n *KVNode) ReadModifyWriteRow(table, row string, rules []kvstore.ReadModifyWriteRule) (*kvstore.Row, error) {
+	defer n.lockWrite([]string{rowLockKey(table, row)})()
+	return n.store.ReadModifyWriteRow(table, row, rules)
+}
+
+func (n *KVNode) ReadRow(table, row string, opts kvstore.ReadOptions) (*kvstore.Row, error) {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	return n.store.ReadRow(table, row, opts)
+}
+
+func (n *KVNode) ReadRows(table, startKey, endKey string, limit int, opts kvstore.ReadOptions) ([]kvstore.Row, string, error) {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	return n.store.ReadRows(table, startKey, endKey, limit, opts)
+}
+
+
+// ReapExpired deletes the expired keys now instead of on the reaper's next
+// round.
+func (n *KVNode) ReapExpired() (int, error) {
+	return n.store.ReapExpired()
+}
 
 func (n *KVNode) Close() error {
 	n.mu.Lock()
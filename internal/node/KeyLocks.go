@@ -0,0 +1,89 @@
+package node
+
+import (
+	"bigtable/internal/kvstore"
+	"hash/maphash"
+	"slices"
+	"sync"
+)
+
+const lockStripes = 256
+
+// keyLocks serializes writers of the same key with a fixed set of striped
+// mutexes. Keys that share a stripe only cost each other some waiting.
+type keyLocks struct {
+	seed    maphash.Seed
+	stripes [lockStripes]sync.Mutex
+}
+
+func newKeyLocks() *keyLocks {
+	return &keyLocks{seed: maphash.MakeSeed()}
+}
+
+// lock takes the stripes of keys in ascending order, so callers locking
+// overlapping sets cannot deadlock, and returns the matching unlock.
+func (l *keyLocks) lock(keys ...string) func() {
+	stripes := make([]int, 0, len(keys))
+	for _, key := range keys {
+		stripes = append(stripes, int(maphash.String(l.seed, key)%lockStripes))
+	}
+	slices.Sort(stripes)
+	stripes = slices.Compact(stripes)
+
+	for _, i := range stripes {
+		l.stripes[i].Lock()
+	}
+	return func() {
+		for _, i := range stripes {
+			l.stripes[i].Unlock()
+		}
+	}
+}
+
+// rowLockKey names the lock of a table row; it cannot clash with a flat key
+// because user keys never start with the internal 0x00 prefix.
+func rowLockKey(table, row string) string {
+	return "\x00t" + table + "\x00" + row
+}
+
+// hasRangeOperation reports whether operations delete a prefix or a range,
+// which no set of key locks covers.
+func hasRangeOperation(operations ...[]kvstore.BatchOperation) bool {
+	for _, ops := range operations {
+		for _, op := range ops {
+			if op.Type == "delete_prefix" || op.Type == "delete_range" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// lockWrite prepares a point write of keys and of every key the operations
+// touch: n.mu shared plus the key stripes, or n.mu exclusive when an
+// operation covers a key range. The exclusive path still takes the stripes of
+// the point keys, because the reaper only holds those.
+func (n *KVNode) lockWrite(keys []string, operations ...[]kvstore.BatchOperation) func() {
+	for _, ops := range operations {
+		for _, op := range ops {
+			if op.Type != "delete_prefix" && op.Type != "delete_range" {
+				keys = append(keys, op.Key)
+			}
+		}
+	}
+
+	if hasRangeOperation(operations...) {
+		n.mu.Lock()
+		unlock := n.locks.lock(keys...)
+		return func() {
+			unlock()
+			n.mu.Unlock()
+		}
+	}
+	n.mu.RLock()
+	unlock := n.locks.lock(keys...)
+	return func() {
+		unlock()
+		n.mu.RUnlock()
+	}
+}
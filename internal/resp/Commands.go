@@ -0,0 +1,525 @@
+package resp
+
+import (
+	"bigtable/internal/kvstore"
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cockroachdb/pebble"
+)
+
+const defaultScanCount = 10
+
+// command arity follows Redis: the number of arguments including the
+// command name, or at least -arity of them when negative.
+type command struct {
+	arity   int
+	handler func(s *Server, c *client, args []string)
+}
+
+var commands map[string]command
+
+func init() {
+	commands = map[string]command{
+		"get":    {2, (*Server).get},
+		"set":    {-3, (*Server).set},
+		"del":    {-2, (*Server).del},
+		"mget":   {-2, (*Server).mget},
+		"mset":   {-3, (*Server).mset},
+		"incr":   {2, (*Server).incr},
+		"scan":   {-2, (*Server).scan},
+		"exists": {-2, (*Server).exists},
+		"ttl":    {2, (*Server).ttl},
+
+		// 접속 관리용: redis-cli 와 클라이언트 라이브러리가 연결 직후 보냄
+		"hello":   {-1, (*Server).hello},
+		"auth":    {-2, (*Server).auth},
+		"ping":    {-1, (*Server).ping},
+		"echo":    {2, (*Server).echo},
+		"select":  {2, (*Server).selectDB},
+		"client":  {-2, (*Server).clientCmd},
+		"command": {-1, (*Server).commandCmd},
+		"quit":    {1, (*Server).quitCmd},
+	}
+}
+
+func (s *Server) dispatch(c *client, args []string) {
+	name := strings.ToLower(args[0])
+	cmd, ok := commands[name]
+	if !ok {
+		var rest []string
+		for _, arg := range args[1:] {
+			rest = append(rest, "'"+arg+"'")
+		}
+		c.w.err("ERR unknown command '" + args[0] + "', with args beginning with: " + strings.Join(rest, " "))
+		return
+	}
+	if (cmd.arity > 0 && len(args) != cmd.arity) || (cmd.arity < 0 && len(args) < -cmd.arity) {
+		c.w.err("ERR wrong number of arguments for '" + name + "' command")
+		return
+	}
+	cmd.handler(s, c, args)
+}
+
+func (c *client) storeError(err error) {
+	c.w.err("ERR " + err.Error())
+}
+
+func (s *Server) get(c *client, args []string) {
+	value, err := s.node.Get(args[1])
+	if errors.Is(err, pebble.ErrNotFound) {
+		c.w.null()
+		return
+	}
+	if err != nil {
+		c.storeError(err)
+		return
+	}
+	c.w.bulk(value)
+}
+
+// set supports SET key value [NX | XX] [EX seconds | PX milliseconds].
+func (s *Server) set(c *client, args []string) {
+	var ttl time.Duration
+	var cond string
+	for i := 3; i < len(args); i++ {
+		switch opt := strings.ToLower(args[i]); opt {
+		case "nx", "xx":
+			if cond != "" {
+				c.w.err("ERR syntax error")
+				return
+			}
+			cond = opt
+		case "ex", "px":
+			if ttl != 0 || i+1 == len(args) {
+				c.w.err("ERR syntax error")
+				return
+			}
+			i++
+			n, err := strconv.ParseInt(args[i], 10, 64)
+			if err != nil {
+				c.w.err("ERR value is not an integer or out of range")
+				return
+			}
+			unit := time.Second
+			if opt == "px" {
+				unit = time.Millisecond
+			}
+			if n <= 0 || n > math.MaxInt64/int64(unit) {
+				c.w.err("ERR invalid expire time in 'set' command")
+				return
+			}
+			ttl = time.Duration(n) * unit
+		default:
+			c.w.err("ERR syntax error")
+			return
+		}
+	}
+
+	if cond == "" {
+		if err := s.node.SetWithTTL(args[1], args[2], ttl); err != nil {
+			c.storeError(err)
+			return
+		}
+		c.w.simple("OK")
+		return
+	}
+
+	condition := kvstore.Condition{Type: "not_exists"}
+	if cond == "xx" {
+		condition.Type = "exists"
+	}
+	written, err := s.node.SetIf(args[1], args[2], ttl, condition)
+	if err != nil {
+		c.storeError(err)
+		return
+	}
+	if !written {
+		c.w.null()
+		return
+	}
+	c.w.simple("OK")
+}
+
+// del removes the keys in one batch and replies with how many existed.
+func (s *Server) del(c *client, args []string) {
+	results, err := s.node.MultiGet(args[1:])
+	if err != nil {
+		c.storeError(err)
+		return
+	}
+
+	var operations []kvstore.BatchOperation
+	seen := make(map[string]bool)
+	for _, result := range results {
+		if result.Found && !seen[result.Key] {
+			seen[result.Key] = true
+			operations = append(operations, kvstore.BatchOperation{Type: "delete", Key: result.Key})
+		}
+	}
+	if len(operations) > 0 {
+		if err := s.node.BatchWrite(operations); err != nil {
+			c.storeError(err)
+			return
+		}
+	}
+	c.w.integer(int64(len(operations)))
+}
+
+func (s *Server) mget(c *client, args []string) {
+	results, err := s.node.MultiGet(args[1:])
+	if err != nil {
+		c.storeError(err)
+		return
+	}
+	c.w.array(len(results))
+	for _, result := range results {
+		if result.Found {
+			c.w.bulk(result.Value)
+		} else {
+			c.w.null()
+		}
+	}
+}
+
+func (s *Server) mset(c *client, args []string) {
+	if len(args)%2 != 1 {
+		c.w.err("ERR wrong number of arguments for 'mset' command")
+		return
+	}
+	operations := make([]kvstore.BatchOperation, 0, len(args)/2)
+	for i := 1; i < len(args); i += 2 {
+		operations = append(operations, kvstore.BatchOperation{Type: "set", Key: args[i], Value: args[i+1]})
+	}
+	if err := s.node.BatchWrite(operations); err != nil {
+		c.storeError(err)
+		return
+	}
+	c.w.simple("OK")
+}
+
+func (s *Server) incr(c *client, args []string) {
+	n, err := s.node.Increment(args[1], 1, "")
+	if err != nil {
+		c.storeError(err)
+		return
+	}
+	c.w.integer(n)
+}
+
+// exists counts a key once per time it is named, like Redis.
+func (s *Server) exists(c *client, args []string) {
+	results, err := s.node.MultiGet(args[1:])
+	if err != nil {
+		c.storeError(err)
+		return
+	}
+	var n int64
+	for _, result := range results {
+		if result.Found {
+			n++
+		}
+	}
+	c.w.integer(n)
+}
+
+// ttl replies with the seconds left, -1 for keys without a TTL and -2 for
+// missing keys.
+func (s *Server) ttl(c *client, args []string) {
+	ttl, err := s.node.TTL(args[1])
+	switch {
+	case errors.Is(err, pebble.ErrNotFound):
+		c.w.integer(-2)
+	case err != nil:
+		c.storeError(err)
+	case ttl == 0:
+		c.w.integer(-1)
+	default:
+		c.w.integer(max(int64((ttl+500*time.Millisecond)/time.Second), 0))
+	}
+}
+
+// scan supports SCAN cursor [MATCH pattern] [COUNT count]. Keys of the
+// internal keyspace are never returned.
+func (s *Server) scan(c *client, args []string) {
+	pattern, count := "*", defaultScanCount
+	for i := 2; i < len(args); i += 2 {
+		if i+1 == len(args) {
+			c.w.err("ERR syntax error")
+			return
+		}
+		switch strings.ToLower(args[i]) {
+		case "match":
+			pattern = args[i+1]
+		case "count":
+			n, err := strconv.Atoi(args[i+1])
+			if err != nil {
+				c.w.err("ERR value is not an integer or out of range")
+				return
+			}
+			if n < 1 {
+				c.w.err("ERR syntax error")
+				return
+			}
+			count = n
+		default:
+			c.w.err("ERR syntax error")
+			return
+		}
+	}
+
+	var cursor string
+	if args[1] != "0" {
+		key, ok := s.cursors.load(args[1])
+		if !ok {
+			c.w.err("ERR invalid cursor")
+			return
+		}
+		cursor = key
+	}
+
+	prefix, re := globPrefix(pattern), globToRegexp(pattern)
+	var keys []string
+	var next string
+	if !strings.HasPrefix(prefix, "\x00") {
+		if prefix == "" && cursor == "" {
+			cursor = "\x01" // skip the internal keyspace
+		}
+		var filter *kvstore.Filter
+		if pattern != "*" {
+			filter = &kvstore.Filter{Type: "key_regex", Pattern: re}
+		}
+		var err error
+		keys, next, err = s.node.ScanKey(prefix, cursor, count, false, filter)
+		if err != nil {
+			c.storeError(err)
+			return
+		}
+	}
+
+	nextCursor := "0"
+	if next != "" {
+		nextCursor = s.cursors.save(next)
+	}
+	c.w.array(2)
+	c.w.bulk(nextCursor)
+	c.w.array(len(keys))
+	for _, key := range keys {
+		c.w.bulk(key)
+	}
+}
+
+// globPrefix returns the literal start of a glob pattern, which bounds the
+// keys a scan has to visit.
+func globPrefix(pattern string) string {
+	var prefix strings.Builder
+	for i := 0; i < len(pattern); i++ {
+		switch ch := pattern[i]; ch {
+		case '*', '?', '[':
+			return prefix.String()
+		case '\\':
+			if i+1 == len(pattern) {
+				return prefix.String()
+			}
+			i++
+			prefix.WriteByte(pattern[i])
+		default:
+			prefix.WriteByte(ch)
+		}
+	}
+	return prefix.String()
+}
+
+// globToRegexp translates a Redis glob (*, ?, [...], [^...] and \ escapes)
+// into an anchored regular expression.
+func globToRegexp(pattern string) string {
+	var re strings.Builder
+	re.WriteString(`(?s)^`)
+	runes := []rune(pattern)
+	for i := 0; i < len(runes); i++ {
+		switch ch := runes[i]; ch {
+		case '*':
+			re.WriteString(`.*`)
+		case '?':
+			re.WriteString(`.`)
+		case '[':
+			end := slices.Index(runes[i+1:], ']')
+			if end < 0 {
+				re.WriteString(`\[`)
+				continue
+			}
+			re.WriteString(globClass(runes[i+1 : i+1+end]))
+			i += end + 1
+		case '\\':
+			if i+1 < len(runes) {
+				i++
+			}
+			re.WriteString(regexp.QuoteMeta(string(runes[i])))
+		default:
+			re.WriteString(regexp.QuoteMeta(string(ch)))
+		}
+	}
+	re.WriteString(`$`)
+	return re.String()
+}
+
+func globClass(class []rune) string {
+	negate := len(class) > 0 && class[0] == '^'
+	if negate {
+		class = class[1:]
+	}
+	if len(class) == 0 {
+		if negate {
+			return `.`
+		}
+		return `[^\x00-\x{10FFFF}]` // an empty class matches nothing
+	}
+
+	var re strings.Builder
+	re.WriteByte('[')
+	if negate {
+		re.WriteByte('^')
+	}
+	for i := 0; i < len(class); i++ {
+		ch := class[i]
+		if ch == '\\' && i+1 < len(class) {
+			i++
+			ch = class[i]
+		} else if ch == '-' && i > 0 && i+1 < len(class) {
+			re.WriteByte('-')
+			continue
+		}
+		fmt.Fprintf(&re, `\x{%x}`, ch)
+	}
+	re.WriteByte(']')
+	return re.String()
+}
+
+// hello switches the protocol version: HELLO [protover [AUTH user pass]
+// [SETNAME name]].
+func (s *Server) hello(c *client, args []string) {
+	proto := c.w.proto
+	if len(args) > 1 {
+		n, err := strconv.Atoi(args[1])
+		if err != nil {
+			c.w.err("ERR Protocol version is not an integer or out of range")
+			return
+		}
+		if n != 2 && n != 3 {
+			c.w.err("NOPROTO unsupported protocol version")
+			return
+		}
+		proto = n
+	}
+	for i := 2; i < len(args); i++ {
+		switch strings.ToLower(args[i]) {
+		case "auth":
+			// No users are configured, which Redis treats as "nopass"
+			if i+2 >= len(args) {
+				c.w.err("ERR syntax error")
+				return
+			}
+			i += 2
+		case "setname":
+			if i+1 >= len(args) {
+				c.w.err("ERR syntax error")
+				return
+			}
+			i++
+			c.name = args[i]
+		default:
+			c.w.err("ERR syntax error")
+			return
+		}
+	}
+
+	c.w.proto = proto
+	c.w.mapHeader(7)
+	c.w.bulk("server")
+	c.w.bulk("bigtable")
+	c.w.bulk("version")
+	c.w.bulk("7.0.0") // the Redis version whose protocol is spoken
+	c.w.bulk("proto")
+	c.w.integer(int64(proto))
+	c.w.bulk("id")
+	c.w.integer(c.id)
+	c.w.bulk("mode")
+	c.w.bulk("standalone")
+	c.w.bulk("role")
+	c.w.bulk("master")
+	c.w.bulk("modules")
+	c.w.array(0)
+}
+
+func (s *Server) auth(c *client, args []string) {
+	if len(args) > 3 {
+		c.w.err("ERR syntax error")
+		return
+	}
+	c.w.simple("OK")
+}
+
+func (s *Server) ping(c *client, args []string) {
+	switch len(args) {
+	case 1:
+		c.w.simple("PONG")
+	case 2:
+		c.w.bulk(args[1])
+	default:
+		c.w.err("ERR wrong number of arguments for 'ping' command")
+	}
+}
+
+func (s *Server) echo(c *client, args []string) {
+	c.w.bulk(args[1])
+}
+
+// selectDB accepts only database 0; there is a single keyspace.
+func (s *Server) selectDB(c *client, args []string) {
+	if args[1] != "0" {
+		c.w.err("ERR DB index is out of range")
+		return
+	}
+	c.w.simple("OK")
+}
+
+func (s *Server) clientCmd(c *client, args []string) {
+	switch strings.ToLower(args[1]) {
+	case "setname":
+		if len(args) != 3 {
+			c.w.err("ERR wrong number of arguments for 'client|setname' command")
+			return
+		}
+		c.name = args[2]
+		c.w.simple("OK")
+	case "getname":
+		if c.name == "" {
+			c.w.null()
+		} else {
+			c.w.bulk(c.name)
+		}
+	case "id":
+		c.w.integer(c.id)
+	case "setinfo":
+		c.w.simple("OK")
+	default:
+		c.w.err("ERR unknown subcommand '" + args[1] + "'")
+	}
+}
+
+// commandCmd answers COMMAND with an empty list; redis-cli only uses it for
+// hints.
+func (s *Server) commandCmd(c *client, args []string) {
+	c.w.array(0)
+}
+
+func (s *Server) quitCmd(c *client, args []string) {
+	c.w.simple("OK")
+	c.quit = true
+}
@@ -0,0 +1,69 @@
+package resp
+
+import (
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	cursorTTL  = 10 * time.Minute
+	maxCursors = 100000
+)
+
+// cursorRegistry hands out the numeric cursors SCAN replies with. Redis
+// clients parse cursors as integers, while kvstore resumes from a key, so the
+// key is kept here under a number. Pooled clients may continue a scan on
+// another connection, so the registry is shared by the whole server.
+type cursorRegistry struct {
+	mu      sync.Mutex
+	next    uint64
+	entries map[uint64]cursorEntry
+}
+
+type cursorEntry struct {
+	key      string
+	lastUsed time.Time
+}
+
+func newCursorRegistry() *cursorRegistry {
+	return &cursorRegistry{entries: make(map[uint64]cursorEntry)}
+}
+
+// save stores key and returns its cursor, never "0", which ends a scan.
+func (r *cursorRegistry) save(key string) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	if len(r.entries) >= maxCursors {
+		for id, entry := range r.entries {
+			if now.Sub(entry.lastUsed) > cursorTTL || len(r.entries) >= maxCursors {
+				delete(r.entries, id)
+			}
+		}
+	}
+	r.next++
+	r.entries[r.next] = cursorEntry{key: key, lastUsed: now}
+	return strconv.FormatUint(r.next, 10)
+}
+
+// load returns the key behind cursor. A scan may be retried with the same
+// cursor, so it stays valid until it expires.
+func (r *cursorRegistry) load(cursor string) (string, bool) {
+	id, err := strconv.ParseUint(cursor, 10, 64)
+	if err != nil {
+		return "", false
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	entry, ok := r.entries[id]
+	if !ok || time.Since(entry.lastUsed) > cursorTTL {
+		delete(r.entries, id)
+		return "", false
+	}
+	entry.lastUsed = time.Now()
+	r.entries[id] = entry
+	return entry.key, true
+}
@@ -0,0 +1,137 @@
+package resp
+
+import (
+	"bigtable/internal/node"
+	"bufio"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"sync"
+	"sync/atomic"
+)
+
+// Server speaks the Redis protocol (RESP2, and RESP3 after HELLO 3) and maps
+// a subset of Redis string commands onto a KVNode.
+type Server struct {
+	node    *node.KVNode
+	cursors *cursorRegistry
+
+	nextID atomic.Int64
+
+	mu       sync.Mutex
+	listener net.Listener
+	conns    map[net.Conn]struct{}
+	closed   bool
+	wg       sync.WaitGroup
+}
+
+func NewServer(node *node.KVNode) *Server {
+	return &Server{
+		node:    node,
+		cursors: newCursorRegistry(),
+		conns:   make(map[net.Conn]struct{}),
+	}
+}
+
+// client is the per-connection state.
+type client struct {
+	id   int64
+	name string
+	w    *writer
+	quit bool
+}
+
+// Serve accepts connections on listener until Close is called.
+func (s *Server) Serve(listener net.Listener) error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return net.ErrClosed
+	}
+	s.listener = listener
+	s.mu.Unlock()
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			s.mu.Lock()
+			closed := s.closed
+			s.mu.Unlock()
+			if closed {
+				return nil
+			}
+			return err
+		}
+
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			conn.Close()
+			return nil
+		}
+		s.conns[conn] = struct{}{}
+		s.wg.Add(1)
+		s.mu.Unlock()
+
+		go s.serveConn(conn)
+	}
+}
+
+// Close stops accepting, closes every open connection and waits for their
+// handlers to return.
+func (s *Server) Close() error {
+	s.mu.Lock()
+	s.closed = true
+	var err error
+	if s.listener != nil {
+		err = s.listener.Close()
+	}
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.mu.Unlock()
+
+	s.wg.Wait()
+	return err
+}
+
+func (s *Server) serveConn(conn net.Conn) {
+	defer func() {
+		conn.Close()
+		s.mu.Lock()
+		delete(s.conns, conn)
+		s.mu.Unlock()
+		s.wg.Done()
+	}()
+
+	r := bufio.NewReader(conn)
+	c := &client{
+		id: s.nextID.Add(1),
+		w:  &writer{Writer: bufio.NewWriter(conn), proto: 2},
+	}
+	for !c.quit {
+		args, err := readCommand(r)
+		if err != nil {
+			if errors.Is(err, errProtocol) {
+				c.w.err("ERR Protocol error: " + err.Error())
+				c.w.Flush()
+			} else if !errors.Is(err, io.EOF) && !errors.Is(err, net.ErrClosed) {
+				log.Printf("RESP connection %s failed: %v", conn.RemoteAddr(), err)
+			}
+			return
+		}
+		if len(args) == 0 {
+			continue
+		}
+		s.dispatch(c, args)
+
+		// Pipelined commands are answered in one write
+		if r.Buffered() == 0 {
+			if err := c.w.Flush(); err != nil {
+				return
+			}
+		}
+	}
+	c.w.Flush()
+}
@@ -0,0 +1,96 @@
+package rest
+
+import (
+	"bigtable/internal/backup"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"net/http"
+)
+
+// BackupVerifyResponse is returned by POST /v1/admin/backups/{name}/verify.
+type BackupVerifyResponse struct {
+	Name  string `json:"name"`
+	Valid bool   `json:"valid"`
+	Files int    `json:"files"`
+	Error string `json:"error,omitempty"`
+}
+
+// SetBackups enables the /v1/admin/backups endpoints.
+func (s *KVStoreService) SetBackups(backups *backup.Manager) {
+	s.backups = backups
+}
+
+func (s *KVStoreService) backupsConfigured(w http.ResponseWriter) bool {
+	if s.backups == nil {
+		writeError(w, http.StatusNotFound, CodeNotFound, "backups are not configured")
+		return false
+	}
+	return true
+}
+
+// HandleBackupCreate serves POST /v1/admin/backups. It writes a checkpoint
+// of the running database with its manifest into the backup directory and
+// answers 201 once it is complete.
+func (s *KVStoreService) HandleBackupCreate(w http.ResponseWriter, r *http.Request) {
+	if !s.backupsConfigured(w) {
+		return
+	}
+	info, err := s.backups.Create()
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(info)
+}
+
+// HandleBackupList serves GET /v1/admin/backups, the complete backups oldest
+// first.
+func (s *KVStoreService) HandleBackupList(w http.ResponseWriter, r *http.Request) {
+	if !s.backupsConfigured(w) {
+		return
+	}
+	backups, err := s.backups.List()
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	if backups == nil {
+		backups = []backup.Info{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"backups": backups})
+}
+
+// HandleBackupVerify serves POST /v1/admin/backups/{name}/verify. A backup
+// that does not match its manifest is reported with valid=false.
+func (s *KVStoreService) HandleBackupVerify(w http.ResponseWriter, r *http.Request) {
+	if !s.backupsConfigured(w) {
+		return
+	}
+	name := r.PathValue("name")
+	manifest, err := s.backups.Verify(name)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		writeError(w, http.StatusNotFound, CodeNotFound, "no such backup: "+name)
+		return
+	case errors.Is(err, backup.ErrInvalidName):
+		writeError(w, http.StatusBadRequest, CodeInvalidArgument, err.Error())
+		return
+	case err != nil && !errors.Is(err, backup.ErrCorrupt):
+		writeStoreError(w, err)
+		return
+	}
+
+	response := BackupVerifyResponse{Name: name, Valid: err == nil}
+	if manifest != nil {
+		response.Files = len(manifest.Files)
+	}
+	if err != nil {
+		response.Error = err.Error()
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
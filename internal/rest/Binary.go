@@ -0,0 +1,89 @@
+package rest
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// maxValueBytes bounds the raw values accepted by application/octet-stream
+// requests.
+const maxValueBytes = 64 << 20
+
+// byteCodec carries keys and values through JSON and query strings. JSON can
+// only hold valid UTF-8, so requests with encoding=base64 send and receive
+// every key, value and plain (non-snapshot) cursor as standard base64 and
+// round-trip arbitrary bytes exactly.
+type byteCodec struct {
+	base64 bool
+}
+
+func requestCodec(r *http.Request) (byteCodec, error) {
+	switch encoding := r.URL.Query().Get("encoding"); encoding {
+	case "", "text":
+		return byteCodec{}, nil
+	case "base64":
+		return byteCodec{base64: true}, nil
+	default:
+		return byteCodec{}, fmt.Errorf("Invalid encoding parameter: %s", encoding)
+	}
+}
+
+func (c byteCodec) decode(s string) (string, error) {
+	if !c.base64 {
+		return s, nil
+	}
+	data, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return "", fmt.Errorf("invalid base64: %v", err)
+	}
+	return string(data), nil
+}
+
+func (c byteCodec) encode(s string) string {
+	if !c.base64 {
+		return s
+	}
+	return base64.StdEncoding.EncodeToString([]byte(s))
+}
+
+func (c byteCodec) encodeAll(values []string) []string {
+	if !c.base64 {
+		return values
+	}
+	encoded := make([]string, len(values))
+	for i, v := range values {
+		encoded[i] = c.encode(v)
+	}
+	return encoded
+}
+
+// query returns the decoded query parameter name.
+func (c byteCodec) query(r *http.Request, name string) (string, error) {
+	value, err := c.decode(r.URL.Query().Get(name))
+	if err != nil {
+		return "", fmt.Errorf("Invalid %s parameter: %v", name, err)
+	}
+	return value, nil
+}
+
+func isOctetStream(r *http.Request) bool {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return mediaType == "application/octet-stream"
+}
+
+func acceptsOctetStream(r *http.Request) bool {
+	return strings.Contains(r.Header.Get("Accept"), "application/octet-stream")
+}
+
+// readRawValue reads an application/octet-stream body as the value.
+func readRawValue(w http.ResponseWriter, r *http.Request) (string, error) {
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxValueBytes))
+	if err != nil {
+		return "", fmt.Errorf("Failed to read value: %w", err)
+	}
+	return string(data), nil
+}
@@ -0,0 +1,21 @@
+package rest
+
+import (
+	"bigtable/internal/kvstore"
+	"net/http"
+)
+
+// DurabilityHeader chooses the durability of a write like the durability
+// query parameter, which wins when both are set.
+const DurabilityHeader = "X-Durability"
+
+// writeOptions reads durability=sync|nosync|group-sync[:<duration>] from the
+// query or the X-Durability header; without either the server default
+// applies.
+func writeOptions(r *http.Request) (kvstore.WriteOptions, error) {
+	durability := r.URL.Query().Get("durability")
+	if durability == "" {
+		durability = r.Header.Get(DurabilityHeader)
+	}
+	return kvstore.ParseWriteOptions(durability)
+}
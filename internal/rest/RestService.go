@@ -1,9 +1,12 @@
 package rest
 
 import (
+	"bigtable/internal/backup"
 	"bigtable/internal/kvstore"
 	"bigtable/internal/node"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
 	"net/http"
 	"strconv"
@@ -12,33 +15,95 @@ import (
 
 
 type KVPair struct {
-    Type  string      `json:"type"`
-    Key   string      `json:"key"`
-    Value interface{} `json:"value"`
+    Type     string      `json:"type"`
+    Key      string      `json:"key"`
+    EndKey   string      `json:"endKey,omitempty"` // delete_range only
+    Value    interface{} `json:"value"`
+    TTL      int64       `json:"ttl,omitempty"` // seconds
+    Encoding string      `json:"encoding,omitempty"` // increment/append only
 }
 
 type RESTService interface{
 	HandleSet(w http.ResponseWriter, r *http.Request)
 	HandleGet(w http.ResponseWriter, r *http.Request)
+	HandleMultiGet(w http.ResponseWriter, r *http.Request)
 	HandleDelete(w http.ResponseWriter, r *http.Request)
+	HandleDeletePrefix(w http.ResponseWriter, r *http.Request)
+	HandleDeleteRange(w http.ResponseWriter, r *http.Request)
 	HandleRange(w http.ResponseWriter, r *http.Request)
 	HandleBatch(w http.ResponseWriter, r *http.Request)
 	HandleScanKey(w http.ResponseWriter,r *http.Request)
 	HandleScanValueByKey(w http.ResponseWriter,r *http.Request)
 	HandleScanKeysLower(w http.ResponseWriter, r *http.Request)
+	HandleScanStream(w http.ResponseWriter, r *http.Request)
+	HandleReleaseSnapshot(w http.ResponseWriter, r *http.Request)
 	HandleScanOffset(w http.ResponseWriter, r *http.Request)
 	HandleTotalKey(w http.ResponseWriter, r *http.Request)
+	HandlePrefixCounter(w http.ResponseWriter, r *http.Request)
+	HandleAggregate(w http.ResponseWriter, r *http.Request)
+	HandleCheckAndMutate(w http.ResponseWriter, r *http.Request)
+	HandleIncrement(w http.ResponseWriter, r *http.Request)
+	HandleAppend(w http.ResponseWriter, r *http.Request)
+
+	HandleCreateTable(w http.ResponseWriter, r *http.Request)
+	HandleListTables(w http.ResponseWriter, r *http.Request)
+	HandleDeleteTable(w http.ResponseWriter, r *http.Request)
+	HandleSetColumnFamily(w http.ResponseWriter, r *http.Request)
+	HandleDropColumnFamily(w http.ResponseWriter, r *http.Request)
+	HandleMutateRow(w http.ResponseWriter, r *http.Request)
+	HandleReadRow(w http.ResponseWriter, r *http.Request)
+	HandleReadRows(w http.ResponseWriter, r *http.Request)
+
+	HandleKVGet(w http.ResponseWriter, r *http.Request)
+	HandleKVPut(w http.ResponseWriter, r *http.Request)
+	HandleKVDelete(w http.ResponseWriter, r *http.Request)
+	HandleV1Batch(w http.ResponseWriter, r *http.Request)
+
+	HandleTxnBegin(w http.ResponseWriter, r *http.Request)
+	HandleTxnGet(w http.ResponseWriter, r *http.Request)
+	HandleTxnPut(w http.ResponseWriter, r *http.Request)
+	HandleTxnDelete(w http.ResponseWriter, r *http.Request)
+	HandleTxnBatch(w http.ResponseWriter, r *http.Request)
+	HandleTxnCommit(w http.ResponseWriter, r *http.Request)
+	HandleTxnRollback(w http.ResponseWriter, r *http.Request)
+
+	HandleWatch(w http.ResponseWriter, r *http.Request)
+	HandleWatchWebSocket(w http.ResponseWriter, r *http.Request)
+
+	HandleBackupCreate(w http.ResponseWriter, r *http.Request)
+	HandleBackupList(w http.ResponseWriter, r *http.Request)
+	HandleBackupVerify(w http.ResponseWriter, r *http.Request)
 }
 
 
 
+const (
+	maxMultiGetKeys = 10000
+	maxRangeLimit   = 10000
+
+	defaultCountScanLimit = 1000000
+)
+
 type ScanKeyResponse struct {
 	Keys       []string `json:"keys"`
 	NextCursor string   `json:"nextCursor"`
 }
 
+type TotalKeyResponse struct {
+	Prefix   string              `json:"prefix"`
+	Estimate kvstore.KeyEstimate `json:"estimate"`
+	Exact    *int                `json:"exact,omitempty"`
+	Complete *bool               `json:"complete,omitempty"`
+}
+
+type RangeResponse struct {
+	Items      []kvstore.KeyValue `json:"items"`
+	NextCursor string             `json:"nextCursor"`
+}
+
 type KVStoreService struct {
-	node *node.KVNode
+	node    *node.KVNode
+	backups *backup.Manager // nil when backups are not configured
 }
 
 func NewKVStoreService(node *node.KVNode) *KVStoreService {
@@ -46,121 +111,564 @@ func NewKVStoreService(node *node.KVNode) *KVStoreService {
 }
 
 
+// HandleSet stores a JSON value by default. An application/octet-stream body
+// (POST or PUT, key and ttl in the query) is stored byte for byte, and so is
+// a base64 value with encoding=base64.
 func (s *KVStoreService) HandleSet(w http.ResponseWriter, r *http.Request) {
+    codec, err := requestCodec(r)
+    if err != nil {
+        http.Error(w, err.Error(), http.StatusBadRequest)
+        return
+    }
+    opts, err := writeOptions(r)
+    if err != nil {
+        http.Error(w, err.Error(), http.StatusBadRequest)
+        return
+    }
+
     var data struct {
         Key   string      `json:"key"`
         Value interface{} `json:"value"`
+        TTL   int64       `json:"ttl"` // seconds, 0 means no expiry
     }
+    var value string
 
-    if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
-        log.Printf("JSON decode error: %v", err)
-        http.Error(w, "Invalid JSON", http.StatusBadRequest)
-        return
+    if isOctetStream(r) {
+        if r.Method != http.MethodPost && r.Method != http.MethodPut {
+            http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+            return
+        }
+        if data.Key, err = codec.query(r, "key"); err != nil {
+            http.Error(w, err.Error(), http.StatusBadRequest)
+            return
+        }
+        if ttl := r.URL.Query().Get("ttl"); ttl != "" {
+            if data.TTL, err = strconv.ParseInt(ttl, 10, 64); err != nil {
+                http.Error(w, "Invalid ttl", http.StatusBadRequest)
+                return
+            }
+        }
+        if value, err = readRawValue(w, r); err != nil {
+            http.Error(w, err.Error(), http.StatusBadRequest)
+            return
+        }
+    } else {
+        if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+            log.Printf("JSON decode error: %v", err)
+            http.Error(w, "Invalid JSON", http.StatusBadRequest)
+            return
+        }
+        if value, err = encodeValue(codec, data.Value); err != nil {
+            http.Error(w, err.Error(), http.StatusBadRequest)
+            return
+        }
+        if data.Key, err = codec.decode(data.Key); err != nil {
+            http.Error(w, "Invalid key: "+err.Error(), http.StatusBadRequest)
+            return
+        }
     }
 
-    // value를 JSON으로 직렬화
-    valueJSON, err := json.Marshal(data.Value)
-    if err != nil {
-        log.Printf("JSON marshal error: %v", err)
-        http.Error(w, "Failed to process value", http.StatusInternalServerError)
+    if data.Key == "" {
+        http.Error(w, "Key is required", http.StatusBadRequest)
+        return
+    }
+    if data.TTL < 0 {
+        http.Error(w, "Invalid ttl", http.StatusBadRequest)
         return
     }
 
-    if err := s.node.Set(data.Key, string(valueJSON)); err != nil {
+    if err := s.node.SetWithOptions(data.Key, value, time.Duration(data.TTL)*time.Second, opts); err != nil {
         log.Printf("Set error: %v", err)
-        http.Error(w, err.Error(), http.StatusInternalServerError)
+        http.Error(w, err.Error(), storeErrorStatus(err))
         return
     }
 
     w.WriteHeader(http.StatusOK)
 }
 
-func (s *KVStoreService) HandleBatch(w http.ResponseWriter, r *http.Request) {
-    var operations []KVPair
-    if err := json.NewDecoder(r.Body).Decode(&operations); err != nil {
-        log.Printf("JSON decode error: %v", err)
-        http.Error(w, "Invalid JSON", http.StatusBadRequest)
-        return
+// encodeValue turns a decoded JSON value into the stored bytes: the JSON
+// text itself, or the decoded bytes of a base64 string with encoding=base64.
+func encodeValue(codec byteCodec, value interface{}) (string, error) {
+    if codec.base64 {
+        encoded, ok := value.(string)
+        if !ok {
+            return "", errors.New("Invalid value: expected a base64 string")
+        }
+        raw, err := codec.decode(encoded)
+        if err != nil {
+            return "", fmt.Errorf("Invalid value: %v", err)
+        }
+        return raw, nil
     }
 
+    // value를 JSON으로 직렬화
+    valueJSON, err := json.Marshal(value)
+    if err != nil {
+        return "", fmt.Errorf("Failed to process value: %v", err)
+    }
+    return string(valueJSON), nil
+}
+
+func toBatchOperations(operations []KVPair, codec byteCodec) ([]kvstore.BatchOperation, error) {
     batchOps := make([]kvstore.BatchOperation, len(operations))
     for i, op := range operations {
-        valueJSON, err := json.Marshal(op.Value)
+        key, err := codec.decode(op.Key)
         if err != nil {
-            log.Printf("JSON marshal error for key %s: %v", op.Key, err)
-            http.Error(w, "Failed to process value", http.StatusInternalServerError)
-            return
+            return nil, fmt.Errorf("key %s: %v", op.Key, err)
+        }
+        endKey, err := codec.decode(op.EndKey)
+        if err != nil {
+            return nil, fmt.Errorf("endKey %s: %v", op.EndKey, err)
         }
-
         batchOps[i] = kvstore.BatchOperation{
-            Type:  op.Type,
-            Key:   op.Key,
-            Value: string(valueJSON),
+            Type:     op.Type,
+            Key:      key,
+            EndKey:   endKey,
+            TTL:      op.TTL,
+            Encoding: op.Encoding,
+        }
+
+        switch {
+        case op.Type == "delete" || op.Type == "delete_prefix" || op.Type == "delete_range":
+            continue
+        case op.Type == "increment":
+            // the delta is a number in every encoding
+            delta, err := json.Marshal(op.Value)
+            if err != nil {
+                return nil, fmt.Errorf("key %s: %v", op.Key, err)
+            }
+            batchOps[i].Value = string(delta)
+            continue
+        }
+
+        // append takes the raw suffix, everything else is stored as JSON
+        if suffix, ok := op.Value.(string); ok && op.Type == "append" && !codec.base64 {
+            batchOps[i].Value = suffix
+            continue
+        }
+        value, err := encodeValue(codec, op.Value)
+        if err != nil {
+            return nil, fmt.Errorf("key %s: %v", op.Key, err)
         }
+        batchOps[i].Value = value
+    }
+    return batchOps, nil
+}
+
+func (s *KVStoreService) HandleBatch(w http.ResponseWriter, r *http.Request) {
+    codec, err := requestCodec(r)
+    if err != nil {
+        http.Error(w, err.Error(), http.StatusBadRequest)
+        return
+    }
+    opts, err := writeOptions(r)
+    if err != nil {
+        http.Error(w, err.Error(), http.StatusBadRequest)
+        return
+    }
+
+    var operations []KVPair
+    if err := json.NewDecoder(r.Body).Decode(&operations); err != nil {
+        log.Printf("JSON decode error: %v", err)
+        http.Error(w, "Invalid JSON", http.StatusBadRequest)
+        return
+    }
+
+    batchOps, err := toBatchOperations(operations, codec)
+    if err != nil {
+        http.Error(w, "Failed to process value: "+err.Error(), http.StatusBadRequest)
+        return
     }
 
-    if err := s.node.BatchWrite(batchOps); err != nil {
+    results, err := s.node.BatchWriteWithOptions(batchOps, opts)
+    if err != nil {
         log.Printf("Batch operation error: %v", err)
-        http.Error(w, err.Error(), http.StatusInternalServerError)
+        http.Error(w, err.Error(), storeErrorStatus(err))
         return
     }
 
+    response := map[string]interface{}{"message": "Batch operation successful"}
+    for i, op := range batchOps {
+        if op.Type == "append" {
+            results[i] = codec.encode(results[i])
+        }
+        if op.Type == "increment" || op.Type == "append" {
+            response["results"] = results
+        }
+    }
+
     w.WriteHeader(http.StatusOK)
-    json.NewEncoder(w).Encode(map[string]string{"message": "Batch operation successful"})
+    json.NewEncoder(w).Encode(response)
 }
 
+// HandleGet writes the stored value as is. Accept: application/octet-stream
+// labels it as raw bytes; encoding=base64 wraps it in {"key","value"} JSON.
 func (s *KVStoreService) HandleGet(w http.ResponseWriter, r *http.Request) {
-    key := r.URL.Query().Get("key")
+    codec, err := requestCodec(r)
+    if err != nil {
+        http.Error(w, err.Error(), http.StatusBadRequest)
+        return
+    }
+    key, err := codec.query(r, "key")
+    if err != nil {
+        http.Error(w, err.Error(), http.StatusBadRequest)
+        return
+    }
     if key == "" {
         http.Error(w, "Key is required", http.StatusBadRequest)
         return
     }
 
-    value, err := s.node.Get(key)
+    value, version, err := s.node.GetWithVersion(key)
+    if errors.Is(err, kvstore.ErrReservedKey) {
+        http.Error(w, err.Error(), http.StatusBadRequest)
+        return
+    }
     if err != nil {
         log.Printf("NO DATA FOUND")
         http.Error(w, err.Error(), http.StatusNoContent)
         return
     }
 
-    // value가 이미 JSON 형식이라고 가정
+    writeValue(w, r, codec, key, value, version)
+}
+
+func writeValue(w http.ResponseWriter, r *http.Request, codec byteCodec, key, value string, version int64) {
+    w.Header().Set("X-Version", strconv.FormatInt(version, 10))
+    switch {
+    case acceptsOctetStream(r):
+        w.Header().Set("Content-Type", "application/octet-stream")
+        w.Write([]byte(value))
+    case codec.base64:
+        w.Header().Set("Content-Type", "application/json")
+        json.NewEncoder(w).Encode(kvstore.KeyValue{Key: codec.encode(key), Value: codec.encode(value)})
+    default:
+        // value가 이미 JSON 형식이라고 가정
+        w.Header().Set("Content-Type", "application/json")
+        w.Write([]byte(value))
+    }
+}
+
+func (s *KVStoreService) HandleMultiGet(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodPost {
+        http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+        return
+    }
+
+    codec, err := requestCodec(r)
+    if err != nil {
+        http.Error(w, err.Error(), http.StatusBadRequest)
+        return
+    }
+
+    var keys []string
+    if err := json.NewDecoder(r.Body).Decode(&keys); err != nil {
+        log.Printf("JSON decode error: %v", err)
+        http.Error(w, "Invalid JSON", http.StatusBadRequest)
+        return
+    }
+    if len(keys) > maxMultiGetKeys {
+        http.Error(w, fmt.Sprintf("At most %d keys per request", maxMultiGetKeys), http.StatusBadRequest)
+        return
+    }
+    for i := range keys {
+        if keys[i], err = codec.decode(keys[i]); err != nil {
+            http.Error(w, "Invalid key: "+err.Error(), http.StatusBadRequest)
+            return
+        }
+    }
+
+    results, err := s.node.MultiGet(keys)
+    if err != nil {
+        http.Error(w, "Error reading keys: "+err.Error(), storeErrorStatus(err))
+        return
+    }
+
+    type multiGetEntry struct {
+        Key   string      `json:"key"`
+        Found bool        `json:"found"`
+        Value interface{} `json:"value,omitempty"`
+    }
+    entries := make([]multiGetEntry, len(results))
+    for i, result := range results {
+        entries[i] = multiGetEntry{Key: codec.encode(result.Key), Found: result.Found}
+        switch {
+        case !result.Found:
+        case codec.base64:
+            entries[i].Value = codec.encode(result.Value)
+        default:
+            entries[i].Value = jsonValue(result.Value)
+        }
+    }
+
     w.Header().Set("Content-Type", "application/json")
-    w.Write([]byte(value))
+    json.NewEncoder(w).Encode(map[string]interface{}{"results": entries})
 }
 
 func (s *KVStoreService) HandleDelete(w http.ResponseWriter, r *http.Request) {
-	key := r.URL.Query().Get("key")
+	codec, err := requestCodec(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	key, err := codec.query(r, "key")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 	if key == "" {
 		http.Error(w, "Key is required", http.StatusBadRequest)
 		return
 	}
+	opts, err := writeOptions(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
-	if err := s.node.Delete(key); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	if err := s.node.DeleteWithOptions(key, opts); err != nil {
+		http.Error(w, err.Error(), storeErrorStatus(err))
 		return
 	}
 
 	w.WriteHeader(http.StatusOK)
 }
 
+// HandleDeletePrefix removes every key under prefix with one range tombstone.
+// dryRun=true only counts the keys that would go.
+func (s *KVStoreService) HandleDeletePrefix(w http.ResponseWriter, r *http.Request) {
+	codec, err := requestCodec(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	prefix, err := codec.query(r, "prefix")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if prefix == "" {
+		http.Error(w, "Missing prefix parameter", http.StatusBadRequest)
+		return
+	}
+
+	s.deleteKeys(w, r,
+		func(maxScan int) (int, bool, error) { return s.node.CountKeys(prefix, maxScan) },
+		func() error { return s.node.DeletePrefix(prefix) })
+}
+
+// HandleDeleteRange removes every key in [startKey, endKey).
+func (s *KVStoreService) HandleDeleteRange(w http.ResponseWriter, r *http.Request) {
+	codec, err := requestCodec(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	startKey, err1 := codec.query(r, "startKey")
+	endKey, err2 := codec.query(r, "endKey")
+	if err := errors.Join(err1, err2); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if endKey == "" {
+		http.Error(w, "Missing endKey parameter", http.StatusBadRequest)
+		return
+	}
+
+	s.deleteKeys(w, r,
+		func(maxScan int) (int, bool, error) { return s.node.CountRange(startKey, endKey, maxScan) },
+		func() error { return s.node.DeleteRange(startKey, endKey) })
+}
+
+func (s *KVStoreService) deleteKeys(w http.ResponseWriter, r *http.Request, count func(maxScan int) (int, bool, error), remove func() error) {
+	if dryRun, _ := strconv.ParseBool(r.URL.Query().Get("dryRun")); dryRun {
+		total, complete, err := count(defaultCountScanLimit)
+		if err != nil {
+			http.Error(w, err.Error(), storeErrorStatus(err))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"count": total, "complete": complete})
+		return
+	}
+
+	if r.Method != http.MethodPost && r.Method != http.MethodDelete {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := remove(); err != nil {
+		http.Error(w, err.Error(), storeErrorStatus(err))
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// storeErrorStatus is 400 for requests the store rejects and 500 for every
+// other store error.
+func storeErrorStatus(err error) int {
+	if errors.Is(err, kvstore.ErrInvalidRange) || errors.Is(err, kvstore.ErrReservedKey) ||
+		errors.Is(err, kvstore.ErrInvalidOperation) {
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
+
 func (s *KVStoreService) HandleRange(w http.ResponseWriter, r *http.Request){
-	startKey := r.URL.Query().Get("startKey")
-	endKey := r.URL.Query().Get("endKey")
-	if startKey == "" || endKey == "" {
-		http.Error(w, "Both startKey and endKey are required", http.StatusBadRequest)
+	codec, err := requestCodec(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
+	opts, err := parseRangeOptions(r, codec)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if opts.Limit == 0 {
+		opts.Limit = 1000 // Default limit
+	}
+	opts.Limit = min(opts.Limit, maxRangeLimit)
 
-	result, err := s.node.RangeQuery(startKey, endKey)
+	items, nextCursor, err := s.node.RangeQuery(opts)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	json.NewEncoder(w).Encode(result)
+	w.Header().Set("Content-Type", "application/json")
+	if codec.base64 {
+		for i := range items {
+			items[i] = kvstore.KeyValue{Key: codec.encode(items[i].Key), Value: codec.encode(items[i].Value)}
+		}
+	}
+	json.NewEncoder(w).Encode(RangeResponse{Items: items, NextCursor: codec.encode(nextCursor)})
+}
+
+// parseRangeOptions reads prefix or startKey/endKey with their bound flags,
+// cursor, limit and reverse, decoding keys with codec. A missing limit is
+// left at 0.
+func parseRangeOptions(r *http.Request, codec byteCodec) (kvstore.RangeOptions, error) {
+	query := r.URL.Query()
+	opts := kvstore.RangeOptions{Reverse: isReverse(r)}
+	opts.StartExclusive, _ = strconv.ParseBool(query.Get("startExclusive"))
+	opts.EndInclusive, _ = strconv.ParseBool(query.Get("endInclusive"))
+
+	var err1, err2, err3, err4 error
+	opts.StartKey, err1 = codec.query(r, "startKey")
+	opts.EndKey, err2 = codec.query(r, "endKey")
+	opts.Cursor, err3 = codec.query(r, "cursor")
+	prefix, err4 := codec.query(r, "prefix")
+	if err := errors.Join(err1, err2, err3, err4); err != nil {
+		return opts, err
+	}
+
+	if prefix != "" {
+		if opts.StartKey != "" || opts.EndKey != "" {
+			return opts, errors.New("prefix cannot be combined with startKey or endKey")
+		}
+		opts.StartKey, opts.EndKey = prefix, kvstore.PrefixEnd(prefix)
+	}
+
+	if limitStr := query.Get("limit"); limitStr != "" {
+		limit, err := strconv.Atoi(limitStr)
+		if err != nil || limit <= 0 {
+			return opts, errors.New("Invalid limit parameter")
+		}
+		opts.Limit = limit
+	}
+
+	filter, err := parseFilter(r)
+	if err != nil {
+		return opts, err
+	}
+	opts.Filter = filter
+	return opts, nil
 }
 
 
+// isConsistent reports whether a scan should be pinned to a snapshot. The
+// cursor of such a scan is opaque and must be sent back with consistent=true.
+func isConsistent(r *http.Request) bool {
+	consistent, _ := strconv.ParseBool(r.URL.Query().Get("consistent"))
+	return consistent
+}
+
+// isReverse reports whether a scan should run in descending key order. The
+// returned nextCursor keeps paging in the same direction.
+func isReverse(r *http.Request) bool {
+	reverse, _ := strconv.ParseBool(r.URL.Query().Get("reverse"))
+	return reverse
+}
+
+// parseFilter reads the optional filter parameter, a JSON kvstore.Filter such
+// as {"type":"chain","filters":[{"type":"key_regex","pattern":"^user:"},...]}.
+func parseFilter(r *http.Request) (*kvstore.Filter, error) {
+	data := r.URL.Query().Get("filter")
+	if data == "" {
+		return nil, nil
+	}
+
+	var filter kvstore.Filter
+	if err := json.Unmarshal([]byte(data), &filter); err != nil {
+		return nil, fmt.Errorf("Invalid filter parameter: %v", err)
+	}
+	if err := filter.Validate(); err != nil {
+		return nil, fmt.Errorf("Invalid filter parameter: %v", err)
+	}
+	return &filter, nil
+}
+
+func scanErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, kvstore.ErrSnapshotExpired):
+		return http.StatusGone
+	case errors.Is(err, kvstore.ErrInvalidCursor), errors.Is(err, kvstore.ErrReservedKey):
+		return http.StatusBadRequest
+	case errors.Is(err, kvstore.ErrTooManySnapshots):
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// scanPrefixCursor decodes the prefix and cursor of a scan request. Snapshot
+// cursors are opaque tokens and are passed through as they are.
+func scanPrefixCursor(r *http.Request) (codec byteCodec, prefix, cursor string, err error) {
+	if codec, err = requestCodec(r); err != nil {
+		return codec, "", "", err
+	}
+	if prefix, err = codec.query(r, "prefix"); err != nil {
+		return codec, "", "", err
+	}
+	cursor = r.URL.Query().Get("cursor")
+	if !isConsistent(r) {
+		cursor, err = codec.query(r, "cursor")
+	}
+	return codec, prefix, cursor, err
+}
+
+func scanCursor(r *http.Request, codec byteCodec, cursor string) string {
+	if isConsistent(r) {
+		return cursor
+	}
+	return codec.encode(cursor)
+}
+
+func (s *KVStoreService) HandleReleaseSnapshot(w http.ResponseWriter, r *http.Request) {
+	cursor := r.URL.Query().Get("cursor")
+	if cursor == "" {
+		http.Error(w, "Missing cursor parameter", http.StatusBadRequest)
+		return
+	}
+
+	if err := s.node.ReleaseSnapshot(cursor); err != nil {
+		http.Error(w, err.Error(), scanErrorStatus(err))
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
 func (s *KVStoreService) HandleScanKey(w http.ResponseWriter,r *http.Request){
 	if r.Method != http.MethodGet {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
@@ -168,14 +676,16 @@ func (s *KVStoreService) HandleScanKey(w http.ResponseWriter,r *http.Request){
 	}
 
 	// Parse query parameters
-	prefix := r.URL.Query().Get("prefix")
+	codec, prefix, cursor, err := scanPrefixCursor(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 	if prefix == "" {
 		http.Error(w, "Missing prefix parameter", http.StatusBadRequest)
 		return
 	}
 
-	cursor := r.URL.Query().Get("cursor")
-
 	limit := 1000 // Default limit
 	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
 		var err error
@@ -187,16 +697,29 @@ func (s *KVStoreService) HandleScanKey(w http.ResponseWriter,r *http.Request){
 	}
 
 	// Call ScanKey
-	keys, nextCursor, err := s.node.ScanKey(prefix, cursor, limit)
+	filter, err := parseFilter(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var keys []string
+	var nextCursor string
+	reverse := isReverse(r)
+	if isConsistent(r) {
+		keys, nextCursor, err = s.node.ScanKeySnapshot(prefix, cursor, limit, reverse, filter)
+	} else {
+		keys, nextCursor, err = s.node.ScanKey(prefix, cursor, limit, reverse, filter)
+	}
 	if err != nil {
-		http.Error(w, "Error scanning keys: "+err.Error(), http.StatusInternalServerError)
+		http.Error(w, "Error scanning keys: "+err.Error(), scanErrorStatus(err))
 		return
 	}
 
 	// Prepare response
 	response := ScanKeyResponse{
-		Keys:       keys,
-		NextCursor: nextCursor,
+		Keys:       codec.encodeAll(keys),
+		NextCursor: scanCursor(r, codec, nextCursor),
 	}
 
 	// Send JSON response
@@ -205,34 +728,53 @@ func (s *KVStoreService) HandleScanKey(w http.ResponseWriter,r *http.Request){
 }
 
 func (s *KVStoreService) HandleScanValueByKey(w http.ResponseWriter, r *http.Request) {
-    prefix := r.URL.Query().Get("prefix")
+    codec, prefix, cursor, err := scanPrefixCursor(r)
+    if err != nil {
+        http.Error(w, err.Error(), http.StatusBadRequest)
+        return
+    }
     if prefix == "" {
         http.Error(w, "Missing prefix parameter", http.StatusBadRequest)
         return
     }
 
-    cursor := r.URL.Query().Get("cursor")
     limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
     if limit <= 0 {
         limit = 1000 // 기본값 설정
     }
 
-    results, nextCursor, err := s.node.ScanValueByKey(prefix, cursor, limit)
+    filter, err := parseFilter(r)
     if err != nil {
-        http.Error(w, "Error scanning values: "+err.Error(), http.StatusInternalServerError)
+        http.Error(w, err.Error(), http.StatusBadRequest)
+        return
+    }
+
+    var results []map[string]string
+    var nextCursor string
+    reverse := isReverse(r)
+    if isConsistent(r) {
+        results, nextCursor, err = s.node.ScanValueByKeySnapshot(prefix, cursor, limit, reverse, filter)
+    } else {
+        results, nextCursor, err = s.node.ScanValueByKey(prefix, cursor, limit, reverse, filter)
+    }
+    if err != nil {
+        http.Error(w, "Error scanning values: "+err.Error(), scanErrorStatus(err))
         return
     }
 
 	formattedResults := make([]map[string]interface{}, len(results))
     for i, result := range results {
-        var valueMap map[string]interface{}
-        if err := json.Unmarshal([]byte(result["value"]), &valueMap); err != nil {
-            http.Error(w, "Error parsing value: "+err.Error(), http.StatusInternalServerError)
-            return
+        if codec.base64 {
+            formattedResults[i] = map[string]interface{}{
+                "key":   codec.encode(result["key"]),
+                "value": codec.encode(result["value"]),
+            }
+            continue
         }
+        // counters, appended strings and raw bytes are not JSON objects
         formattedResults[i] = map[string]interface{}{
             "key":   result["key"],
-            "value": valueMap,
+            "value": jsonValue(result["value"]),
         }
     }
 
@@ -241,7 +783,7 @@ func (s *KVStoreService) HandleScanValueByKey(w http.ResponseWriter, r *http.Req
         NextCursor string              			`json:"nextCursor"`
     }{
         Results:    formattedResults,
-        NextCursor: nextCursor,
+        NextCursor: scanCursor(r, codec, nextCursor),
     }
 
     w.Header().Set("Content-Type", "application/json")
@@ -257,7 +799,11 @@ func (s *KVStoreService) HandleScanKeysLower(w http.ResponseWriter, r *http.Requ
 	}
 
 	// Parse query parameters
-	prefix := r.URL.Query().Get("prefix")
+	codec, prefix, cursor, err := scanPrefixCursor(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 	if prefix == "" {
 		http.Error(w, "Missing prefix parameter", http.StatusBadRequest)
 		return
@@ -273,8 +819,6 @@ func (s *KVStoreService) HandleScanKeysLower(w http.ResponseWriter, r *http.Requ
 		}
 	}
 
-	cursor := r.URL.Query().Get("cursor")
-
 	limit := 1000 // Default limit
 	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
 		var err error
@@ -286,16 +830,22 @@ func (s *KVStoreService) HandleScanKeysLower(w http.ResponseWriter, r *http.Requ
 	}
 
 	// Call ScanKeysLower
-	keys, nextCursor, err := s.node.ScanKeysLower(prefix, maxTimestamp, cursor, limit)
+	var keys []string
+	var nextCursor string
+	if isConsistent(r) {
+		keys, nextCursor, err = s.node.ScanKeysLowerSnapshot(prefix, maxTimestamp, cursor, limit)
+	} else {
+		keys, nextCursor, err = s.node.ScanKeysLower(prefix, maxTimestamp, cursor, limit)
+	}
 	if err != nil {
-		http.Error(w, "Error scanning keys: "+err.Error(), http.StatusInternalServerError)
+		http.Error(w, "Error scanning keys: "+err.Error(), scanErrorStatus(err))
 		return
 	}
 
 	// Prepare response
 	response := ScanKeyResponse{
-		Keys:       keys,
-		NextCursor: nextCursor,
+		Keys:       codec.encodeAll(keys),
+		NextCursor: scanCursor(r, codec, nextCursor),
 	}
 
 	// Send JSON response
@@ -309,7 +859,16 @@ func (s *KVStoreService) HandleScanKeysLower(w http.ResponseWriter, r *http.Requ
 
 func (s *KVStoreService) HandleScanOffset(w http.ResponseWriter, r *http.Request){
 
-	prefix := r.URL.Query().Get("prefix")
+	codec, err := requestCodec(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	prefix, err := codec.query(r, "prefix")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
 	if prefix == "" {
 		http.Error(w, "Missing prefix parameter", http.StatusBadRequest)
@@ -329,30 +888,352 @@ func (s *KVStoreService) HandleScanOffset(w http.ResponseWriter, r *http.Request
 	cursor, err := s.node.ScanOffset(prefix, offset)
 
 	if err!=nil{
-		http.Error(w, "Error scanning offset: "+err.Error(), http.StatusInternalServerError)
+		http.Error(w, "Error scanning offset: "+err.Error(), storeErrorStatus(err))
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(cursor)
+	json.NewEncoder(w).Encode(codec.encode(cursor))
 }
 
+// HandleTotalKey returns a cheap estimate of the keys under prefix. With
+// exact=true it also counts them, visiting at most maxScan entries; complete
+// reports whether the count finished within that budget.
 func (s *KVStoreService) HandleTotalKey(w http.ResponseWriter, r *http.Request){
 
-	prefix := r.URL.Query().Get("prefix")
+	codec, err := requestCodec(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	prefix, err := codec.query(r, "prefix")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
 	if prefix == "" {
 		http.Error(w, "Missing prefix parameter", http.StatusBadRequest)
 		return
 	}
 
-	totals,err := s.node.TotalKey(prefix)
+	estimate, err := s.node.EstimateKeys(prefix)
+	if err != nil {
+		http.Error(w, "Error estimating keys : " + err.Error(), storeErrorStatus(err))
+		return
+	}
+	response := TotalKeyResponse{Prefix: codec.encode(prefix), Estimate: estimate}
+
+	if exact, _ := strconv.ParseBool(r.URL.Query().Get("exact")); exact {
+		maxScan := defaultCountScanLimit
+		if v := r.URL.Query().Get("maxScan"); v != "" {
+			if maxScan, err = strconv.Atoi(v); err != nil || maxScan <= 0 {
+				http.Error(w, "Invalid maxScan parameter", http.StatusBadRequest)
+				return
+			}
+		}
+
+		totals, complete, err := s.node.CountKeys(prefix, maxScan)
+		if err != nil{
+			http.Error(w, "Error get total key : " + err.Error(), storeErrorStatus(err))
+			return
+		}
+		response.Exact, response.Complete = &totals, &complete
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// HandlePrefixCounter enables (POST) or disables (DELETE) the maintained key
+// counter of a prefix, which /totalkey then answers from.
+func (s *KVStoreService) HandlePrefixCounter(w http.ResponseWriter, r *http.Request) {
+	codec, err := requestCodec(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	prefix, err := codec.query(r, "prefix")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if prefix == "" {
+		http.Error(w, "Missing prefix parameter", http.StatusBadRequest)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPost:
+		count, err := s.node.EnableCounter(prefix)
+		if errors.Is(err, kvstore.ErrTooManyCounters) {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"prefix": codec.encode(prefix), "count": count})
+	case http.MethodDelete:
+		if err := s.node.DisableCounter(prefix); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// HandleAggregate computes count, sum, min, max and avg over a prefix or key
+// range. field picks a number out of JSON object values, groupBy (counted
+// from 1) groups keys by a segment split on delimiter.
+func (s *KVStoreService) HandleAggregate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	codec, err := requestCodec(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	opts, err := parseRangeOptions(r, codec)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if opts.StartKey == "" && opts.EndKey == "" {
+		http.Error(w, "Missing prefix or key range", http.StatusBadRequest)
+		return
+	}
+
+	query := r.URL.Query()
+	spec := kvstore.AggregateSpec{
+		Field:     query.Get("field"),
+		Delimiter: query.Get("delimiter"),
+	}
+	if groupBy := query.Get("groupBy"); groupBy != "" {
+		spec.GroupBy, err = strconv.Atoi(groupBy)
+		if err != nil || spec.GroupBy < 0 {
+			http.Error(w, "Invalid groupBy parameter", http.StatusBadRequest)
+			return
+		}
+	}
+
+	results, err := s.node.Aggregate(r.Context(), opts, spec)
+	if errors.Is(err, kvstore.ErrTooManyGroups) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	for i := range results {
+		if results[i].Group != "" {
+			results[i].Group = codec.encode(results[i].Group)
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"results": results})
+}
+
+func (s *KVStoreService) HandleCheckAndMutate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var data struct {
+		Key       string `json:"key"`
+		Table     string `json:"table"`
+		Row       string `json:"row"`
+		Condition struct {
+			Type      string      `json:"type"`
+			Value     interface{} `json:"value"`
+			Version   int64       `json:"version"`
+			Family    string      `json:"family"`
+			Qualifier string      `json:"qualifier"`
+		} `json:"condition"`
+		OnTrue  json.RawMessage `json:"onTrue"`
+		OnFalse json.RawMessage `json:"onFalse"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+		log.Printf("JSON decode error: %v", err)
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	cond := kvstore.Condition{
+		Type:      data.Condition.Type,
+		Version:   data.Condition.Version,
+		Family:    data.Condition.Family,
+		Qualifier: data.Condition.Qualifier,
+	}
+	codec, err := requestCodec(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if data.Condition.Type == "value_equals" {
+		// Compare against the stored form of the value
+		if cond.Value, err = encodeValue(codec, data.Condition.Value); err != nil {
+			http.Error(w, "Failed to process condition value", http.StatusBadRequest)
+			return
+		}
+	}
+
+	var matched bool
+	switch {
+	case data.Table != "" && data.Row != "":
+		var onTrue, onFalse []mutationRequest
+		if err := decodeOptional(data.OnTrue, &onTrue); err != nil {
+			http.Error(w, "Invalid onTrue mutations", http.StatusBadRequest)
+			return
+		}
+		if err := decodeOptional(data.OnFalse, &onFalse); err != nil {
+			http.Error(w, "Invalid onFalse mutations", http.StatusBadRequest)
+			return
+		}
+		trueMutations, err1 := toMutations(onTrue)
+		falseMutations, err2 := toMutations(onFalse)
+		if err1 != nil || err2 != nil {
+			http.Error(w, "Failed to process value", http.StatusBadRequest)
+			return
+		}
+		matched, err = s.node.CheckAndMutateRow(data.Table, data.Row, cond, trueMutations, falseMutations)
+	case data.Key != "":
+		var onTrue, onFalse []KVPair
+		if err := decodeOptional(data.OnTrue, &onTrue); err != nil {
+			http.Error(w, "Invalid onTrue operations", http.StatusBadRequest)
+			return
+		}
+		if err := decodeOptional(data.OnFalse, &onFalse); err != nil {
+			http.Error(w, "Invalid onFalse operations", http.StatusBadRequest)
+			return
+		}
+		trueOps, err1 := toBatchOperations(onTrue, codec)
+		falseOps, err2 := toBatchOperations(onFalse, codec)
+		key, err3 := codec.decode(data.Key)
+		if err1 != nil || err2 != nil || err3 != nil {
+			http.Error(w, "Failed to process value", http.StatusBadRequest)
+			return
+		}
+		matched, err = s.node.CheckAndMutate(key, cond, trueOps, falseOps)
+	default:
+		http.Error(w, "Either key or table and row are required", http.StatusBadRequest)
+		return
+	}
 
-	if err != nil{
-		http.Error(w, "Error get total key : " + err.Error(), http.StatusInternalServerError)
+	if err != nil {
+		log.Printf("CheckAndMutate error: %v", err)
+		http.Error(w, err.Error(), tableErrorStatus(err))
 		return
 	}
 
+	branch := "onFalse"
+	if matched {
+		branch = "onTrue"
+	}
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(totals)
-}
\ No newline at end of file
+	json.NewEncoder(w).Encode(map[string]interface{}{"matched": matched, "branch": branch})
+}
+
+func decodeOptional(data json.RawMessage, v interface{}) error {
+	if len(data) == 0 {
+		return nil
+	}
+	return json.Unmarshal(data, v)
+}
+
+func (s *KVStoreService) HandleIncrement(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var data struct {
+		Key      string `json:"key"`
+		Delta    *int64 `json:"delta"`
+		Encoding string `json:"encoding"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+		log.Printf("JSON decode error: %v", err)
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	codec, err := requestCodec(r)
+	if err == nil {
+		data.Key, err = codec.decode(data.Key)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if data.Key == "" {
+		http.Error(w, "Key is required", http.StatusBadRequest)
+		return
+	}
+
+	delta := int64(1)
+	if data.Delta != nil {
+		delta = *data.Delta
+	}
+
+	value, err := s.node.Increment(data.Key, delta, data.Encoding)
+	if err != nil {
+		http.Error(w, "Error incrementing key: "+err.Error(), storeErrorStatus(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"key": codec.encode(data.Key), "value": value})
+}
+
+func (s *KVStoreService) HandleAppend(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var data struct {
+		Key      string `json:"key"`
+		Value    string `json:"value"`
+		Encoding string `json:"encoding"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+		log.Printf("JSON decode error: %v", err)
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	codec, err := requestCodec(r)
+	if err == nil {
+		data.Key, err = codec.decode(data.Key)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if data.Key == "" {
+		http.Error(w, "Key is required", http.StatusBadRequest)
+		return
+	}
+	if data.Value, err = codec.decode(data.Value); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	value, err := s.node.Append(data.Key, data.Value, data.Encoding)
+	if err != nil {
+		http.Error(w, "Error appending to key: "+err.Error(), storeErrorStatus(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"key": codec.encode(data.Key), "value": codec.encode(value)})
+}
@@ -1,36 +1,133 @@
 package rest
 
-import "net/http"
+import (
+	"net/http"
+	"sort"
+	"strings"
+)
 
 
 type Server struct {
 	service RESTService
+	mux     *http.ServeMux
 }
 
 func NewServer(service RESTService) *Server {
 	return &Server{
 		service: service,
+		mux:     http.NewServeMux(),
 	}
 }
 
 
 func (s *Server) SetupRoutes() {
-	http.HandleFunc("/set", s.service.HandleSet)
-	http.HandleFunc("/get", s.service.HandleGet)
-	http.HandleFunc("/delete", s.service.HandleDelete)
-	http.HandleFunc("/range",s.service.HandleRange)
-	http.HandleFunc("/batch", s.service.HandleBatch)
-	http.HandleFunc("/scankey",s.service.HandleScanKey)
-	http.HandleFunc("/scanvaluebykey",s.service.HandleScanValueByKey)
-	http.HandleFunc("/scankeylower",s.service.HandleScanKeysLower)
-
-	http.HandleFunc("/scanoffset",s.service.HandleScanOffset)
-	http.HandleFunc("/totalkey",s.service.HandleTotalKey)
+	s.setupV1Routes()
 
+	// 기존 엔드포인트 (호환용)
+	s.mux.HandleFunc("/set", s.service.HandleSet)
+	s.mux.HandleFunc("/get", s.service.HandleGet)
+	s.mux.HandleFunc("/multiget", s.service.HandleMultiGet)
+	s.mux.HandleFunc("/delete", s.service.HandleDelete)
+	s.mux.HandleFunc("/deleteprefix", s.service.HandleDeletePrefix)
+	s.mux.HandleFunc("/deleterange", s.service.HandleDeleteRange)
+	s.mux.HandleFunc("/range",s.service.HandleRange)
+	s.mux.HandleFunc("/batch", s.service.HandleBatch)
+	s.mux.HandleFunc("/scankey",s.service.HandleScanKey)
+	s.mux.HandleFunc("/scanvaluebykey",s.service.HandleScanValueByKey)
+	s.mux.HandleFunc("/scankeylower",s.service.HandleScanKeysLower)
+	s.mux.HandleFunc("/scanstream", s.service.HandleScanStream)
+	s.mux.HandleFunc("/releasesnapshot", s.service.HandleReleaseSnapshot)
+
+	s.mux.HandleFunc("/scanoffset",s.service.HandleScanOffset)
+	s.mux.HandleFunc("/totalkey",s.service.HandleTotalKey)
+	s.mux.HandleFunc("/prefixcounter", s.service.HandlePrefixCounter)
+	s.mux.HandleFunc("/aggregate", s.service.HandleAggregate)
+	s.mux.HandleFunc("/checkandmutate", s.service.HandleCheckAndMutate)
+	s.mux.HandleFunc("/increment", s.service.HandleIncrement)
+	s.mux.HandleFunc("/append", s.service.HandleAppend)
+
+	s.mux.HandleFunc("/createtable", s.service.HandleCreateTable)
+	s.mux.HandleFunc("/listtables", s.service.HandleListTables)
+	s.mux.HandleFunc("/deletetable", s.service.HandleDeleteTable)
+	s.mux.HandleFunc("/setcolumnfamily", s.service.HandleSetColumnFamily)
+	s.mux.HandleFunc("/dropcolumnfamily", s.service.HandleDropColumnFamily)
+	s.mux.HandleFunc("/mutaterow", s.service.HandleMutateRow)
+	s.mux.HandleFunc("/readrow", s.service.HandleReadRow)
+	s.mux.HandleFunc("/readrows", s.service.HandleReadRows)
+
+}
+
+func (s *Server) setupV1Routes() {
+	s.route("/v1/kv/{key...}", map[string]http.HandlerFunc{
+		http.MethodGet:    s.service.HandleKVGet,
+		http.MethodPut:    s.service.HandleKVPut,
+		http.MethodDelete: s.service.HandleKVDelete,
+	})
+	s.route("/v1/batch", map[string]http.HandlerFunc{
+		http.MethodPost: s.service.HandleV1Batch,
+	})
+
+	s.route("/v1/txn", map[string]http.HandlerFunc{
+		http.MethodPost: s.service.HandleTxnBegin,
+	})
+	s.route("/v1/txn/{id}/kv/{key...}", map[string]http.HandlerFunc{
+		http.MethodGet:    s.service.HandleTxnGet,
+		http.MethodPut:    s.service.HandleTxnPut,
+		http.MethodDelete: s.service.HandleTxnDelete,
+	})
+	s.route("/v1/txn/{id}/batch", map[string]http.HandlerFunc{
+		http.MethodPost: s.service.HandleTxnBatch,
+	})
+	s.route("/v1/txn/{id}/commit", map[string]http.HandlerFunc{
+		http.MethodPost: s.service.HandleTxnCommit,
+	})
+	s.route("/v1/txn/{id}/rollback", map[string]http.HandlerFunc{
+		http.MethodPost: s.service.HandleTxnRollback,
+	})
+
+	s.route("/v1/watch", map[string]http.HandlerFunc{
+		http.MethodGet: s.service.HandleWatch,
+	})
+	s.route("/v1/watch/ws", map[string]http.HandlerFunc{
+		http.MethodGet: s.service.HandleWatchWebSocket,
+	})
+
+	s.route("/v1/admin/backups", map[string]http.HandlerFunc{
+		http.MethodGet:  s.service.HandleBackupList,
+		http.MethodPost: s.service.HandleBackupCreate,
+	})
+	s.route("/v1/admin/backups/{name}/verify", map[string]http.HandlerFunc{
+		http.MethodPost: s.service.HandleBackupVerify,
+	})
+
+	s.mux.HandleFunc("/v1/", func(w http.ResponseWriter, r *http.Request) {
+		writeError(w, http.StatusNotFound, CodeNotFound, "no such endpoint: "+r.URL.Path)
+	})
 }
 
+// route registers one handler per method on pattern. Other methods get a 405
+// in the /v1 error envelope instead of the mux's plain text one.
+func (s *Server) route(pattern string, handlers map[string]http.HandlerFunc) {
+	allowed := make([]string, 0, len(handlers))
+	for method, handler := range handlers {
+		s.mux.HandleFunc(method+" "+pattern, handler)
+		allowed = append(allowed, method)
+	}
+	sort.Strings(allowed)
+	allow := strings.Join(allowed, ", ")
+
+	s.mux.HandleFunc(pattern, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Allow", allow)
+		writeError(w, http.StatusMethodNotAllowed, CodeMethodNotAllowed, "method "+r.Method+" not allowed")
+	})
+}
+
+// Handler returns the routes set up by SetupRoutes.
+func (s *Server) Handler() http.Handler {
+	return s.mux
+}
 
 func (s *Server) Start(addr string) error {
 	s.SetupRoutes()
-	return http.ListenAndServe(addr, nil)
+	return http.ListenAndServe(addr, s.mux)
 }
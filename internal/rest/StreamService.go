@@ -0,0 +1,89 @@
+package rest
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+)
+
+// streamFlushEvery is how many entries the scan stream writes between
+// flushes.
+const streamFlushEvery = 128
+
+type streamEntry struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+// HandleScanStream streams a prefix or key range without paging. The default
+// output is newline-delimited JSON; format=binary (or Accept:
+// application/octet-stream) writes frames of a 4-byte big-endian key length,
+// the key, a 4-byte big-endian value length and the value. The status is sent
+// before the scan starts, so the X-Next-Cursor trailer carries the cursor
+// when a limit cut the stream short and X-Stream-Error reports a failure.
+// encoding=base64 applies to the NDJSON entries and the cursor.
+func (s *KVStoreService) HandleScanStream(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	codec, err := requestCodec(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	opts, err := parseRangeOptions(r, codec)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	binaryFrames := r.URL.Query().Get("format") == "binary" || r.Header.Get("Accept") == "application/octet-stream"
+	if binaryFrames {
+		w.Header().Set("Content-Type", "application/octet-stream")
+	} else {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+	}
+	w.Header().Set("Trailer", "X-Next-Cursor, X-Stream-Error")
+	w.WriteHeader(http.StatusOK)
+
+	controller := http.NewResponseController(w)
+	encoder := json.NewEncoder(w)
+	var frameHeader [4]byte
+	written := 0
+
+	nextCursor, err := s.node.StreamRange(r.Context(), opts, func(key, value []byte) error {
+		if binaryFrames {
+			binary.BigEndian.PutUint32(frameHeader[:], uint32(len(key)))
+			w.Write(frameHeader[:])
+			w.Write(key)
+			binary.BigEndian.PutUint32(frameHeader[:], uint32(len(value)))
+			w.Write(frameHeader[:])
+			if _, err := w.Write(value); err != nil {
+				return err
+			}
+		} else if err := encoder.Encode(streamEntry{Key: codec.encode(string(key)), Value: codec.encode(string(value))}); err != nil {
+			return err
+		}
+
+		written++
+		if written%streamFlushEvery == 0 {
+			return controller.Flush()
+		}
+		return nil
+	})
+	controller.Flush()
+
+	if err != nil {
+		if !errors.Is(err, context.Canceled) {
+			log.Printf("scan stream failed: %v", err)
+		}
+		w.Header().Set("X-Stream-Error", err.Error())
+		return
+	}
+	w.Header().Set("X-Next-Cursor", codec.encode(nextCursor))
+}
@@ -0,0 +1,354 @@
+package rest
+
+import (
+	"bigtable/internal/kvstore"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/cockroachdb/pebble"
+)
+
+type CellResponse struct {
+	Family    string      `json:"family"`
+	Qualifier string      `json:"qualifier"`
+	Timestamp int64       `json:"timestamp"`
+	Value     interface{} `json:"value"`
+}
+
+type RowResponse struct {
+	Key   string         `json:"key"`
+	Cells []CellResponse `json:"cells"`
+}
+
+type ReadRowsResponse struct {
+	Rows       []RowResponse `json:"rows"`
+	NextCursor string        `json:"nextCursor"`
+}
+
+// jsonValue returns stored values as raw JSON when they were written through
+// the REST API, and as plain strings otherwise.
+func jsonValue(value string) interface{} {
+	if json.Valid([]byte(value)) {
+		return json.RawMessage(value)
+	}
+	return value
+}
+
+func toRowResponse(row kvstore.Row) RowResponse {
+	cells := make([]CellResponse, len(row.Cells))
+	for i, cell := range row.Cells {
+		cells[i] = CellResponse{
+			Family:    cell.Family,
+			Qualifier: cell.Qualifier,
+			Timestamp: cell.Timestamp,
+			Value:     jsonValue(cell.Value),
+		}
+	}
+	return RowResponse{Key: row.Key, Cells: cells}
+}
+
+func tableErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, kvstore.ErrTableNotFound), errors.Is(err, pebble.ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, kvstore.ErrTableExists):
+		return http.StatusConflict
+	case errors.Is(err, kvstore.ErrFamilyNotFound), errors.Is(err, kvstore.ErrReservedKey),
+		errors.Is(err, kvstore.ErrInvalidOperation):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// parseReadOptions reads the version selection parameters shared by the row
+// read endpoints: maxVersions, startTimestamp and endTimestamp, plus filter.
+func parseReadOptions(r *http.Request) (kvstore.ReadOptions, error) {
+	var opts kvstore.ReadOptions
+	query := r.URL.Query()
+
+	if v := query.Get("maxVersions"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return opts, errors.New("Invalid maxVersions parameter")
+		}
+		opts.MaxVersions = n
+	}
+	if v := query.Get("startTimestamp"); v != "" {
+		ts, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || ts < 0 {
+			return opts, errors.New("Invalid startTimestamp parameter")
+		}
+		opts.StartTimestamp = ts
+	}
+	if v := query.Get("endTimestamp"); v != "" {
+		ts, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || ts < 0 {
+			return opts, errors.New("Invalid endTimestamp parameter")
+		}
+		opts.EndTimestamp = ts
+	}
+
+	filter, err := parseFilter(r)
+	if err != nil {
+		return opts, err
+	}
+	opts.Filter = filter
+	return opts, nil
+}
+
+func (s *KVStoreService) HandleCreateTable(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var data struct {
+		Name           string                 `json:"name"`
+		ColumnFamilies []kvstore.ColumnFamily `json:"columnFamilies"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+		log.Printf("JSON decode error: %v", err)
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	if err := s.node.CreateTable(data.Name, data.ColumnFamilies); err != nil {
+		status := tableErrorStatus(err)
+		if status == http.StatusInternalServerError {
+			status = http.StatusBadRequest
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+}
+
+func (s *KVStoreService) HandleListTables(w http.ResponseWriter, r *http.Request) {
+	tables, err := s.node.ListTables()
+	if err != nil {
+		http.Error(w, "Error listing tables: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tables)
+}
+
+func (s *KVStoreService) HandleDeleteTable(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost && r.Method != http.MethodDelete {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	table := r.URL.Query().Get("table")
+	if table == "" {
+		http.Error(w, "Missing table parameter", http.StatusBadRequest)
+		return
+	}
+
+	if err := s.node.DeleteTable(table); err != nil {
+		http.Error(w, err.Error(), tableErrorStatus(err))
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func (s *KVStoreService) HandleSetColumnFamily(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var data struct {
+		Table string `json:"table"`
+		kvstore.ColumnFamily
+	}
+	if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+		log.Printf("JSON decode error: %v", err)
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	if err := s.node.SetColumnFamily(data.Table, data.ColumnFamily); err != nil {
+		status := tableErrorStatus(err)
+		if status == http.StatusInternalServerError {
+			status = http.StatusBadRequest
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func (s *KVStoreService) HandleDropColumnFamily(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost && r.Method != http.MethodDelete {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	table := r.URL.Query().Get("table")
+	family := r.URL.Query().Get("family")
+	if table == "" || family == "" {
+		http.Error(w, "Both table and family are required", http.StatusBadRequest)
+		return
+	}
+
+	if err := s.node.DropColumnFamily(table, family); err != nil {
+		http.Error(w, err.Error(), tableErrorStatus(err))
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+type mutationRequest struct {
+	Type           string      `json:"type"`
+	Family         string      `json:"family"`
+	Qualifier      string      `json:"qualifier"`
+	Value          interface{} `json:"value"`
+	Timestamp      int64       `json:"timestamp"`
+	StartTimestamp int64       `json:"startTimestamp"`
+	EndTimestamp   int64       `json:"endTimestamp"`
+}
+
+func toMutations(requests []mutationRequest) ([]kvstore.Mutation, error) {
+	mutations := make([]kvstore.Mutation, len(requests))
+	for i, m := range requests {
+		mutations[i] = kvstore.Mutation{
+			Type:           m.Type,
+			Family:         m.Family,
+			Qualifier:      m.Qualifier,
+			Timestamp:      m.Timestamp,
+			StartTimestamp: m.StartTimestamp,
+			EndTimestamp:   m.EndTimestamp,
+		}
+		if m.Type == "set" {
+			valueJSON, err := json.Marshal(m.Value)
+			if err != nil {
+				return nil, err
+			}
+			mutations[i].Value = string(valueJSON)
+		}
+	}
+	return mutations, nil
+}
+
+func (s *KVStoreService) HandleMutateRow(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var data struct {
+		Table     string            `json:"table"`
+		Row       string            `json:"row"`
+		Mutations []mutationRequest `json:"mutations"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+		log.Printf("JSON decode error: %v", err)
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if data.Table == "" || data.Row == "" {
+		http.Error(w, "Both table and row are required", http.StatusBadRequest)
+		return
+	}
+
+	mutations, err := toMutations(data.Mutations)
+	if err != nil {
+		log.Printf("JSON marshal error for row %s: %v", data.Row, err)
+		http.Error(w, "Failed to process value", http.StatusInternalServerError)
+		return
+	}
+
+	if err := s.node.MutateRow(data.Table, data.Row, mutations); err != nil {
+		log.Printf("MutateRow error: %v", err)
+		http.Error(w, err.Error(), tableErrorStatus(err))
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func (s *KVStoreService) HandleReadRow(w http.ResponseWriter, r *http.Request) {
+	table := r.URL.Query().Get("table")
+	row := r.URL.Query().Get("row")
+	if table == "" || row == "" {
+		http.Error(w, "Both table and row are required", http.StatusBadRequest)
+		return
+	}
+
+	opts, err := parseReadOptions(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	result, err := s.node.ReadRow(table, row, opts)
+	if err != nil {
+		http.Error(w, err.Error(), tableErrorStatus(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(toRowResponse(*result))
+}
+
+func (s *KVStoreService) HandleReadRows(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	table := query.Get("table")
+	if table == "" {
+		http.Error(w, "Missing table parameter", http.StatusBadRequest)
+		return
+	}
+
+	startKey := query.Get("startKey")
+	endKey := query.Get("endKey")
+	if prefix := query.Get("prefix"); prefix != "" {
+		startKey = prefix
+		endKey = kvstore.PrefixEnd(prefix)
+	}
+	if cursor := query.Get("cursor"); cursor != "" {
+		startKey = cursor
+	}
+
+	limit := 1000 // Default limit
+	if limitStr := query.Get("limit"); limitStr != "" {
+		var err error
+		limit, err = strconv.Atoi(limitStr)
+		if err != nil || limit <= 0 {
+			http.Error(w, "Invalid limit parameter", http.StatusBadRequest)
+			return
+		}
+	}
+
+	opts, err := parseReadOptions(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	rows, nextCursor, err := s.node.ReadRows(table, startKey, endKey, limit, opts)
+	if err != nil {
+		http.Error(w, "Error reading rows: "+err.Error(), tableErrorStatus(err))
+		return
+	}
+
+	response := ReadRowsResponse{
+		Rows:       make([]RowResponse, len(rows)),
+		NextCursor: nextCursor,
+	}
+	for i, row := range rows {
+		response.Rows[i] = toRowResponse(row)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
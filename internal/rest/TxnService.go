@@ -0,0 +1,142 @@
+package rest
+
+import (
+	"bigtable/internal/kvstore"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// TxnResponse is returned by POST /v1/txn.
+type TxnResponse struct {
+	ID      string `json:"id"`
+	Timeout int64  `json:"timeout"` // seconds until the transaction is dropped
+}
+
+// HandleTxnBegin serves POST /v1/txn. timeout (seconds) is a query
+// parameter; by default a transaction lives for 30 seconds.
+func (s *KVStoreService) HandleTxnBegin(w http.ResponseWriter, r *http.Request) {
+	timeout := kvstore.DefaultTxnTimeout
+	if v := r.URL.Query().Get("timeout"); v != "" {
+		seconds, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || seconds <= 0 || time.Duration(seconds)*time.Second > kvstore.MaxTxnTimeout {
+			writeError(w, http.StatusBadRequest, CodeInvalidArgument, "Invalid timeout parameter")
+			return
+		}
+		timeout = time.Duration(seconds) * time.Second
+	}
+
+	id, err := s.node.BeginTransaction(timeout)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(TxnResponse{ID: id, Timeout: int64(timeout / time.Second)})
+}
+
+// HandleTxnGet serves GET /v1/txn/{id}/kv/{key}, a read from the
+// transaction's snapshot that sees its own buffered writes.
+func (s *KVStoreService) HandleTxnGet(w http.ResponseWriter, r *http.Request) {
+	codec, key, ok := pathKey(w, r)
+	if !ok {
+		return
+	}
+
+	value, version, err := s.node.TxnGet(r.PathValue("id"), key)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	writeValue(w, r, codec, key, value, version)
+}
+
+// HandleTxnPut serves PUT /v1/txn/{id}/kv/{key}, with the same body and ttl
+// as PUT /v1/kv/{key}. The write is buffered until commit.
+func (s *KVStoreService) HandleTxnPut(w http.ResponseWriter, r *http.Request) {
+	codec, key, ok := pathKey(w, r)
+	if !ok {
+		return
+	}
+	value, ttl, ok := readPutBody(w, r, codec)
+	if !ok {
+		return
+	}
+
+	operation := kvstore.BatchOperation{Type: "set", Key: key, Value: value, TTL: ttl}
+	if err := s.node.TxnWrite(r.PathValue("id"), []kvstore.BatchOperation{operation}); err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// HandleTxnDelete serves DELETE /v1/txn/{id}/kv/{key}.
+func (s *KVStoreService) HandleTxnDelete(w http.ResponseWriter, r *http.Request) {
+	_, key, ok := pathKey(w, r)
+	if !ok {
+		return
+	}
+
+	operation := kvstore.BatchOperation{Type: "delete", Key: key}
+	if err := s.node.TxnWrite(r.PathValue("id"), []kvstore.BatchOperation{operation}); err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// HandleTxnBatch serves POST /v1/txn/{id}/batch, buffering several set and
+// delete operations in the /v1/batch format.
+func (s *KVStoreService) HandleTxnBatch(w http.ResponseWriter, r *http.Request) {
+	codec, err := requestCodec(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, CodeInvalidArgument, err.Error())
+		return
+	}
+
+	var request BatchRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeError(w, http.StatusBadRequest, CodeInvalidArgument, "Invalid JSON: "+err.Error())
+		return
+	}
+	for _, op := range request.Operations {
+		if op.Type != "set" && op.Type != "delete" {
+			writeError(w, http.StatusBadRequest, CodeInvalidArgument, "Transactions only support set and delete operations")
+			return
+		}
+	}
+
+	operations, err := toBatchOperations(request.Operations, codec)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, CodeInvalidArgument, err.Error())
+		return
+	}
+	if err := s.node.TxnWrite(r.PathValue("id"), operations); err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// HandleTxnCommit serves POST /v1/txn/{id}/commit. A conflict answers 409
+// with code "aborted"; the transaction is gone afterwards either way and the
+// client should retry from begin.
+func (s *KVStoreService) HandleTxnCommit(w http.ResponseWriter, r *http.Request) {
+	if err := s.node.CommitTransaction(r.PathValue("id")); err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// HandleTxnRollback serves POST /v1/txn/{id}/rollback.
+func (s *KVStoreService) HandleTxnRollback(w http.ResponseWriter, r *http.Request) {
+	if err := s.node.RollbackTransaction(r.PathValue("id")); err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
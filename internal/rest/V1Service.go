@@ -0,0 +1,243 @@
+package rest
+
+import (
+	"bigtable/internal/kvstore"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/cockroachdb/pebble"
+)
+
+// Error codes of the /v1 error envelope.
+const (
+	CodeInvalidArgument   = "invalid_argument"
+	CodeNotFound          = "not_found"
+	CodeMethodNotAllowed  = "method_not_allowed"
+	CodePayloadTooLarge   = "payload_too_large"
+	CodeAborted           = "aborted"
+	CodeResourceExhausted = "resource_exhausted"
+	CodeOutOfRange        = "out_of_range"
+	CodeInternal          = "internal"
+)
+
+// ErrorResponse is the body of every /v1 error:
+// {"error":{"code":"not_found","message":"..."}}.
+type ErrorResponse struct {
+	Error APIError `json:"error"`
+}
+
+type APIError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+type BatchRequest struct {
+	Operations []KVPair `json:"operations"`
+}
+
+// BatchResponse holds one result per operation: the new value of increments
+// and appends, empty for the rest.
+type BatchResponse struct {
+	Results []string `json:"results"`
+}
+
+func writeError(w http.ResponseWriter, status int, code, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(ErrorResponse{Error: APIError{Code: code, Message: message}})
+}
+
+func writeStoreError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, pebble.ErrNotFound):
+		writeError(w, http.StatusNotFound, CodeNotFound, "key not found")
+	case errors.Is(err, kvstore.ErrInvalidRange), errors.Is(err, kvstore.ErrChangeAhead),
+		errors.Is(err, kvstore.ErrReservedKey), errors.Is(err, kvstore.ErrInvalidOperation):
+		writeError(w, http.StatusBadRequest, CodeInvalidArgument, err.Error())
+	case errors.Is(err, kvstore.ErrTxnNotFound):
+		writeError(w, http.StatusNotFound, CodeNotFound, err.Error())
+	case errors.Is(err, kvstore.ErrTxnConflict):
+		writeError(w, http.StatusConflict, CodeAborted, err.Error())
+	case errors.Is(err, kvstore.ErrTooManyTransactions):
+		writeError(w, http.StatusTooManyRequests, CodeResourceExhausted, err.Error())
+	case errors.Is(err, kvstore.ErrChangesTrimmed):
+		writeError(w, http.StatusGone, CodeOutOfRange, err.Error())
+	default:
+		log.Printf("v1 request failed: %v", err)
+		writeError(w, http.StatusInternalServerError, CodeInternal, err.Error())
+	}
+}
+
+func writeBodyError(w http.ResponseWriter, err error) {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		writeError(w, http.StatusRequestEntityTooLarge, CodePayloadTooLarge, err.Error())
+		return
+	}
+	writeError(w, http.StatusBadRequest, CodeInvalidArgument, err.Error())
+}
+
+// pathKey decodes the {key} path value, which holds everything after
+// /v1/kv/ including slashes.
+func pathKey(w http.ResponseWriter, r *http.Request) (byteCodec, string, bool) {
+	codec, err := requestCodec(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, CodeInvalidArgument, err.Error())
+		return codec, "", false
+	}
+	key, err := codec.decode(r.PathValue("key"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, CodeInvalidArgument, "Invalid key: "+err.Error())
+		return codec, "", false
+	}
+	if key == "" {
+		writeError(w, http.StatusBadRequest, CodeInvalidArgument, "Key is required")
+		return codec, "", false
+	}
+	return codec, key, true
+}
+
+// HandleKVGet serves GET /v1/kv/{key} like /get, but answers a missing or
+// expired key with 404.
+func (s *KVStoreService) HandleKVGet(w http.ResponseWriter, r *http.Request) {
+	codec, key, ok := pathKey(w, r)
+	if !ok {
+		return
+	}
+
+	value, version, err := s.node.GetWithVersion(key)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	writeValue(w, r, codec, key, value, version)
+}
+
+// HandleKVPut serves PUT /v1/kv/{key}. The body is the value itself: a JSON
+// document, a base64 JSON string with encoding=base64, or raw bytes with
+// Content-Type application/octet-stream. ttl (seconds) is a query parameter,
+// and so is durability, see writeOptions.
+func (s *KVStoreService) HandleKVPut(w http.ResponseWriter, r *http.Request) {
+	codec, key, ok := pathKey(w, r)
+	if !ok {
+		return
+	}
+
+	opts, err := writeOptions(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, CodeInvalidArgument, err.Error())
+		return
+	}
+	value, ttl, ok := readPutBody(w, r, codec)
+	if !ok {
+		return
+	}
+
+	if err := s.node.SetWithOptions(key, value, time.Duration(ttl)*time.Second, opts); err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// readPutBody reads the value and ttl of a PUT, writing the error response
+// itself when they are invalid.
+func readPutBody(w http.ResponseWriter, r *http.Request, codec byteCodec) (string, int64, bool) {
+	var ttl int64
+	if v := r.URL.Query().Get("ttl"); v != "" {
+		var err error
+		if ttl, err = strconv.ParseInt(v, 10, 64); err != nil || ttl < 0 {
+			writeError(w, http.StatusBadRequest, CodeInvalidArgument, "Invalid ttl parameter")
+			return "", 0, false
+		}
+	}
+
+	if isOctetStream(r) {
+		value, err := readRawValue(w, r)
+		if err != nil {
+			writeBodyError(w, err)
+			return "", 0, false
+		}
+		return value, ttl, true
+	}
+
+	var data interface{}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxValueBytes)).Decode(&data); err != nil {
+		writeBodyError(w, err)
+		return "", 0, false
+	}
+	value, err := encodeValue(codec, data)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, CodeInvalidArgument, err.Error())
+		return "", 0, false
+	}
+	return value, ttl, true
+}
+
+// HandleKVDelete serves DELETE /v1/kv/{key}. Deleting a missing key succeeds.
+func (s *KVStoreService) HandleKVDelete(w http.ResponseWriter, r *http.Request) {
+	_, key, ok := pathKey(w, r)
+	if !ok {
+		return
+	}
+	opts, err := writeOptions(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, CodeInvalidArgument, err.Error())
+		return
+	}
+
+	if err := s.node.DeleteWithOptions(key, opts); err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// HandleV1Batch serves POST /v1/batch with {"operations":[...]}, the same
+// operations /batch takes, applied atomically.
+func (s *KVStoreService) HandleV1Batch(w http.ResponseWriter, r *http.Request) {
+	codec, err := requestCodec(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, CodeInvalidArgument, err.Error())
+		return
+	}
+	opts, err := writeOptions(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, CodeInvalidArgument, err.Error())
+		return
+	}
+
+	var request BatchRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeError(w, http.StatusBadRequest, CodeInvalidArgument, "Invalid JSON: "+err.Error())
+		return
+	}
+	if len(request.Operations) == 0 {
+		writeError(w, http.StatusBadRequest, CodeInvalidArgument, "At least one operation is required")
+		return
+	}
+
+	operations, err := toBatchOperations(request.Operations, codec)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, CodeInvalidArgument, err.Error())
+		return
+	}
+
+	results, err := s.node.BatchWriteWithOptions(operations, opts)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	for i, op := range operations {
+		if op.Type == "append" {
+			results[i] = codec.encode(results[i])
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(BatchResponse{Results: results})
+}
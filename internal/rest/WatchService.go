@@ -0,0 +1,174 @@
+package rest
+
+import (
+	"bigtable/internal/kvstore"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"golang.org/x/net/websocket"
+)
+
+// watchKeepAlive is how often an idle event stream sends a comment, so
+// proxies do not drop the connection.
+const watchKeepAlive = 15 * time.Second
+
+// ChangeEvent is one change of the watch streams. Keys and values follow
+// encoding=base64 like the rest of the API.
+type ChangeEvent struct {
+	Seq       uint64 `json:"seq"`
+	Type      string `json:"type"` // "set", "delete" or "delete_range"
+	Key       string `json:"key"`
+	EndKey    string `json:"endKey,omitempty"` // delete_range only
+	Value     string `json:"value,omitempty"`  // set only
+	Version   int64  `json:"version,omitempty"`
+	ExpiresAt int64  `json:"expiresAt,omitempty"` // unix milliseconds
+	Time      int64  `json:"time"`                // commit time, unix milliseconds
+}
+
+func toChangeEvent(change kvstore.Change, codec byteCodec) ChangeEvent {
+	event := ChangeEvent{
+		Seq:       change.Seq,
+		Type:      change.Type,
+		Key:       codec.encode(change.Key),
+		Version:   change.Version,
+		ExpiresAt: change.ExpiresAt,
+		Time:      change.Time,
+	}
+	if change.Type == "delete_range" {
+		event.EndKey = codec.encode(change.EndKey)
+	}
+	if change.Type == "set" {
+		event.Value = codec.encode(change.Value)
+	}
+	return event
+}
+
+// watchStart reads prefix and the sequence number to resume after: the after
+// query parameter, else the Last-Event-ID header an EventSource sends when it
+// reconnects, else the newest change so only new ones are sent. It writes the
+// error response itself.
+func (s *KVStoreService) watchStart(w http.ResponseWriter, r *http.Request) (byteCodec, string, uint64, bool) {
+	codec, err := requestCodec(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, CodeInvalidArgument, err.Error())
+		return codec, "", 0, false
+	}
+	prefix, err := codec.query(r, "prefix")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, CodeInvalidArgument, err.Error())
+		return codec, "", 0, false
+	}
+
+	after := s.node.LastChangeSeq()
+	resume := r.URL.Query().Get("after")
+	if resume == "" {
+		resume = r.Header.Get("Last-Event-ID")
+	}
+	if resume != "" {
+		if after, err = strconv.ParseUint(resume, 10, 64); err != nil {
+			writeError(w, http.StatusBadRequest, CodeInvalidArgument, "Invalid after parameter")
+			return codec, "", 0, false
+		}
+	}
+	if err := s.node.CheckResume(after); err != nil {
+		writeStoreError(w, err)
+		return codec, "", 0, false
+	}
+	return codec, prefix, after, true
+}
+
+// HandleWatch serves GET /v1/watch?prefix=...&after=... as Server-Sent
+// Events: one "change" event per change with the sequence number as its id,
+// so a reconnecting EventSource resumes where it stopped. A failure after the
+// stream started arrives as an "error" event holding the error envelope.
+func (s *KVStoreService) HandleWatch(w http.ResponseWriter, r *http.Request) {
+	codec, prefix, after, ok := s.watchStart(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	controller := http.NewResponseController(w)
+	controller.Flush()
+
+	ctx, cancel := context.WithCancel(r.Context())
+	var mu sync.Mutex // the keep-alive and the watch share w
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(watchKeepAlive)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				mu.Lock()
+				io.WriteString(w, ": keep-alive\n\n")
+				controller.Flush()
+				mu.Unlock()
+			}
+		}
+	}()
+	defer func() {
+		cancel()
+		wg.Wait()
+	}()
+
+	err := s.node.WatchChanges(ctx, prefix, after, func(change kvstore.Change) error {
+		data, err := json.Marshal(toChangeEvent(change, codec))
+		if err != nil {
+			return err
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		if _, err := fmt.Fprintf(w, "id: %d\nevent: change\ndata: %s\n\n", change.Seq, data); err != nil {
+			return err
+		}
+		return controller.Flush()
+	})
+	if err != nil && ctx.Err() == nil {
+		data, _ := json.Marshal(ErrorResponse{Error: APIError{Code: CodeInternal, Message: err.Error()}})
+		mu.Lock()
+		fmt.Fprintf(w, "event: error\ndata: %s\n\n", data)
+		controller.Flush()
+		mu.Unlock()
+	}
+}
+
+// HandleWatchWebSocket serves GET /v1/watch/ws with the parameters of
+// /v1/watch. Every change is a text message holding a ChangeEvent; messages
+// from the client are ignored, and a failure is sent as the error envelope
+// before the connection closes.
+func (s *KVStoreService) HandleWatchWebSocket(w http.ResponseWriter, r *http.Request) {
+	codec, prefix, after, ok := s.watchStart(w, r)
+	if !ok {
+		return
+	}
+
+	websocket.Server{Handler: func(conn *websocket.Conn) {
+		ctx, cancel := context.WithCancel(r.Context())
+		defer cancel()
+		go func() {
+			// The read fails once the client goes away
+			io.Copy(io.Discard, conn)
+			cancel()
+		}()
+
+		err := s.node.WatchChanges(ctx, prefix, after, func(change kvstore.Change) error {
+			return websocket.JSON.Send(conn, toChangeEvent(change, codec))
+		})
+		if err != nil && ctx.Err() == nil {
+			websocket.JSON.Send(conn, ErrorResponse{Error: APIError{Code: CodeInternal, Message: err.Error()}})
+		}
+	}}.ServeHTTP(w, r)
+}
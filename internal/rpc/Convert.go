@@ -0,0 +1,234 @@
+package rpc
+
+import (
+	"bigtable/internal/kvstore"
+	"bigtable/internal/rpc/pb"
+	"context"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/cockroachdb/pebble"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	defaultPageSize = 1000
+	maxPageSize     = 10000
+
+	// scanChunkSize is how many entries a streamed scan sends per message.
+	scanChunkSize = 128
+
+	defaultCountScanLimit = 1000000
+)
+
+// toStatus turns a store error into a gRPC status. Errors the store does not
+// classify get fallback.
+func toStatus(err error, fallback codes.Code) error {
+	if err == nil {
+		return nil
+	}
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+
+	code := fallback
+	switch {
+	case errors.Is(err, pebble.ErrNotFound), errors.Is(err, kvstore.ErrTableNotFound),
+		errors.Is(err, kvstore.ErrTxnNotFound):
+		code = codes.NotFound
+	case errors.Is(err, kvstore.ErrTxnConflict):
+		code = codes.Aborted
+	case errors.Is(err, kvstore.ErrTableExists):
+		code = codes.AlreadyExists
+	case errors.Is(err, kvstore.ErrFamilyNotFound), errors.Is(err, kvstore.ErrInvalidRange),
+		errors.Is(err, kvstore.ErrInvalidCursor), errors.Is(err, kvstore.ErrTooManyGroups),
+		errors.Is(err, kvstore.ErrChangeAhead), errors.Is(err, kvstore.ErrReservedKey),
+		errors.Is(err, kvstore.ErrInvalidOperation):
+		code = codes.InvalidArgument
+	case errors.Is(err, kvstore.ErrTooManyCounters), errors.Is(err, kvstore.ErrTooManyTransactions):
+		code = codes.ResourceExhausted
+	case errors.Is(err, kvstore.ErrChangesTrimmed):
+		code = codes.OutOfRange
+	case errors.Is(err, context.Canceled):
+		code = codes.Canceled
+	case errors.Is(err, context.DeadlineExceeded):
+		code = codes.DeadlineExceeded
+	}
+	return status.Error(code, err.Error())
+}
+
+func invalidArgument(format string, args ...interface{}) error {
+	return status.Errorf(codes.InvalidArgument, format, args...)
+}
+
+// enumName turns an enum value such as DELETE_PREFIX into the lower case
+// type name the store uses.
+func enumName(e interface{ String() string }) string {
+	return strings.ToLower(e.String())
+}
+
+func toFilter(f *pb.Filter) *kvstore.Filter {
+	if f == nil {
+		return nil
+	}
+	filter := &kvstore.Filter{
+		Type:           f.Type,
+		Pattern:        f.Pattern,
+		Field:          f.Field,
+		Op:             f.Op,
+		Value:          json.RawMessage(f.Value),
+		StartTimestamp: f.StartTimestamp,
+		EndTimestamp:   f.EndTimestamp,
+		Count:          int(f.Count),
+	}
+	for _, child := range f.Filters {
+		filter.Filters = append(filter.Filters, *toFilter(child))
+	}
+	return filter
+}
+
+func toRangeOptions(req *pb.RangeRequest) (kvstore.RangeOptions, error) {
+	opts := kvstore.RangeOptions{
+		StartKey:       string(req.StartKey),
+		EndKey:         string(req.EndKey),
+		StartExclusive: req.StartExclusive,
+		EndInclusive:   req.EndInclusive,
+		Limit:          int(req.Limit),
+		Cursor:         string(req.Cursor),
+		Reverse:        req.Reverse,
+		Filter:         toFilter(req.Filter),
+	}
+	if len(req.Prefix) > 0 {
+		if opts.StartKey != "" || opts.EndKey != "" {
+			return opts, invalidArgument("prefix cannot be combined with start_key or end_key")
+		}
+		opts.StartKey, opts.EndKey = string(req.Prefix), kvstore.PrefixEnd(string(req.Prefix))
+	}
+	if opts.Limit < 0 {
+		return opts, invalidArgument("invalid limit: %d", opts.Limit)
+	}
+	if opts.Filter != nil {
+		if err := opts.Filter.Validate(); err != nil {
+			return opts, invalidArgument("invalid filter: %v", err)
+		}
+	}
+	return opts, nil
+}
+
+func toBatchOperations(operations []*pb.Operation) []kvstore.BatchOperation {
+	batchOps := make([]kvstore.BatchOperation, len(operations))
+	for i, op := range operations {
+		batchOps[i] = kvstore.BatchOperation{
+			Type:     enumName(op.Type),
+			Key:      string(op.Key),
+			EndKey:   string(op.EndKey),
+			TTL:      op.TtlSeconds,
+			Encoding: op.Encoding,
+		}
+		switch op.Type {
+		case pb.Operation_SET, pb.Operation_APPEND:
+			batchOps[i].Value = string(op.Value)
+		case pb.Operation_INCREMENT:
+			batchOps[i].Value = strconv.FormatInt(op.Delta, 10)
+		}
+	}
+	return batchOps
+}
+
+func toCondition(c *pb.Condition) (kvstore.Condition, error) {
+	if c == nil {
+		return kvstore.Condition{}, invalidArgument("condition is required")
+	}
+	return kvstore.Condition{
+		Type:      enumName(c.Type),
+		Value:     string(c.Value),
+		Version:   c.Version,
+		Family:    c.Family,
+		Qualifier: c.Qualifier,
+	}, nil
+}
+
+func toGCRule(rule *pb.GCRule) *kvstore.GCRule {
+	if rule == nil {
+		return nil
+	}
+	gc := &kvstore.GCRule{MaxVersions: int(rule.MaxVersions), MaxAge: rule.MaxAgeSeconds}
+	for _, r := range rule.Union {
+		gc.Union = append(gc.Union, *toGCRule(r))
+	}
+	for _, r := range rule.Intersection {
+		gc.Intersection = append(gc.Intersection, *toGCRule(r))
+	}
+	return gc
+}
+
+func fromGCRule(rule *kvstore.GCRule) *pb.GCRule {
+	if rule == nil {
+		return nil
+	}
+	gc := &pb.GCRule{MaxVersions: int32(rule.MaxVersions), MaxAgeSeconds: rule.MaxAge}
+	for i := range rule.Union {
+		gc.Union = append(gc.Union, fromGCRule(&rule.Union[i]))
+	}
+	for i := range rule.Intersection {
+		gc.Intersection = append(gc.Intersection, fromGCRule(&rule.Intersection[i]))
+	}
+	return gc
+}
+
+func toColumnFamily(f *pb.ColumnFamily) kvstore.ColumnFamily {
+	if f == nil {
+		return kvstore.ColumnFamily{}
+	}
+	return kvstore.ColumnFamily{Name: f.Name, GCRule: toGCRule(f.GcRule)}
+}
+
+func toMutations(mutations []*pb.Mutation) []kvstore.Mutation {
+	result := make([]kvstore.Mutation, len(mutations))
+	for i, m := range mutations {
+		result[i] = kvstore.Mutation{
+			Type:           enumName(m.Type),
+			Family:         m.Family,
+			Qualifier:      m.Qualifier,
+			Value:          string(m.Value),
+			Timestamp:      m.Timestamp,
+			StartTimestamp: m.StartTimestamp,
+			EndTimestamp:   m.EndTimestamp,
+		}
+	}
+	return result
+}
+
+func toReadOptions(opts *pb.ReadOptions) (kvstore.ReadOptions, error) {
+	if opts == nil {
+		return kvstore.ReadOptions{}, nil
+	}
+	readOpts := kvstore.ReadOptions{
+		MaxVersions:    int(opts.MaxVersions),
+		StartTimestamp: opts.StartTimestamp,
+		EndTimestamp:   opts.EndTimestamp,
+		Filter:         toFilter(opts.Filter),
+	}
+	if readOpts.Filter != nil {
+		if err := readOpts.Filter.Validate(); err != nil {
+			return readOpts, invalidArgument("invalid filter: %v", err)
+		}
+	}
+	return readOpts, nil
+}
+
+func fromRow(row kvstore.Row) *pb.Row {
+	cells := make([]*pb.Cell, len(row.Cells))
+	for i, cell := range row.Cells {
+		cells[i] = &pb.Cell{
+			Family:    cell.Family,
+			Qualifier: cell.Qualifier,
+			Timestamp: cell.Timestamp,
+			Value:     []byte(cell.Value),
+		}
+	}
+	return &pb.Row{Key: []byte(row.Key), Cells: cells}
+}
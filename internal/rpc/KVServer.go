@@ -0,0 +1,395 @@
+package rpc
+
+import (
+	"bigtable/internal/kvstore"
+	"bigtable/internal/node"
+	"bigtable/internal/rpc/pb"
+	"context"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+)
+
+// KVServer serves the KV gRPC service from the same KVNode as the REST API.
+type KVServer struct {
+	pb.UnimplementedKVServer
+	node *node.KVNode
+}
+
+func NewKVServer(node *node.KVNode) *KVServer {
+	return &KVServer{node: node}
+}
+
+func (s *KVServer) Get(ctx context.Context, req *pb.GetRequest) (*pb.GetResponse, error) {
+	if len(req.Key) == 0 {
+		return nil, invalidArgument("key is required")
+	}
+	value, version, err := s.node.GetWithVersion(string(req.Key))
+	if err != nil {
+		return nil, toStatus(err, codes.Internal)
+	}
+	return &pb.GetResponse{Value: []byte(value), Version: version}, nil
+}
+
+func (s *KVServer) MultiGet(ctx context.Context, req *pb.MultiGetRequest) (*pb.MultiGetResponse, error) {
+	if len(req.Keys) > maxPageSize {
+		return nil, invalidArgument("at most %d keys per request", maxPageSize)
+	}
+	keys := make([]string, len(req.Keys))
+	for i, key := range req.Keys {
+		keys[i] = string(key)
+	}
+
+	results, err := s.node.MultiGet(keys)
+	if err != nil {
+		return nil, toStatus(err, codes.Internal)
+	}
+	resp := &pb.MultiGetResponse{Entries: make([]*pb.MultiGetResponse_Entry, len(results))}
+	for i, result := range results {
+		resp.Entries[i] = &pb.MultiGetResponse_Entry{Key: []byte(result.Key), Found: result.Found}
+		if result.Found {
+			resp.Entries[i].Value = []byte(result.Value)
+		}
+	}
+	return resp, nil
+}
+
+func (s *KVServer) Set(ctx context.Context, req *pb.SetRequest) (*pb.SetResponse, error) {
+	if len(req.Key) == 0 {
+		return nil, invalidArgument("key is required")
+	}
+	if req.TtlSeconds < 0 {
+		return nil, invalidArgument("invalid ttl: %d", req.TtlSeconds)
+	}
+	if err := s.node.SetWithTTL(string(req.Key), string(req.Value), time.Duration(req.TtlSeconds)*time.Second); err != nil {
+		return nil, toStatus(err, codes.Internal)
+	}
+	return &pb.SetResponse{}, nil
+}
+
+func (s *KVServer) Delete(ctx context.Context, req *pb.DeleteRequest) (*pb.DeleteResponse, error) {
+	if len(req.Key) == 0 {
+		return nil, invalidArgument("key is required")
+	}
+	if err := s.node.Delete(string(req.Key)); err != nil {
+		return nil, toStatus(err, codes.Internal)
+	}
+	return &pb.DeleteResponse{}, nil
+}
+
+func (s *KVServer) DeletePrefix(ctx context.Context, req *pb.DeletePrefixRequest) (*pb.DeleteRangeResponse, error) {
+	prefix := string(req.Prefix)
+	if req.DryRun {
+		count, complete, err := s.node.CountKeys(prefix, defaultCountScanLimit)
+		if err != nil {
+			return nil, toStatus(err, codes.Internal)
+		}
+		return &pb.DeleteRangeResponse{Count: int64(count), Complete: complete}, nil
+	}
+	if err := s.node.DeletePrefix(prefix); err != nil {
+		return nil, toStatus(err, codes.Internal)
+	}
+	return &pb.DeleteRangeResponse{}, nil
+}
+
+func (s *KVServer) DeleteRange(ctx context.Context, req *pb.DeleteRangeRequest) (*pb.DeleteRangeResponse, error) {
+	startKey, endKey := string(req.StartKey), string(req.EndKey)
+	if req.DryRun {
+		count, complete, err := s.node.CountRange(startKey, endKey, defaultCountScanLimit)
+		if err != nil {
+			return nil, toStatus(err, codes.Internal)
+		}
+		return &pb.DeleteRangeResponse{Count: int64(count), Complete: complete}, nil
+	}
+	if err := s.node.DeleteRange(startKey, endKey); err != nil {
+		return nil, toStatus(err, codes.Internal)
+	}
+	return &pb.DeleteRangeResponse{}, nil
+}
+
+func (s *KVServer) Batch(ctx context.Context, req *pb.BatchRequest) (*pb.BatchResponse, error) {
+	results, err := s.node.BatchWriteWithResults(toBatchOperations(req.Operations))
+	if err != nil {
+		return nil, toStatus(err, codes.Internal)
+	}
+	resp := &pb.BatchResponse{Results: make([][]byte, len(results))}
+	for i, result := range results {
+		resp.Results[i] = []byte(result)
+	}
+	return resp, nil
+}
+
+func (s *KVServer) CheckAndMutate(ctx context.Context, req *pb.CheckAndMutateRequest) (*pb.CheckAndMutateResponse, error) {
+	if len(req.Key) == 0 {
+		return nil, invalidArgument("key is required")
+	}
+	cond, err := toCondition(req.Condition)
+	if err != nil {
+		return nil, err
+	}
+	matched, err := s.node.CheckAndMutate(string(req.Key), cond, toBatchOperations(req.OnTrue), toBatchOperations(req.OnFalse))
+	if err != nil {
+		return nil, toStatus(err, codes.Internal)
+	}
+	return &pb.CheckAndMutateResponse{Matched: matched}, nil
+}
+
+func (s *KVServer) Increment(ctx context.Context, req *pb.IncrementRequest) (*pb.IncrementResponse, error) {
+	if len(req.Key) == 0 {
+		return nil, invalidArgument("key is required")
+	}
+	value, err := s.node.Increment(string(req.Key), req.Delta, req.Encoding)
+	if err != nil {
+		return nil, toStatus(err, codes.Internal)
+	}
+	return &pb.IncrementResponse{Value: value}, nil
+}
+
+func (s *KVServer) Append(ctx context.Context, req *pb.AppendRequest) (*pb.AppendResponse, error) {
+	if len(req.Key) == 0 {
+		return nil, invalidArgument("key is required")
+	}
+	value, err := s.node.Append(string(req.Key), string(req.Value), req.Encoding)
+	if err != nil {
+		return nil, toStatus(err, codes.Internal)
+	}
+	return &pb.AppendResponse{Value: []byte(value)}, nil
+}
+
+func (s *KVServer) Range(ctx context.Context, req *pb.RangeRequest) (*pb.RangeResponse, error) {
+	opts, err := toRangeOptions(req)
+	if err != nil {
+		return nil, err
+	}
+	if opts.Limit == 0 {
+		opts.Limit = defaultPageSize
+	}
+	opts.Limit = min(opts.Limit, maxPageSize)
+
+	items, nextCursor, err := s.node.RangeQuery(opts)
+	if err != nil {
+		return nil, toStatus(err, codes.Internal)
+	}
+	resp := &pb.RangeResponse{Items: make([]*pb.KeyValue, len(items)), NextCursor: []byte(nextCursor)}
+	for i, item := range items {
+		resp.Items[i] = &pb.KeyValue{Key: []byte(item.Key), Value: []byte(item.Value)}
+	}
+	return resp, nil
+}
+
+func (s *KVServer) Scan(req *pb.RangeRequest, stream pb.KV_ScanServer) error {
+	opts, err := toRangeOptions(req)
+	if err != nil {
+		return err
+	}
+
+	chunk := &pb.ScanResponse{}
+	nextCursor, err := s.node.StreamRange(stream.Context(), opts, func(key, value []byte) error {
+		// The iterator reuses key and value
+		chunk.Items = append(chunk.Items, &pb.KeyValue{
+			Key:   append([]byte(nil), key...),
+			Value: append([]byte(nil), value...),
+		})
+		if len(chunk.Items) < scanChunkSize {
+			return nil
+		}
+		err := stream.Send(chunk)
+		chunk = &pb.ScanResponse{}
+		return err
+	})
+	if err != nil {
+		return toStatus(err, codes.Internal)
+	}
+	chunk.NextCursor = []byte(nextCursor)
+	return stream.Send(chunk)
+}
+
+func (s *KVServer) ScanKeys(req *pb.RangeRequest, stream pb.KV_ScanKeysServer) error {
+	opts, err := toRangeOptions(req)
+	if err != nil {
+		return err
+	}
+
+	chunk := &pb.ScanKeysResponse{}
+	nextCursor, err := s.node.StreamRange(stream.Context(), opts, func(key, _ []byte) error {
+		chunk.Keys = append(chunk.Keys, append([]byte(nil), key...))
+		if len(chunk.Keys) < scanChunkSize {
+			return nil
+		}
+		err := stream.Send(chunk)
+		chunk = &pb.ScanKeysResponse{}
+		return err
+	})
+	if err != nil {
+		return toStatus(err, codes.Internal)
+	}
+	chunk.NextCursor = []byte(nextCursor)
+	return stream.Send(chunk)
+}
+
+// ScanKeysLower pages through the store like /scankeylower and sends each
+// page as one message.
+func (s *KVServer) ScanKeysLower(req *pb.ScanKeysLowerRequest, stream pb.KV_ScanKeysLowerServer) error {
+	if len(req.Prefix) == 0 {
+		return invalidArgument("prefix is required")
+	}
+	if req.Limit < 0 {
+		return invalidArgument("invalid limit: %d", req.Limit)
+	}
+	maxTimestamp := req.MaxTimestamp
+	if maxTimestamp == 0 {
+		maxTimestamp = time.Now().Unix()
+	}
+
+	cursor := string(req.Cursor)
+	remaining := int(req.Limit)
+	for {
+		if err := stream.Context().Err(); err != nil {
+			return toStatus(err, codes.Canceled)
+		}
+		pageSize := defaultPageSize
+		if req.Limit > 0 {
+			pageSize = min(pageSize, remaining)
+		}
+
+		keys, nextCursor, err := s.node.ScanKeysLower(string(req.Prefix), maxTimestamp, cursor, pageSize)
+		if err != nil {
+			return toStatus(err, codes.Internal)
+		}
+		remaining -= len(keys)
+
+		chunk := &pb.ScanKeysResponse{Keys: make([][]byte, len(keys))}
+		for i, key := range keys {
+			chunk.Keys[i] = []byte(key)
+		}
+		last := nextCursor == "" || (req.Limit > 0 && remaining <= 0)
+		if last {
+			chunk.NextCursor = []byte(nextCursor)
+		}
+		if err := stream.Send(chunk); err != nil {
+			return err
+		}
+		if last {
+			return nil
+		}
+		cursor = nextCursor
+	}
+}
+
+func (s *KVServer) ScanOffset(ctx context.Context, req *pb.ScanOffsetRequest) (*pb.ScanOffsetResponse, error) {
+	if len(req.Prefix) == 0 {
+		return nil, invalidArgument("prefix is required")
+	}
+	key, err := s.node.ScanOffset(string(req.Prefix), int(req.Offset))
+	if err != nil {
+		return nil, toStatus(err, codes.Internal)
+	}
+	return &pb.ScanOffsetResponse{Key: []byte(key)}, nil
+}
+
+func (s *KVServer) TotalKey(ctx context.Context, req *pb.TotalKeyRequest) (*pb.TotalKeyResponse, error) {
+	if len(req.Prefix) == 0 {
+		return nil, invalidArgument("prefix is required")
+	}
+	prefix := string(req.Prefix)
+
+	estimate, err := s.node.EstimateKeys(prefix)
+	if err != nil {
+		return nil, toStatus(err, codes.Internal)
+	}
+	resp := &pb.TotalKeyResponse{Estimate: estimate.Keys, Bytes: estimate.Bytes, Source: estimate.Source}
+
+	if req.Exact {
+		maxScan := defaultCountScanLimit
+		if req.MaxScan > 0 {
+			maxScan = int(req.MaxScan)
+		}
+		count, complete, err := s.node.CountKeys(prefix, maxScan)
+		if err != nil {
+			return nil, toStatus(err, codes.Internal)
+		}
+		resp.Exact, resp.Complete = int64(count), complete
+	}
+	return resp, nil
+}
+
+func (s *KVServer) EnableCounter(ctx context.Context, req *pb.CounterRequest) (*pb.CounterResponse, error) {
+	count, err := s.node.EnableCounter(string(req.Prefix))
+	if err != nil {
+		return nil, toStatus(err, codes.InvalidArgument)
+	}
+	return &pb.CounterResponse{Count: count}, nil
+}
+
+func (s *KVServer) DisableCounter(ctx context.Context, req *pb.CounterRequest) (*pb.CounterResponse, error) {
+	if err := s.node.DisableCounter(string(req.Prefix)); err != nil {
+		return nil, toStatus(err, codes.Internal)
+	}
+	return &pb.CounterResponse{}, nil
+}
+
+func (s *KVServer) Aggregate(ctx context.Context, req *pb.AggregateRequest) (*pb.AggregateResponse, error) {
+	if req.Range == nil {
+		return nil, invalidArgument("range is required")
+	}
+	opts, err := toRangeOptions(req.Range)
+	if err != nil {
+		return nil, err
+	}
+	if opts.StartKey == "" && opts.EndKey == "" {
+		return nil, invalidArgument("missing prefix or key range")
+	}
+	if req.GroupBy < 0 {
+		return nil, invalidArgument("invalid group_by: %d", req.GroupBy)
+	}
+
+	results, err := s.node.Aggregate(ctx, opts, kvstore.AggregateSpec{
+		Field:     req.Field,
+		GroupBy:   int(req.GroupBy),
+		Delimiter: req.Delimiter,
+	})
+	if err != nil {
+		return nil, toStatus(err, codes.Internal)
+	}
+	resp := &pb.AggregateResponse{Results: make([]*pb.AggregateResponse_Result, len(results))}
+	for i, result := range results {
+		resp.Results[i] = &pb.AggregateResponse_Result{
+			Group:  []byte(result.Group),
+			Count:  result.Count,
+			Values: result.Values,
+			Sum:    result.Sum,
+			Min:    result.Min,
+			Max:    result.Max,
+			Avg:    result.Avg,
+		}
+	}
+	return resp, nil
+}
+
+func (s *KVServer) Watch(req *pb.WatchRequest, stream pb.KV_WatchServer) error {
+	after := s.node.LastChangeSeq()
+	if req.After != nil {
+		after = *req.After
+	}
+	if err := s.node.CheckResume(after); err != nil {
+		return toStatus(err, codes.Internal)
+	}
+	// The headers tell the client the watch is in place
+	if err := stream.SendHeader(metadata.MD{}); err != nil {
+		return err
+	}
+	err := s.node.WatchChanges(stream.Context(), string(req.Prefix), after, func(change kvstore.Change) error {
+		return stream.Send(&pb.ChangeEvent{
+			Seq:       change.Seq,
+			Type:      change.Type,
+			Key:       []byte(change.Key),
+			EndKey:    []byte(change.EndKey),
+			Value:     []byte(change.Value),
+			Version:   change.Version,
+			ExpiresAt: change.ExpiresAt,
+			Time:      change.Time,
+		})
+	})
+	return toStatus(err, codes.Internal)
+}
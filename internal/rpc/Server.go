@@ -0,0 +1,20 @@
+package rpc
+
+import (
+	"bigtable/internal/node"
+	"bigtable/internal/rpc/pb"
+
+	"google.golang.org/grpc"
+)
+
+//go:generate protoc -I pb --go_out=pb --go_opt=paths=source_relative --go-grpc_out=pb --go-grpc_opt=paths=source_relative pb/kv.proto
+
+// NewServer returns a gRPC server with the KV, Tables and Transactions
+// services registered on node.
+func NewServer(node *node.KVNode, opts ...grpc.ServerOption) *grpc.Server {
+	server := grpc.NewServer(opts...)
+	pb.RegisterKVServer(server, NewKVServer(node))
+	pb.RegisterTablesServer(server, NewTablesServer(node))
+	pb.RegisterTransactionsServer(server, NewTransactionsServer(node))
+	return server
+}
@@ -0,0 +1,147 @@
+package rpc
+
+import (
+	"bigtable/internal/kvstore"
+	"bigtable/internal/node"
+	"bigtable/internal/rpc/pb"
+	"context"
+	"sort"
+
+	"google.golang.org/grpc/codes"
+)
+
+// TablesServer serves the Tables gRPC service.
+type TablesServer struct {
+	pb.UnimplementedTablesServer
+	node *node.KVNode
+}
+
+func NewTablesServer(node *node.KVNode) *TablesServer {
+	return &TablesServer{node: node}
+}
+
+func (s *TablesServer) CreateTable(ctx context.Context, req *pb.CreateTableRequest) (*pb.CreateTableResponse, error) {
+	families := make([]kvstore.ColumnFamily, len(req.ColumnFamilies))
+	for i, f := range req.ColumnFamilies {
+		families[i] = toColumnFamily(f)
+	}
+	if err := s.node.CreateTable(req.Name, families); err != nil {
+		return nil, toStatus(err, codes.InvalidArgument)
+	}
+	return &pb.CreateTableResponse{}, nil
+}
+
+func (s *TablesServer) ListTables(ctx context.Context, req *pb.ListTablesRequest) (*pb.ListTablesResponse, error) {
+	tables, err := s.node.ListTables()
+	if err != nil {
+		return nil, toStatus(err, codes.Internal)
+	}
+
+	resp := &pb.ListTablesResponse{Tables: make([]*pb.TableInfo, len(tables))}
+	for i, table := range tables {
+		info := &pb.TableInfo{Name: table.Name, CreatedAt: table.CreatedAt}
+		for _, family := range table.ColumnFamilies {
+			info.ColumnFamilies = append(info.ColumnFamilies, &pb.ColumnFamily{Name: family.Name, GcRule: fromGCRule(family.GCRule)})
+		}
+		sort.Slice(info.ColumnFamilies, func(a, b int) bool {
+			return info.ColumnFamilies[a].Name < info.ColumnFamilies[b].Name
+		})
+		resp.Tables[i] = info
+	}
+	return resp, nil
+}
+
+func (s *TablesServer) DeleteTable(ctx context.Context, req *pb.DeleteTableRequest) (*pb.DeleteTableResponse, error) {
+	if err := s.node.DeleteTable(req.Name); err != nil {
+		return nil, toStatus(err, codes.Internal)
+	}
+	return &pb.DeleteTableResponse{}, nil
+}
+
+func (s *TablesServer) SetColumnFamily(ctx context.Context, req *pb.SetColumnFamilyRequest) (*pb.SetColumnFamilyResponse, error) {
+	if err := s.node.SetColumnFamily(req.Table, toColumnFamily(req.Family)); err != nil {
+		return nil, toStatus(err, codes.InvalidArgument)
+	}
+	return &pb.SetColumnFamilyResponse{}, nil
+}
+
+func (s *TablesServer) DropColumnFamily(ctx context.Context, req *pb.DropColumnFamilyRequest) (*pb.DropColumnFamilyResponse, error) {
+	if err := s.node.DropColumnFamily(req.Table, req.Family); err != nil {
+		return nil, toStatus(err, codes.Internal)
+	}
+	return &pb.DropColumnFamilyResponse{}, nil
+}
+
+func (s *TablesServer) MutateRow(ctx context.Context, req *pb.MutateRowRequest) (*pb.MutateRowResponse, error) {
+	if err := s.node.MutateRow(req.Table, string(req.Row), toMutations(req.Mutations)); err != nil {
+		return nil, toStatus(err, codes.InvalidArgument)
+	}
+	return &pb.MutateRowResponse{}, nil
+}
+
+func (s *TablesServer) CheckAndMutateRow(ctx context.Context, req *pb.CheckAndMutateRowRequest) (*pb.CheckAndMutateResponse, error) {
+	cond, err := toCondition(req.Condition)
+	if err != nil {
+		return nil, err
+	}
+	matched, err := s.node.CheckAndMutateRow(req.Table, string(req.Row), cond, toMutations(req.OnTrue), toMutations(req.OnFalse))
+	if err != nil {
+		return nil, toStatus(err, codes.InvalidArgument)
+	}
+	return &pb.CheckAndMutateResponse{Matched: matched}, nil
+}
+
+func (s *TablesServer) ReadRow(ctx context.Context, req *pb.ReadRowRequest) (*pb.ReadRowResponse, error) {
+	opts, err := toReadOptions(req.Options)
+	if err != nil {
+		return nil, err
+	}
+	row, err := s.node.ReadRow(req.Table, string(req.Row), opts)
+	if err != nil {
+		return nil, toStatus(err, codes.Internal)
+	}
+	return &pb.ReadRowResponse{Row: fromRow(*row)}, nil
+}
+
+// ReadRows pages through the rows and sends each page as one message.
+func (s *TablesServer) ReadRows(req *pb.ReadRowsRequest, stream pb.Tables_ReadRowsServer) error {
+	opts, err := toReadOptions(req.Options)
+	if err != nil {
+		return err
+	}
+	if req.Limit < 0 {
+		return invalidArgument("invalid limit: %d", req.Limit)
+	}
+
+	startKey := string(req.StartKey)
+	remaining := int(req.Limit)
+	for {
+		if err := stream.Context().Err(); err != nil {
+			return toStatus(err, codes.Canceled)
+		}
+		pageSize := scanChunkSize
+		if req.Limit > 0 {
+			pageSize = min(pageSize, remaining)
+		}
+
+		rows, nextCursor, err := s.node.ReadRows(req.Table, startKey, string(req.EndKey), pageSize, opts)
+		if err != nil {
+			return toStatus(err, codes.Internal)
+		}
+		remaining -= len(rows)
+
+		chunk := &pb.ReadRowsResponse{Rows: make([]*pb.Row, len(rows))}
+		for i, row := range rows {
+			chunk.Rows[i] = fromRow(row)
+		}
+		if len(rows) > 0 {
+			if err := stream.Send(chunk); err != nil {
+				return err
+			}
+		}
+		if nextCursor == "" || (req.Limit > 0 && remaining <= 0) {
+			return nil
+		}
+		startKey = nextCursor
+	}
+}
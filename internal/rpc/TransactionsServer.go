@@ -0,0 +1,71 @@
+package rpc
+
+import (
+	"bigtable/internal/kvstore"
+	"bigtable/internal/node"
+	"bigtable/internal/rpc/pb"
+	"context"
+	"time"
+
+	"google.golang.org/grpc/codes"
+)
+
+// TransactionsServer serves the Transactions gRPC service. Transaction IDs
+// are shared with the REST API, so a transaction begun on one can be used
+// from the other.
+type TransactionsServer struct {
+	pb.UnimplementedTransactionsServer
+	node *node.KVNode
+}
+
+func NewTransactionsServer(node *node.KVNode) *TransactionsServer {
+	return &TransactionsServer{node: node}
+}
+
+func (s *TransactionsServer) Begin(ctx context.Context, req *pb.BeginRequest) (*pb.BeginResponse, error) {
+	timeout := time.Duration(req.TimeoutSeconds) * time.Second
+	if req.TimeoutSeconds < 0 || timeout > kvstore.MaxTxnTimeout {
+		return nil, invalidArgument("timeout must be between 0 and %d seconds", int64(kvstore.MaxTxnTimeout/time.Second))
+	}
+	if timeout == 0 {
+		timeout = kvstore.DefaultTxnTimeout
+	}
+
+	id, err := s.node.BeginTransaction(timeout)
+	if err != nil {
+		return nil, toStatus(err, codes.Internal)
+	}
+	return &pb.BeginResponse{Id: id, TimeoutSeconds: int64(timeout / time.Second)}, nil
+}
+
+func (s *TransactionsServer) Get(ctx context.Context, req *pb.TxnGetRequest) (*pb.GetResponse, error) {
+	if len(req.Key) == 0 {
+		return nil, invalidArgument("key is required")
+	}
+	value, version, err := s.node.TxnGet(req.Id, string(req.Key))
+	if err != nil {
+		return nil, toStatus(err, codes.Internal)
+	}
+	return &pb.GetResponse{Value: []byte(value), Version: version}, nil
+}
+
+func (s *TransactionsServer) Write(ctx context.Context, req *pb.TxnWriteRequest) (*pb.TxnWriteResponse, error) {
+	if err := s.node.TxnWrite(req.Id, toBatchOperations(req.Operations)); err != nil {
+		return nil, toStatus(err, codes.Internal)
+	}
+	return &pb.TxnWriteResponse{}, nil
+}
+
+func (s *TransactionsServer) Commit(ctx context.Context, req *pb.CommitRequest) (*pb.CommitResponse, error) {
+	if err := s.node.CommitTransaction(req.Id); err != nil {
+		return nil, toStatus(err, codes.Internal)
+	}
+	return &pb.CommitResponse{}, nil
+}
+
+func (s *TransactionsServer) Rollback(ctx context.Context, req *pb.RollbackRequest) (*pb.RollbackResponse, error) {
+	if err := s.node.RollbackTransaction(req.Id); err != nil {
+		return nil, toStatus(err, codes.Internal)
+	}
+	return &pb.RollbackResponse{}, nil
+}
@@ -0,0 +1,58 @@
+package test
+
+import (
+	"bigtable/internal/kvstore"
+	"context"
+	"testing"
+)
+
+func TestAggregate(t *testing.T) {
+	store, err := kvstore.NewKVStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to create KVStore: %v", err)
+	}
+	defer store.Close()
+
+	orders := map[string]string{
+		"order:kr:1": `{"total":10}`,
+		"order:kr:2": `{"total":30}`,
+		"order:us:1": `{"total":5.5}`,
+		"order:us:2": `{"total":"n/a"}`,
+		"visits":     `42`,
+	}
+	for key, value := range orders {
+		if err := store.Set(key, value); err != nil {
+			t.Fatalf("Set failed: %v", err)
+		}
+	}
+
+	prefix := kvstore.RangeOptions{StartKey: "order:", EndKey: kvstore.PrefixEnd("order:")}
+	results, err := store.Aggregate(context.Background(), prefix, kvstore.AggregateSpec{Field: "total"})
+	if err != nil {
+		t.Fatalf("Aggregate failed: %v", err)
+	}
+	if len(results) != 1 {
+		t.Fatalf("Expected one group, got %+v", results)
+	}
+	all := results[0]
+	if all.Count != 4 || all.Values != 3 || all.Sum != 45.5 || *all.Min != 5.5 || *all.Max != 30 {
+		t.Errorf("Unexpected totals: %+v", all)
+	}
+
+	results, err = store.Aggregate(context.Background(), prefix, kvstore.AggregateSpec{Field: "total", GroupBy: 2})
+	if err != nil {
+		t.Fatalf("Aggregate failed: %v", err)
+	}
+	if len(results) != 2 || results[0].Group != "kr" || results[1].Group != "us" {
+		t.Fatalf("Expected kr and us groups, got %+v", results)
+	}
+	if *results[0].Avg != 20 || results[1].Count != 2 || results[1].Values != 1 {
+		t.Errorf("Unexpected group stats: %+v %+v", results[0], results[1])
+	}
+
+	// Without a field the value itself is the number
+	results, err = store.Aggregate(context.Background(), kvstore.RangeOptions{StartKey: "visits", EndKey: "visits", EndInclusive: true}, kvstore.AggregateSpec{})
+	if err != nil || len(results) != 1 || results[0].Sum != 42 {
+		t.Errorf("Expected a sum of 42, got %+v (%v)", results, err)
+	}
+}
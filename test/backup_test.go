@@ -0,0 +1,159 @@
+package test
+
+import (
+	"bigtable/internal/backup"
+	"bigtable/internal/kvstore"
+	"bigtable/internal/rest"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBackup(t *testing.T) {
+	n := newTestNode(t)
+	root := t.TempDir()
+
+	n.Set("a", "1")
+	n.SetWithOptions("b", "2", 0, kvstore.WriteOptions{Durability: kvstore.DurabilityNoSync})
+	dir, manifest, err := backup.Create(n, root)
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	n.Set("c", "3")
+	if len(manifest.Files) == 0 || manifest.Size() == 0 {
+		t.Fatalf("Expected files in the manifest, got %+v", manifest)
+	}
+	if _, err := backup.Verify(dir); err != nil {
+		t.Fatalf("Verify failed: %v", err)
+	}
+
+	// The backup is a database of its own, as of Create
+	restored := filepath.Join(t.TempDir(), "restored")
+	if err := os.CopyFS(restored, os.DirFS(dir)); err != nil {
+		t.Fatalf("Copy failed: %v", err)
+	}
+	store, err := kvstore.NewKVStore(restored)
+	if err != nil {
+		t.Fatalf("Failed to open backup: %v", err)
+	}
+	if v, err := store.Get("b"); err != nil || v != "2" {
+		t.Errorf("Expected the nosync write in the backup, got %q (%v)", v, err)
+	}
+	if _, err := store.Get("c"); err == nil {
+		t.Errorf("Expected the later write to be missing")
+	}
+	store.Close()
+
+	// Damage is reported file by file
+	victim := filepath.Join(dir, manifest.Files[0].Path)
+	if err := os.WriteFile(victim, []byte("garbage"), 0o644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	os.WriteFile(filepath.Join(dir, "extra"), nil, 0o644)
+	_, err = backup.Verify(dir)
+	if !errors.Is(err, backup.ErrCorrupt) || !strings.Contains(err.Error(), manifest.Files[0].Path) || !strings.Contains(err.Error(), "extra is not in the manifest") {
+		t.Errorf("Expected both problems, got %v", err)
+	}
+}
+
+func TestBackupRetention(t *testing.T) {
+	n := newTestNode(t)
+	root := t.TempDir()
+	manager := backup.NewManager(n, root, 2)
+
+	var names []string
+	for i := 0; i < 3; i++ {
+		info, err := manager.Create()
+		if err != nil {
+			t.Fatalf("Create failed: %v", err)
+		}
+		names = append(names, info.Name)
+		time.Sleep(2 * time.Millisecond)
+	}
+	os.Mkdir(filepath.Join(root, "backup-crashed.partial"), 0o755)
+
+	backups, err := manager.List()
+	if err != nil || len(backups) != 2 || backups[0].Name != names[1] || backups[1].Name != names[2] {
+		t.Fatalf("Expected the newest two backups, got %+v (%v)", backups, err)
+	}
+	if _, err := os.Stat(filepath.Join(root, "backup-crashed.partial")); err != nil {
+		t.Errorf("Expected a fresh partial backup to stay: %v", err)
+	}
+
+	manager.Schedule(10 * time.Millisecond)
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		backups, _ := manager.List()
+		if backups[len(backups)-1].Name != names[2] {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected a scheduled backup")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	manager.Close()
+}
+
+func TestBackupREST(t *testing.T) {
+	n := newTestNode(t)
+	service := rest.NewKVStoreService(n)
+	server := rest.NewServer(service)
+	server.SetupRoutes()
+	ts := httptest.NewServer(server.Handler())
+	t.Cleanup(ts.Close)
+
+	resp, body := doRequest(t, http.MethodPost, ts.URL+"/v1/admin/backups", "")
+	expectError(t, resp, body, http.StatusNotFound, rest.CodeNotFound)
+
+	root := t.TempDir()
+	service.SetBackups(backup.NewManager(n, root, 0))
+	n.Set("k", "v")
+	resp, body = doRequest(t, http.MethodPost, ts.URL+"/v1/admin/backups", "")
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("Expected 201, got %d: %s", resp.StatusCode, body)
+	}
+	var info backup.Info
+	if err := json.Unmarshal([]byte(body), &info); err != nil || !strings.HasPrefix(info.Name, "backup-") || info.Files == 0 {
+		t.Fatalf("Unexpected backup %s (%v)", body, err)
+	}
+
+	resp, body = doRequest(t, http.MethodGet, ts.URL+"/v1/admin/backups", "")
+	if resp.StatusCode != http.StatusOK || !strings.Contains(body, info.Name) {
+		t.Errorf("Expected the backup in the list, got %d: %s", resp.StatusCode, body)
+	}
+
+	resp, body = doRequest(t, http.MethodPost, ts.URL+"/v1/admin/backups/"+info.Name+"/verify", "")
+	var verified rest.BackupVerifyResponse
+	if err := json.Unmarshal([]byte(body), &verified); err != nil || resp.StatusCode != http.StatusOK || !verified.Valid {
+		t.Errorf("Expected a valid backup, got %d: %s", resp.StatusCode, body)
+	}
+
+	// A damaged or missing manifest makes the backup invalid, not unknown
+	manifestPath := filepath.Join(root, info.Name, backup.ManifestFile)
+	for _, damage := range []func() error{
+		func() error { return os.WriteFile(manifestPath, []byte("{"), 0o644) },
+		func() error { return os.WriteFile(manifestPath, []byte(`{"version":9}`), 0o644) },
+		func() error { return os.Remove(manifestPath) },
+	} {
+		if err := damage(); err != nil {
+			t.Fatalf("Failed to damage the manifest: %v", err)
+		}
+		resp, body = doRequest(t, http.MethodPost, ts.URL+"/v1/admin/backups/"+info.Name+"/verify", "")
+		verified = rest.BackupVerifyResponse{}
+		if err := json.Unmarshal([]byte(body), &verified); err != nil || resp.StatusCode != http.StatusOK || verified.Valid || verified.Error == "" {
+			t.Errorf("Expected an invalid backup, got %d: %s", resp.StatusCode, body)
+		}
+	}
+
+	resp, body = doRequest(t, http.MethodPost, ts.URL+"/v1/admin/backups/backup-none/verify", "")
+	expectError(t, resp, body, http.StatusNotFound, rest.CodeNotFound)
+	resp, body = doRequest(t, http.MethodPost, ts.URL+"/v1/admin/backups/other/verify", "")
+	expectError(t, resp, body, http.StatusBadRequest, rest.CodeInvalidArgument)
+}
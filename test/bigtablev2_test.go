@@ -0,0 +1,149 @@
+package test
+
+import (
+	"bigtable/internal/bigtablev2"
+	"bigtable/internal/rpc"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/bigtable"
+	"google.golang.org/api/option"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// newBigtableClients starts a gRPC server with the v2 services and connects
+// the official Cloud Bigtable clients to it.
+func newBigtableClients(t *testing.T) (*bigtable.Client, *bigtable.AdminClient) {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	kvNode := newTestNode(t)
+	server := rpc.NewServer(kvNode)
+	bigtablev2.Register(server, kvNode)
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.NewClient(listener.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("NewClient failed: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	ctx := context.Background()
+	config := bigtable.ClientConfig{MetricsProvider: bigtable.NoopMetricsProvider{}}
+	client, err := bigtable.NewClientWithConfig(ctx, "p", "i", config, option.WithGRPCConn(conn))
+	if err != nil {
+		t.Fatalf("bigtable.NewClient failed: %v", err)
+	}
+	admin, err := bigtable.NewAdminClient(ctx, "p", "i", option.WithGRPCConn(conn))
+	if err != nil {
+		t.Fatalf("bigtable.NewAdminClient failed: %v", err)
+	}
+	return client, admin
+}
+
+func TestBigtableV2Client(t *testing.T) {
+	client, admin := newBigtableClients(t)
+	ctx := context.Background()
+
+	err := admin.CreateTableFromConf(ctx, &bigtable.TableConf{
+		TableID:  "users",
+		Families: map[string]bigtable.GCPolicy{"cf": bigtable.MaxVersionsPolicy(2)},
+	})
+	if err != nil {
+		t.Fatalf("CreateTable failed: %v", err)
+	}
+	if err := admin.CreateColumnFamily(ctx, "users", "stats"); err != nil {
+		t.Fatalf("CreateColumnFamily failed: %v", err)
+	}
+	info, err := admin.TableInfo(ctx, "users")
+	if err != nil || len(info.Families) != 2 {
+		t.Fatalf("Expected 2 families, got %v (%v)", info, err)
+	}
+	tables, err := admin.Tables(ctx)
+	if err != nil || len(tables) != 1 || tables[0] != "users" {
+		t.Fatalf("Expected [users], got %v (%v)", tables, err)
+	}
+
+	table := client.Open("users")
+	var keys []string
+	var muts []*bigtable.Mutation
+	for i := 0; i < 5; i++ {
+		mut := bigtable.NewMutation()
+		mut.Set("cf", "name", bigtable.Now(), []byte(fmt.Sprintf("user%d", i)))
+		mut.Set("cf", "age", bigtable.Now(), []byte(fmt.Sprint(20+i)))
+		keys = append(keys, fmt.Sprintf("user#%d", i))
+		muts = append(muts, mut)
+	}
+	errs, err := table.ApplyBulk(ctx, keys, muts)
+	if err != nil || errs != nil {
+		t.Fatalf("ApplyBulk failed: %v %v", err, errs)
+	}
+
+	row, err := table.ReadRow(ctx, "user#3")
+	if err != nil || len(row["cf"]) != 2 {
+		t.Fatalf("Expected 2 cells, got %v (%v)", row, err)
+	}
+	if item := row["cf"][1]; item.Column != "cf:name" || string(item.Value) != "user3" {
+		t.Errorf("Unexpected cell %+v", item)
+	}
+
+	var read []string
+	err = table.ReadRows(ctx, bigtable.NewRange("user#1", "user#4"), func(r bigtable.Row) bool {
+		read = append(read, r.Key())
+		if len(r["cf"]) != 1 || r["cf"][0].Column != "cf:name" {
+			t.Errorf("Expected only cf:name, got %v", r["cf"])
+		}
+		return true
+	}, bigtable.RowFilter(bigtable.ColumnFilter("name")), bigtable.LimitRows(2))
+	if err != nil || fmt.Sprint(read) != "[user#1 user#2]" {
+		t.Fatalf("Expected [user#1 user#2], got %v (%v)", read, err)
+	}
+
+	rmw := bigtable.NewReadModifyWrite()
+	rmw.Increment("stats", "visits", 5)
+	if _, err := table.ApplyReadModifyWrite(ctx, "user#0", rmw); err != nil {
+		t.Fatalf("ReadModifyWrite failed: %v", err)
+	}
+	got, err := table.ApplyReadModifyWrite(ctx, "user#0", rmw)
+	if err != nil || int64(binary.BigEndian.Uint64(got["stats"][0].Value)) != 10 {
+		t.Fatalf("Expected 10 visits, got %v (%v)", got, err)
+	}
+
+	// user#0 has a visits column, user#1 does not
+	var matched bool
+	onMatch := bigtable.NewMutation()
+	onMatch.Set("cf", "vip", bigtable.Now(), []byte("yes"))
+	cond := bigtable.NewCondMutation(bigtable.ColumnFilter("visits"), onMatch, nil)
+	for _, key := range []string{"user#0", "user#1"} {
+		if err := table.Apply(ctx, key, cond, bigtable.GetCondMutationResult(&matched)); err != nil {
+			t.Fatalf("CheckAndMutate failed: %v", err)
+		}
+		row, _ := table.ReadRow(ctx, key, bigtable.RowFilter(bigtable.ColumnFilter("vip")))
+		if matched != (key == "user#0") || (len(row["cf"]) == 1) != matched {
+			t.Errorf("%s: matched=%v row=%v", key, matched, row)
+		}
+	}
+
+	if err := admin.DropRowRange(ctx, "users", "user#"); err != nil {
+		t.Fatalf("DropRowRange failed: %v", err)
+	}
+	count := 0
+	err = table.ReadRows(ctx, bigtable.InfiniteRange(""), func(bigtable.Row) bool { count++; return true })
+	if err != nil || count != 0 {
+		t.Errorf("Expected empty table, got %d rows (%v)", count, err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	if err := admin.DeleteTable(ctx, "users"); err != nil {
+		t.Fatalf("DeleteTable failed: %v", err)
+	}
+}
@@ -0,0 +1,138 @@
+package test
+
+import (
+	"bigtable/internal/rest"
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestOctetStreamValue(t *testing.T) {
+	n := newTestNode(t)
+	service := rest.NewKVStoreService(n)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			service.HandleGet(w, r)
+		} else {
+			service.HandleSet(w, r)
+		}
+	}))
+	defer server.Close()
+
+	value := []byte{0x00, 0xff, 0xfe, '"', '\n', 0x80, 0x01}
+	req, _ := http.NewRequest(http.MethodPut, server.URL+"?key=blob", bytes.NewReader(value))
+	req.Header.Set("Content-Type", "application/octet-stream")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("PUT failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", resp.StatusCode)
+	}
+
+	req, _ = http.NewRequest(http.MethodGet, server.URL+"?key=blob", nil)
+	req.Header.Set("Accept", "application/octet-stream")
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("GET failed: %v", err)
+	}
+	got, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if !bytes.Equal(got, value) {
+		t.Errorf("Expected %v, got %v", value, got)
+	}
+	if resp.Header.Get("Content-Type") != "application/octet-stream" {
+		t.Errorf("Unexpected Content-Type %q", resp.Header.Get("Content-Type"))
+	}
+}
+
+func TestBase64KeysAndValues(t *testing.T) {
+	n := newTestNode(t)
+	service := rest.NewKVStoreService(n)
+	b64 := base64.StdEncoding.EncodeToString
+
+	keys := [][]byte{{'k', 0xff, 0x00, 0x01}, {'k', 0xff, 0x00, 0x02}}
+	values := [][]byte{{0xc3, 0x28}, {0x00}}
+	for i := range keys {
+		body, _ := json.Marshal(map[string]string{"key": b64(keys[i]), "value": b64(values[i])})
+		rec := httptest.NewRecorder()
+		service.HandleSet(rec, httptest.NewRequest(http.MethodPost, "/set?encoding=base64", bytes.NewReader(body)))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Set failed: %d %s", rec.Code, rec.Body)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	service.HandleGet(rec, httptest.NewRequest(http.MethodGet, "/get?encoding=base64&key="+url.QueryEscape(b64(keys[0])), nil))
+	var item struct{ Key, Value string }
+	if err := json.NewDecoder(rec.Body).Decode(&item); err != nil {
+		t.Fatalf("Bad get response: %v", err)
+	}
+	if item.Key != b64(keys[0]) || item.Value != b64(values[0]) {
+		t.Errorf("Unexpected get response %+v", item)
+	}
+
+	rec = httptest.NewRecorder()
+	service.HandleRange(rec, httptest.NewRequest(http.MethodGet, "/range?encoding=base64&limit=1&prefix="+url.QueryEscape(b64([]byte{'k', 0xff})), nil))
+	var page rest.RangeResponse
+	if err := json.NewDecoder(rec.Body).Decode(&page); err != nil {
+		t.Fatalf("Bad range response: %v", err)
+	}
+	if len(page.Items) != 1 || page.Items[0].Key != b64(keys[0]) || page.Items[0].Value != b64(values[0]) {
+		t.Fatalf("Unexpected first page %+v", page)
+	}
+
+	rec = httptest.NewRecorder()
+	service.HandleRange(rec, httptest.NewRequest(http.MethodGet, "/range?encoding=base64&limit=1&prefix="+url.QueryEscape(b64([]byte{'k', 0xff}))+"&cursor="+url.QueryEscape(page.NextCursor), nil))
+	page = rest.RangeResponse{}
+	if err := json.NewDecoder(rec.Body).Decode(&page); err != nil {
+		t.Fatalf("Bad range response: %v", err)
+	}
+	if len(page.Items) != 1 || page.Items[0].Key != b64(keys[1]) || page.Items[0].Value != b64(values[1]) {
+		t.Errorf("Unexpected second page %+v", page)
+	}
+
+	rec = httptest.NewRecorder()
+	service.HandleGet(rec, httptest.NewRequest(http.MethodGet, "/get?encoding=base64&key=not*base64", nil))
+	if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "key") {
+		t.Errorf("Expected 400 for bad key, got %d %s", rec.Code, rec.Body)
+	}
+}
+
+func TestScanValueByKeyMixedValues(t *testing.T) {
+	ts := newV1Server(t)
+
+	doRequest(t, http.MethodPut, ts.URL+"/v1/kv/p1", `5`)
+	doRequest(t, http.MethodPut, ts.URL+"/v1/kv/p2", `{"name":"kim"}`)
+	doRequest(t, http.MethodPost, ts.URL+"/append", `{"key":"p3","value":"abc","encoding":"binary"}`)
+
+	resp, body := doRequest(t, http.MethodGet, ts.URL+"/scanvaluebykey?prefix=p", "")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", resp.StatusCode, body)
+	}
+	var page struct {
+		Results []struct {
+			Key   string          `json:"key"`
+			Value json.RawMessage `json:"value"`
+		} `json:"results"`
+	}
+	if err := json.Unmarshal([]byte(body), &page); err != nil {
+		t.Fatalf("Bad response %q: %v", body, err)
+	}
+	want := []string{`5`, `{"name":"kim"}`, `"abc"`}
+	if len(page.Results) != len(want) {
+		t.Fatalf("Expected %d results, got %s", len(want), body)
+	}
+	for i, result := range page.Results {
+		if string(result.Value) != want[i] {
+			t.Errorf("%s: expected %s, got %s", result.Key, want[i], result.Value)
+		}
+	}
+}
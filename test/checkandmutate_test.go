@@ -0,0 +1,66 @@
+package test
+
+import (
+	"bigtable/internal/kvstore"
+	"testing"
+)
+
+func TestCheckAndMutate(t *testing.T) {
+	store, err := kvstore.NewKVStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to create KVStore: %v", err)
+	}
+	defer store.Close()
+
+	create := []kvstore.BatchOperation{{Type: "set", Key: "lock", Value: "owner-a"}}
+	matched, err := store.CheckAndMutate("lock", kvstore.Condition{Type: "not_exists"}, create, nil)
+	if err != nil || !matched {
+		t.Fatalf("Expected first not_exists to match, got %v (%v)", matched, err)
+	}
+	matched, err = store.CheckAndMutate("lock", kvstore.Condition{Type: "not_exists"}, create, nil)
+	if err != nil || matched {
+		t.Fatalf("Expected second not_exists to fail, got %v (%v)", matched, err)
+	}
+
+	_, version, err := store.GetWithVersion("lock")
+	if err != nil || version == 0 {
+		t.Fatalf("Expected a version, got %d (%v)", version, err)
+	}
+
+	// A stale version runs the onFalse branch
+	update := []kvstore.BatchOperation{{Type: "set", Key: "lock", Value: "owner-b"}}
+	conflict := []kvstore.BatchOperation{{Type: "set", Key: "conflicts", Value: "1"}}
+	matched, err = store.CheckAndMutate("lock", kvstore.Condition{Type: "version_equals", Version: version - 1}, update, conflict)
+	if err != nil || matched {
+		t.Fatalf("Expected stale version to fail, got %v (%v)", matched, err)
+	}
+	if v, err := store.Get("conflicts"); err != nil || v != "1" {
+		t.Errorf("Expected onFalse branch to run, got %q (%v)", v, err)
+	}
+
+	matched, err = store.CheckAndMutate("lock", kvstore.Condition{Type: "version_equals", Version: version}, update, nil)
+	if err != nil || !matched {
+		t.Fatalf("Expected current version to match, got %v (%v)", matched, err)
+	}
+	if v, _ := store.Get("lock"); v != "owner-b" {
+		t.Errorf("Expected owner-b, got %q", v)
+	}
+
+	if err := store.CreateTable("accounts", []kvstore.ColumnFamily{{Name: "cf"}}); err != nil {
+		t.Fatalf("CreateTable failed: %v", err)
+	}
+	set := []kvstore.Mutation{{Type: "set", Family: "cf", Qualifier: "state", Value: "open"}}
+	if err := store.MutateRow("accounts", "acc1", set); err != nil {
+		t.Fatalf("MutateRow failed: %v", err)
+	}
+	cond := kvstore.Condition{Type: "value_equals", Family: "cf", Qualifier: "state", Value: "open"}
+	closeAccount := []kvstore.Mutation{{Type: "set", Family: "cf", Qualifier: "state", Value: "closed"}}
+	matched, err = store.CheckAndMutateRow("accounts", "acc1", cond, closeAccount, nil)
+	if err != nil || !matched {
+		t.Fatalf("Expected row condition to match, got %v (%v)", matched, err)
+	}
+	matched, err = store.CheckAndMutateRow("accounts", "acc1", cond, closeAccount, nil)
+	if err != nil || matched {
+		t.Fatalf("Expected row condition to fail after update, got %v (%v)", matched, err)
+	}
+}
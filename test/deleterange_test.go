@@ -0,0 +1,73 @@
+package test
+
+import (
+	"bigtable/internal/kvstore"
+	"errors"
+	"strconv"
+	"testing"
+)
+
+func TestDeletePrefixAndRange(t *testing.T) {
+	store, err := kvstore.NewKVStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to create KVStore: %v", err)
+	}
+	defer store.Close()
+
+	for _, tenant := range []string{"a", "b"} {
+		for i := 0; i < 10; i++ {
+			if err := store.Set("tenant:"+tenant+":"+strconv.Itoa(i), "v"); err != nil {
+				t.Fatalf("Set failed: %v", err)
+			}
+		}
+	}
+	if err := store.CreateTable("t", []kvstore.ColumnFamily{{Name: "cf"}}); err != nil {
+		t.Fatalf("CreateTable failed: %v", err)
+	}
+	if _, err := store.EnableCounter("tenant:"); err != nil {
+		t.Fatalf("EnableCounter failed: %v", err)
+	}
+
+	if count, complete, err := store.CountKeys("tenant:a:", 0); err != nil || !complete || count != 10 {
+		t.Fatalf("Expected a dry-run count of 10, got %d %v (%v)", count, complete, err)
+	}
+	if err := store.DeletePrefix("tenant:a:"); err != nil {
+		t.Fatalf("DeletePrefix failed: %v", err)
+	}
+	if total, _ := store.TotalKey("tenant:a:"); total != 0 {
+		t.Errorf("Expected tenant a to be gone, %d keys left", total)
+	}
+	if count, _ := store.Counter("tenant:"); count != 10 {
+		t.Errorf("Expected counter 10 after DeletePrefix, got %d", count)
+	}
+
+	// tenant:b:2 .. tenant:b:4, then a key re-created in the same batch
+	ops := []kvstore.BatchOperation{
+		{Type: "delete_range", Key: "tenant:b:2", EndKey: "tenant:b:5"},
+		{Type: "set", Key: "tenant:b:3", Value: "again"},
+	}
+	if err := store.BatchOperation(ops); err != nil {
+		t.Fatalf("BatchOperation failed: %v", err)
+	}
+	if total, _ := store.TotalKey("tenant:b:"); total != 8 {
+		t.Errorf("Expected 8 keys for tenant b, got %d", total)
+	}
+	if count, _ := store.Counter("tenant:"); count != 8 {
+		t.Errorf("Expected counter 8, got %d", count)
+	}
+
+	// A range starting below every user key must leave the internal keyspace alone
+	if err := store.DeleteRange("", "tenant:b:5"); err != nil {
+		t.Fatalf("DeleteRange failed: %v", err)
+	}
+	if _, err := store.GetTable("t"); err != nil {
+		t.Errorf("Expected table t to survive, got %v", err)
+	}
+	if total, _ := store.TotalKey("tenant:"); total != 5 {
+		t.Errorf("Expected 5 keys left, got %d", total)
+	}
+
+	if err := store.DeleteRange("b", "a"); !errors.Is(err, kvstore.ErrInvalidRange) {
+		t.Errorf("Expected ErrInvalidRange for an empty range, got %v", err)
+	}
+}
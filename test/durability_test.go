@@ -0,0 +1,123 @@
+package test
+
+import (
+	"bigtable/internal/kvstore"
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestParseWriteOptions(t *testing.T) {
+	valid := map[string]kvstore.WriteOptions{
+		"":                {},
+		"sync":            {Durability: kvstore.DurabilitySync},
+		"nosync":          {Durability: kvstore.DurabilityNoSync},
+		"group-sync":      {Durability: kvstore.DurabilityGroupSync},
+		"group-sync:10ms": {Durability: kvstore.DurabilityGroupSync, GroupSyncWindow: 10 * time.Millisecond},
+	}
+	for s, want := range valid {
+		if got, err := kvstore.ParseWriteOptions(s); err != nil || got != want {
+			t.Errorf("ParseWriteOptions(%q) = %+v, %v; want %+v", s, got, err, want)
+		}
+		if s != "" && want.String() != s {
+			t.Errorf("Expected %+v to print as %q, got %q", want, s, want.String())
+		}
+	}
+	for _, s := range []string{"fsync", "sync:1ms", "group-sync:", "group-sync:abc", "group-sync:-1ms", "group-sync:5s"} {
+		if _, err := kvstore.ParseWriteOptions(s); err == nil {
+			t.Errorf("Expected ParseWriteOptions(%q) to fail", s)
+		}
+	}
+}
+
+func TestDurabilityModes(t *testing.T) {
+	dir := t.TempDir()
+	store, err := kvstore.NewKVStore(dir)
+	if err != nil {
+		t.Fatalf("Failed to create KVStore: %v", err)
+	}
+
+	modes := []kvstore.WriteOptions{
+		{},
+		{Durability: kvstore.DurabilitySync},
+		{Durability: kvstore.DurabilityNoSync},
+		{Durability: kvstore.DurabilityGroupSync, GroupSyncWindow: 5 * time.Millisecond},
+	}
+	var wg sync.WaitGroup
+	for i, opts := range modes {
+		for j := 0; j < 10; j++ {
+			wg.Add(1)
+			go func(key string) {
+				defer wg.Done()
+				if err := store.SetWithOptions(key, "v", 0, opts); err != nil {
+					t.Errorf("Set %s with %v failed: %v", key, opts, err)
+				}
+			}(fmt.Sprintf("m%d/%d", i, j))
+		}
+	}
+	wg.Wait()
+
+	if err := store.DeleteWithOptions("m0/0", kvstore.WriteOptions{Durability: kvstore.DurabilityNoSync}); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	store.SetDefaultWriteOptions(kvstore.WriteOptions{Durability: kvstore.DurabilityGroupSync})
+	if _, err := store.BatchOperationWithOptions([]kvstore.BatchOperation{{Type: "set", Key: "batch", Value: "b"}}, kvstore.WriteOptions{}); err != nil {
+		t.Fatalf("Batch failed: %v", err)
+	}
+	// Close runs a pending group sync instead of waiting out its window
+	done := make(chan error, 1)
+	go func() {
+		done <- store.SetWithOptions("late", "v", 0, kvstore.WriteOptions{Durability: kvstore.DurabilityGroupSync, GroupSyncWindow: time.Second})
+	}()
+	for {
+		if _, err := store.Get("late"); err == nil {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if err := store.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	if err := <-done; err != nil {
+		t.Fatalf("Group sync write failed: %v", err)
+	}
+
+	store, err = kvstore.NewKVStore(dir)
+	if err != nil {
+		t.Fatalf("Failed to reopen KVStore: %v", err)
+	}
+	defer store.Close()
+	for _, key := range []string{"m1/9", "m2/9", "m3/9", "batch", "late"} {
+		if _, err := store.Get(key); err != nil {
+			t.Errorf("Expected %s to survive reopen: %v", key, err)
+		}
+	}
+	if _, err := store.Get("m0/0"); err == nil {
+		t.Errorf("Expected m0/0 to stay deleted")
+	}
+}
+
+func TestRESTDurability(t *testing.T) {
+	ts := newV1Server(t)
+
+	resp, body := doRequest(t, http.MethodPut, ts.URL+"/v1/kv/a?durability=nosync", `"x"`)
+	if resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("Expected 204, got %d: %s", resp.StatusCode, body)
+	}
+
+	req, _ := http.NewRequest(http.MethodDelete, ts.URL+"/v1/kv/a", nil)
+	req.Header.Set("X-Durability", "group-sync:1ms")
+	if resp, err := http.DefaultClient.Do(req); err != nil || resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("Expected 204 deleting with X-Durability, got %v (%v)", resp, err)
+	}
+
+	resp, body = doRequest(t, http.MethodPost, ts.URL+"/v1/batch?durability=fast", `{"operations":[{"type":"set","key":"b","value":"y"}]}`)
+	expectError(t, resp, body, http.StatusBadRequest, "invalid_argument")
+
+	resp, body = doRequest(t, http.MethodPost, ts.URL+"/set?durability=group-sync", `{"key":"c","value":"z"}`)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", resp.StatusCode, body)
+	}
+}
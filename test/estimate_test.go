@@ -0,0 +1,111 @@
+package test
+
+import (
+	"bigtable/internal/kvstore"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestPrefixCounter(t *testing.T) {
+	dir := t.TempDir()
+	store, err := kvstore.NewKVStore(dir)
+	if err != nil {
+		t.Fatalf("Failed to create KVStore: %v", err)
+	}
+
+	for i := 0; i < 5; i++ {
+		if err := store.Set("user:"+strconv.Itoa(i), "v"); err != nil {
+			t.Fatalf("Set failed: %v", err)
+		}
+	}
+	if count, err := store.EnableCounter("user:"); err != nil || count != 5 {
+		t.Fatalf("Expected initial count 5, got %d (%v)", count, err)
+	}
+
+	// Overwrites do not count twice, deletes of missing keys do not count
+	ops := []kvstore.BatchOperation{
+		{Type: "set", Key: "user:0", Value: "v2"},
+		{Type: "set", Key: "user:9", Value: "v"},
+		{Type: "set", Key: "user:9", Value: "v"},
+		{Type: "delete", Key: "user:1"},
+		{Type: "delete", Key: "user:missing"},
+		{Type: "set", Key: "other", Value: "v"},
+	}
+	if err := store.BatchOperation(ops); err != nil {
+		t.Fatalf("BatchOperation failed: %v", err)
+	}
+	if err := store.Delete("user:2"); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if err := store.SetWithTTL("user:tmp", "v", time.Millisecond); err != nil {
+		t.Fatalf("SetWithTTL failed: %v", err)
+	}
+	if count, _ := store.Counter("user:"); count != 5 {
+		t.Errorf("Expected count 5, got %d", count)
+	}
+
+	time.Sleep(5 * time.Millisecond)
+	if _, err := store.ReapExpired(); err != nil {
+		t.Fatalf("ReapExpired failed: %v", err)
+	}
+	if count, _ := store.Counter("user:"); count != 4 {
+		t.Errorf("Expected count 4 after reaping, got %d", count)
+	}
+	store.Close()
+
+	// Counters survive a restart and answer the estimate
+	store, err = kvstore.NewKVStore(dir)
+	if err != nil {
+		t.Fatalf("Failed to reopen KVStore: %v", err)
+	}
+	defer store.Close()
+	estimate, err := store.EstimateKeys("user:")
+	if err != nil || estimate.Source != "counter" || estimate.Keys != 4 {
+		t.Errorf("Expected counter estimate of 4, got %+v (%v)", estimate, err)
+	}
+	if err := store.DisableCounter("user:"); err != nil {
+		t.Fatalf("DisableCounter failed: %v", err)
+	}
+	if _, ok := store.Counter("user:"); ok {
+		t.Errorf("Expected the counter to be gone")
+	}
+}
+
+func TestEstimateAndBoundedCount(t *testing.T) {
+	dir := t.TempDir()
+	store, err := kvstore.NewKVStore(dir)
+	if err != nil {
+		t.Fatalf("Failed to create KVStore: %v", err)
+	}
+	for i := 0; i < 2000; i++ {
+		if err := store.Set("item:"+strconv.Itoa(i), "value"); err != nil {
+			t.Fatalf("Set failed: %v", err)
+		}
+	}
+	store.Close()
+
+	// Reopening flushes the recovered WAL into sstables
+	store, err = kvstore.NewKVStore(dir)
+	if err != nil {
+		t.Fatalf("Failed to reopen KVStore: %v", err)
+	}
+	defer store.Close()
+
+	estimate, err := store.EstimateKeys("item:")
+	if err != nil {
+		t.Fatalf("EstimateKeys failed: %v", err)
+	}
+	if estimate.Source != "sstables" || estimate.Keys < 1000 || estimate.Keys > 4000 {
+		t.Errorf("Estimate too far off: %+v", estimate)
+	}
+
+	count, complete, err := store.CountKeys("item:", 500)
+	if err != nil || complete || count != 500 {
+		t.Errorf("Expected a partial count of 500, got %d %v (%v)", count, complete, err)
+	}
+	count, complete, err = store.CountKeys("item:", 0)
+	if err != nil || !complete || count != 2000 {
+		t.Errorf("Expected the full count of 2000, got %d %v (%v)", count, complete, err)
+	}
+}
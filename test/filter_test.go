@@ -0,0 +1,144 @@
+package test
+
+import (
+	"bigtable/internal/kvstore"
+	"encoding/json"
+	"testing"
+)
+
+func mustFilter(t *testing.T, data string) *kvstore.Filter {
+	t.Helper()
+	var filter kvstore.Filter
+	if err := json.Unmarshal([]byte(data), &filter); err != nil {
+		t.Fatalf("Bad filter %s: %v", data, err)
+	}
+	if err := filter.Validate(); err != nil {
+		t.Fatalf("Invalid filter %s: %v", data, err)
+	}
+	return &filter
+}
+
+func TestFlatScanFilters(t *testing.T) {
+	store, err := kvstore.NewKVStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to create KVStore: %v", err)
+	}
+	defer store.Close()
+
+	users := map[string]string{
+		"user:1": `{"name":"ann","age":31,"address":{"city":"Seoul"}}`,
+		"user:2": `{"name":"bob","age":17,"address":{"city":"Busan"}}`,
+		"user:3": `{"name":"cho","age":45,"address":{"city":"Seoul"}}`,
+		"user:4": `"not an object"`,
+	}
+	for key, value := range users {
+		if err := store.Set(key, value); err != nil {
+			t.Fatalf("Set failed: %v", err)
+		}
+	}
+
+	tests := []struct {
+		filter string
+		want   int
+	}{
+		{`{"type":"key_regex","pattern":"[13]$"}`, 2},
+		{`{"type":"value_regex","pattern":"bob"}`, 1},
+		{`{"type":"json_field","field":"age","op":"gte","value":31}`, 2},
+		{`{"type":"json_field","field":"address.city","op":"eq","value":"Seoul"}`, 2},
+		{`{"type":"json_field","field":"address","op":"exists"}`, 3},
+		{`{"type":"chain","filters":[
+			{"type":"json_field","field":"address.city","op":"eq","value":"Seoul"},
+			{"type":"json_field","field":"age","op":"lt","value":40}]}`, 1},
+		{`{"type":"interleave","filters":[
+			{"type":"key_regex","pattern":"1$"},
+			{"type":"key_regex","pattern":"2$"}]}`, 2},
+		{`{"type":"block_all"}`, 0},
+	}
+	for _, tc := range tests {
+		keys, _, err := store.ScanKey("user:", "", 10, false, mustFilter(t, tc.filter))
+		if err != nil {
+			t.Fatalf("ScanKey failed: %v", err)
+		}
+		if len(keys) != tc.want {
+			t.Errorf("Filter %s: expected %d keys, got %v", tc.filter, tc.want, keys)
+		}
+	}
+
+	// The limit counts matching keys, so the page skips over the rest
+	keys, cursor, err := store.ScanKey("user:", "", 1, false, mustFilter(t, `{"type":"key_regex","pattern":"3$"}`))
+	if err != nil || len(keys) != 1 || keys[0] != "user:3" {
+		t.Errorf("Expected [user:3], got %v (%v)", keys, err)
+	}
+	if cursor != "user:4" {
+		t.Errorf("Expected cursor user:4, got %q", cursor)
+	}
+
+	items, _, err := store.RangeQuery(kvstore.RangeOptions{
+		StartKey: "user:",
+		Filter:   mustFilter(t, `{"type":"chain","filters":[{"type":"key_regex","pattern":"2$"},{"type":"strip_value"}]}`),
+	})
+	if err != nil || len(items) != 1 || items[0].Value != "" {
+		t.Errorf("Expected one stripped item, got %v (%v)", items, err)
+	}
+
+	bad := kvstore.Filter{Type: "key_regex", Pattern: "("}
+	if err := bad.Validate(); err == nil {
+		t.Errorf("Expected an invalid regex to be rejected")
+	}
+}
+
+func TestRowFilters(t *testing.T) {
+	store, err := kvstore.NewKVStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to create KVStore: %v", err)
+	}
+	defer store.Close()
+
+	if err := store.CreateTable("metrics", []kvstore.ColumnFamily{{Name: "cpu"}, {Name: "mem"}}); err != nil {
+		t.Fatalf("CreateTable failed: %v", err)
+	}
+	for _, row := range []string{"host1", "host2", "host3"} {
+		var mutations []kvstore.Mutation
+		for ts := int64(1); ts <= 3; ts++ {
+			mutations = append(mutations,
+				kvstore.Mutation{Type: "set", Family: "cpu", Qualifier: "load", Value: "x", Timestamp: ts * 1000},
+				kvstore.Mutation{Type: "set", Family: "mem", Qualifier: "used", Value: "y", Timestamp: ts * 1000},
+			)
+		}
+		if err := store.MutateRow("metrics", row, mutations); err != nil {
+			t.Fatalf("MutateRow failed: %v", err)
+		}
+	}
+
+	read := func(filter string) []kvstore.Row {
+		rows, _, err := store.ReadRows("metrics", "", "", 10, kvstore.ReadOptions{Filter: mustFilter(t, filter)})
+		if err != nil {
+			t.Fatalf("ReadRows failed: %v", err)
+		}
+		return rows
+	}
+
+	rows := read(`{"type":"family_regex","pattern":"^cpu$"}`)
+	if len(rows) != 3 || len(rows[0].Cells) != 3 || rows[0].Cells[0].Family != "cpu" {
+		t.Errorf("Expected 3 cpu cells per row, got %+v", rows)
+	}
+
+	rows = read(`{"type":"chain","filters":[{"type":"cells_per_column_limit","count":1},{"type":"timestamp_range","startTimestamp":3000}]}`)
+	if len(rows) != 3 || len(rows[0].Cells) != 2 {
+		t.Errorf("Expected the newest cell of each column, got %+v", rows)
+	}
+
+	rows = read(`{"type":"cells_per_row_limit","count":2}`)
+	if len(rows[0].Cells) != 2 {
+		t.Errorf("Expected 2 cells per row, got %d", len(rows[0].Cells))
+	}
+
+	// Rows emptied by the filter do not use up the limit
+	rows, cursor, err := store.ReadRows("metrics", "", "", 1, kvstore.ReadOptions{Filter: mustFilter(t, `{"type":"key_regex","pattern":"2$"}`)})
+	if err != nil || len(rows) != 1 || rows[0].Key != "host2" {
+		t.Errorf("Expected only host2, got %+v (%v)", rows, err)
+	}
+	if cursor != "host3" {
+		t.Errorf("Expected cursor host3, got %q", cursor)
+	}
+}
@@ -0,0 +1,148 @@
+package test
+
+import (
+	"bigtable/internal/rpc"
+	"bigtable/internal/rpc/pb"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+)
+
+func newGRPCClient(t *testing.T) *grpc.ClientConn {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	server := rpc.NewServer(newTestNode(t))
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.NewClient(listener.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("NewClient failed: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func TestGRPCKV(t *testing.T) {
+	client := pb.NewKVClient(newGRPCClient(t))
+	ctx := context.Background()
+
+	_, err := client.Get(ctx, &pb.GetRequest{Key: []byte("missing")})
+	if status.Code(err) != codes.NotFound {
+		t.Errorf("Expected NotFound, got %v", err)
+	}
+
+	key, value := []byte{'b', 0xff, 0x00}, []byte{0x00, 0x01, 0xfe}
+	if _, err := client.Set(ctx, &pb.SetRequest{Key: key, Value: value}); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	got, err := client.Get(ctx, &pb.GetRequest{Key: key})
+	if err != nil || !bytes.Equal(got.Value, value) {
+		t.Fatalf("Expected %v, got %v (%v)", value, got.GetValue(), err)
+	}
+
+	batch, err := client.Batch(ctx, &pb.BatchRequest{Operations: []*pb.Operation{
+		{Type: pb.Operation_SET, Key: []byte("a"), Value: []byte("1")},
+		{Type: pb.Operation_INCREMENT, Key: []byte("n"), Delta: 3},
+		{Type: pb.Operation_DELETE, Key: key},
+	}})
+	if err != nil {
+		t.Fatalf("Batch failed: %v", err)
+	}
+	if string(batch.Results[1]) != "3" {
+		t.Errorf("Expected increment result 3, got %q", batch.Results[1])
+	}
+	if _, err := client.Get(ctx, &pb.GetRequest{Key: key}); status.Code(err) != codes.NotFound {
+		t.Errorf("Expected deleted key, got %v", err)
+	}
+
+	_, err = client.Batch(ctx, &pb.BatchRequest{Operations: []*pb.Operation{
+		{Type: pb.Operation_SET, Key: []byte("s"), Value: []byte(`"text"`)},
+		{Type: pb.Operation_INCREMENT, Key: []byte("s"), Delta: 1},
+	}})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("Expected InvalidArgument for incrementing a string, got %v", err)
+	}
+	_, err = client.Set(ctx, &pb.SetRequest{Key: []byte("\x00ct"), Value: []byte("x")})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("Expected InvalidArgument for a reserved key, got %v", err)
+	}
+
+	_, err = client.Range(ctx, &pb.RangeRequest{Prefix: []byte("a"), Filter: &pb.Filter{Type: "key_regex", Pattern: "("}})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("Expected InvalidArgument for bad filter, got %v", err)
+	}
+}
+
+func TestGRPCScan(t *testing.T) {
+	client := pb.NewKVClient(newGRPCClient(t))
+	ctx := context.Background()
+
+	for i := 0; i < 300; i++ {
+		key := []byte(fmt.Sprintf("row:%03d", i))
+		if _, err := client.Set(ctx, &pb.SetRequest{Key: key, Value: key}); err != nil {
+			t.Fatalf("Set failed: %v", err)
+		}
+	}
+
+	stream, err := client.Scan(ctx, &pb.RangeRequest{Prefix: []byte("row:"), Limit: 250})
+	if err != nil {
+		t.Fatalf("Scan failed: %v", err)
+	}
+	var items []*pb.KeyValue
+	var nextCursor []byte
+	messages := 0
+	for {
+		resp, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Recv failed: %v", err)
+		}
+		messages++
+		items = append(items, resp.Items...)
+		nextCursor = resp.NextCursor
+	}
+	if len(items) != 250 || messages < 2 {
+		t.Fatalf("Expected 250 items over several messages, got %d in %d", len(items), messages)
+	}
+	for i, item := range items {
+		if want := fmt.Sprintf("row:%03d", i); string(item.Key) != want || string(item.Value) != want {
+			t.Fatalf("Item %d: got %s=%s", i, item.Key, item.Value)
+		}
+	}
+	if string(nextCursor) != "row:250" {
+		t.Errorf("Expected cursor row:250, got %q", nextCursor)
+	}
+
+	keys, err := client.ScanKeys(ctx, &pb.RangeRequest{Prefix: []byte("row:"), Cursor: nextCursor})
+	if err != nil {
+		t.Fatalf("ScanKeys failed: %v", err)
+	}
+	count := 0
+	for {
+		resp, err := keys.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Recv failed: %v", err)
+		}
+		count += len(resp.Keys)
+	}
+	if count != 50 {
+		t.Errorf("Expected 50 remaining keys, got %d", count)
+	}
+}
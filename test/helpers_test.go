@@ -0,0 +1,16 @@
+package test
+
+import (
+	"bigtable/internal/node"
+	"testing"
+)
+
+func newTestNode(t testing.TB) *node.KVNode {
+	t.Helper()
+	n, err := node.NewKVNode(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to create KVNode: %v", err)
+	}
+	t.Cleanup(func() { n.Close() })
+	return n
+}
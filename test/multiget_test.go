@@ -0,0 +1,37 @@
+package test
+
+import (
+	"bigtable/internal/kvstore"
+	"testing"
+)
+
+func TestMultiGet(t *testing.T) {
+	store, err := kvstore.NewKVStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to create KVStore: %v", err)
+	}
+	defer store.Close()
+
+	for _, key := range []string{"k1", "k3"} {
+		if err := store.Set(key, "value-"+key); err != nil {
+			t.Fatalf("Set failed: %v", err)
+		}
+	}
+
+	results, err := store.MultiGet([]string{"k1", "k2", "k3"})
+	if err != nil {
+		t.Fatalf("MultiGet failed: %v", err)
+	}
+	if len(results) != 3 {
+		t.Fatalf("Expected 3 results, got %d", len(results))
+	}
+	if !results[0].Found || results[0].Value != "value-k1" {
+		t.Errorf("Unexpected result for k1: %+v", results[0])
+	}
+	if results[1].Found {
+		t.Errorf("Expected k2 to be reported as not found: %+v", results[1])
+	}
+	if !results[2].Found || results[2].Value != "value-k3" {
+		t.Errorf("Unexpected result for k3: %+v", results[2])
+	}
+}
@@ -0,0 +1,81 @@
+package test
+
+import (
+	"bigtable/internal/kvstore"
+	"testing"
+)
+
+func rangeKeys(items []kvstore.KeyValue) []string {
+	keys := make([]string, 0, len(items))
+	for _, item := range items {
+		keys = append(keys, item.Key)
+	}
+	return keys
+}
+
+func TestRangeQueryBoundsAndCursor(t *testing.T) {
+	store, err := kvstore.NewKVStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to create KVStore: %v", err)
+	}
+	defer store.Close()
+
+	for _, key := range []string{"a", "b", "c", "d", "e"} {
+		if err := store.Set(key, "v"); err != nil {
+			t.Fatalf("Set failed: %v", err)
+		}
+	}
+	// Tables live in the internal keyspace and must not leak into open ranges
+	if err := store.CreateTable("t", []kvstore.ColumnFamily{{Name: "cf"}}); err != nil {
+		t.Fatalf("CreateTable failed: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		opts kvstore.RangeOptions
+		want string
+	}{
+		{"half open", kvstore.RangeOptions{StartKey: "b", EndKey: "d"}, "bc"},
+		{"inclusive end", kvstore.RangeOptions{StartKey: "b", EndKey: "d", EndInclusive: true}, "bcd"},
+		{"exclusive start", kvstore.RangeOptions{StartKey: "b", EndKey: "d", StartExclusive: true}, "c"},
+		{"open start", kvstore.RangeOptions{EndKey: "c"}, "ab"},
+		{"open end", kvstore.RangeOptions{StartKey: "d"}, "de"},
+		{"unbounded reverse", kvstore.RangeOptions{Reverse: true}, "edcba"},
+		{"empty", kvstore.RangeOptions{StartKey: "d", EndKey: "b"}, ""},
+	}
+	for _, tc := range tests {
+		items, _, err := store.RangeQuery(tc.opts)
+		if err != nil {
+			t.Fatalf("%s: RangeQuery failed: %v", tc.name, err)
+		}
+		got := ""
+		for _, key := range rangeKeys(items) {
+			got += key
+		}
+		if got != tc.want {
+			t.Errorf("%s: expected %q, got %q", tc.name, tc.want, got)
+		}
+	}
+
+	for _, reverse := range []bool{false, true} {
+		var got []string
+		opts := kvstore.RangeOptions{StartKey: "a", EndKey: "e", EndInclusive: true, Limit: 2, Reverse: reverse}
+		for {
+			items, next, err := store.RangeQuery(opts)
+			if err != nil {
+				t.Fatalf("RangeQuery failed: %v", err)
+			}
+			if len(items) > 2 {
+				t.Fatalf("Page exceeds limit: %v", rangeKeys(items))
+			}
+			got = append(got, rangeKeys(items)...)
+			if next == "" {
+				break
+			}
+			opts.Cursor = next
+		}
+		if len(got) != 5 {
+			t.Errorf("reverse=%v: expected 5 keys over all pages, got %v", reverse, got)
+		}
+	}
+}
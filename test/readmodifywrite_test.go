@@ -0,0 +1,106 @@
+package test
+
+import (
+	"bigtable/internal/kvstore"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestIncrementAndAppend(t *testing.T) {
+	store, err := kvstore.NewKVStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to create KVStore: %v", err)
+	}
+	defer store.Close()
+
+	if v, err := store.Increment("hits", 5, kvstore.EncodingJSON); err != nil || v != 5 {
+		t.Fatalf("Expected 5, got %d (%v)", v, err)
+	}
+	if v, err := store.Increment("hits", -2, kvstore.EncodingJSON); err != nil || v != 3 {
+		t.Fatalf("Expected 3, got %d (%v)", v, err)
+	}
+	if v, _ := store.Get("hits"); v != "3" {
+		t.Errorf("Expected JSON number 3, got %q", v)
+	}
+
+	if v, err := store.Increment("bin", 1, kvstore.EncodingBinary); err != nil || v != 1 {
+		t.Fatalf("Expected 1, got %d (%v)", v, err)
+	}
+	if v, _ := store.Get("bin"); v != "\x00\x00\x00\x00\x00\x00\x00\x01" {
+		t.Errorf("Expected big-endian counter, got %q", v)
+	}
+	if _, err := store.Increment("bin", 1, kvstore.EncodingJSON); err == nil {
+		t.Errorf("Expected error incrementing a binary counter as JSON")
+	}
+
+	if v, err := store.Append("log", "ab", kvstore.EncodingJSON); err != nil || v != "ab" {
+		t.Fatalf("Expected ab, got %q (%v)", v, err)
+	}
+	if v, err := store.Append("log", "cd", kvstore.EncodingJSON); err != nil || v != "abcd" {
+		t.Fatalf("Expected abcd, got %q (%v)", v, err)
+	}
+	if v, _ := store.Get("log"); v != `"abcd"` {
+		t.Errorf("Expected JSON string, got %q", v)
+	}
+
+	// Operations in one batch see each other's writes
+	results, err := store.BatchOperationWithResults([]kvstore.BatchOperation{
+		{Type: "increment", Key: "hits", Value: 10},
+		{Type: "increment", Key: "hits", Value: 10},
+		{Type: "append", Key: "raw", Value: "x", Encoding: kvstore.EncodingBinary},
+		{Type: "append", Key: "raw", Value: "y", Encoding: kvstore.EncodingBinary},
+	})
+	if err != nil {
+		t.Fatalf("BatchOperationWithResults failed: %v", err)
+	}
+	if results[0] != "13" || results[1] != "23" || results[3] != "xy" {
+		t.Errorf("Unexpected batch results: %q", results)
+	}
+}
+
+func TestIncrementAndAppendREST(t *testing.T) {
+	ts := newV1Server(t)
+
+	resp, body := doRequest(t, http.MethodPost, ts.URL+"/increment", `{"key":"hits","delta":2}`)
+	if resp.StatusCode != http.StatusOK || !strings.Contains(body, `"value":2`) {
+		t.Fatalf("Expected 2, got %d: %s", resp.StatusCode, body)
+	}
+
+	// Values that do not fit the operation are the client's fault
+	for path, request := range map[string]string{
+		"/increment": `{"key":"hits","encoding":"binary"}`,
+		"/append":    `{"key":"hits","value":"x","encoding":"json"}`,
+	} {
+		resp, body = doRequest(t, http.MethodPost, ts.URL+path, request)
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d: %s", path, resp.StatusCode, body)
+		}
+	}
+}
+
+func TestConcurrentIncrementThroughNode(t *testing.T) {
+	n := newTestNode(t)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				if _, err := n.Increment("counter", 1, kvstore.EncodingJSON); err != nil {
+					t.Errorf("Increment failed: %v", err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	v, err := n.Get("counter")
+	if err != nil || v != strconv.Itoa(8*50) {
+		t.Fatalf("Expected %d, got %q (%v)", 8*50, v, err)
+	}
+}
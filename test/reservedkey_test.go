@@ -0,0 +1,98 @@
+package test
+
+import (
+	"bigtable/internal/kvstore"
+	"bigtable/internal/rest"
+	"errors"
+	"net/http"
+	"testing"
+)
+
+func TestReservedKeys(t *testing.T) {
+	store, err := kvstore.NewKVStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to create KVStore: %v", err)
+	}
+	defer store.Close()
+
+	if err := store.CreateTable("t1", []kvstore.ColumnFamily{{Name: "cf"}}); err != nil {
+		t.Fatalf("CreateTable failed: %v", err)
+	}
+	if err := store.Set("a", "1"); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+
+	catalog := "\x00ct1"
+	calls := map[string]func() error{
+		"Set":    func() error { return store.Set(catalog, "garbage") },
+		"Delete": func() error { return store.Delete(catalog) },
+		"Get": func() error {
+			_, err := store.Get(catalog)
+			return err
+		},
+		"MultiGet": func() error {
+			_, err := store.MultiGet([]string{"a", catalog})
+			return err
+		},
+		"Increment": func() error {
+			_, err := store.Increment("\x00n", 1, kvstore.EncodingJSON)
+			return err
+		},
+		"BatchSet": func() error {
+			return store.BatchOperation([]kvstore.BatchOperation{{Type: "set", Key: catalog, Value: "x"}})
+		},
+		"BatchDelete":  func() error { return store.BatchOperation([]kvstore.BatchOperation{{Type: "delete", Key: catalog}}) },
+		"DeletePrefix": func() error { return store.DeletePrefix("\x00") },
+		"ScanKey": func() error {
+			_, _, err := store.ScanKey("\x00", "", 10, false, nil)
+			return err
+		},
+		"ScanValueByKey": func() error {
+			_, _, err := store.ScanValueByKey("\x00c", "", 10, false, nil)
+			return err
+		},
+		"ScanKeySnapshot": func() error {
+			_, _, err := store.ScanKeySnapshot("\x00", "", 10, false, nil)
+			return err
+		},
+		"CountKeys": func() error {
+			_, _, err := store.CountKeys("\x00", 0)
+			return err
+		},
+	}
+	for name, call := range calls {
+		if err := call(); !errors.Is(err, kvstore.ErrReservedKey) {
+			t.Errorf("%s: expected ErrReservedKey, got %v", name, err)
+		}
+	}
+
+	if _, err := store.ListTables(); err != nil {
+		t.Fatalf("Catalog was damaged: %v", err)
+	}
+
+	// The empty prefix covers flat keys only
+	keys, _, err := store.ScanKey("", "", 10, false, nil)
+	if err != nil || len(keys) != 1 || keys[0] != "a" {
+		t.Errorf("ScanKey of the empty prefix returned %q, %v", keys, err)
+	}
+	if count, _, err := store.CountKeys("", 0); err != nil || count != 1 {
+		t.Errorf("CountKeys of the empty prefix returned %d, %v", count, err)
+	}
+}
+
+func TestReservedKeysREST(t *testing.T) {
+	ts := newV1Server(t)
+
+	resp, body := doRequest(t, http.MethodPut, ts.URL+"/v1/kv/%00ct1", `"garbage"`)
+	expectError(t, resp, body, http.StatusBadRequest, rest.CodeInvalidArgument)
+
+	resp, body = doRequest(t, http.MethodPost, ts.URL+"/set?encoding=base64", `{"key":"AGN0MQ==","value":"Zw=="}`)
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected 400 from /set, got %d: %s", resp.StatusCode, body)
+	}
+
+	resp, body = doRequest(t, http.MethodGet, ts.URL+"/scankey?prefix=%00", "")
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected 400 from /scankey, got %d: %s", resp.StatusCode, body)
+	}
+}
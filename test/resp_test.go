@@ -0,0 +1,157 @@
+package test
+
+import (
+	"bigtable/internal/resp"
+	"bufio"
+	"context"
+	"net"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+func newRedisServer(t *testing.T) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	server := resp.NewServer(newTestNode(t))
+	go server.Serve(listener)
+	t.Cleanup(func() { server.Close() })
+	return listener.Addr().String()
+}
+
+func TestRedisCommands(t *testing.T) {
+	// go-redis negotiates RESP3 with HELLO 3
+	client := redis.NewClient(&redis.Options{Addr: newRedisServer(t), Protocol: 3})
+	defer client.Close()
+	ctx := context.Background()
+
+	if err := client.Set(ctx, "a", "1", 0).Err(); err != nil {
+		t.Fatalf("SET failed: %v", err)
+	}
+	if got, err := client.Get(ctx, "a").Result(); err != nil || got != "1" {
+		t.Fatalf("Expected 1, got %q (%v)", got, err)
+	}
+	if err := client.Get(ctx, "missing").Err(); err != redis.Nil {
+		t.Errorf("Expected redis.Nil, got %v", err)
+	}
+
+	if ok, _ := client.SetNX(ctx, "a", "2", 0).Result(); ok {
+		t.Error("SET NX overwrote an existing key")
+	}
+	if ok, _ := client.SetXX(ctx, "b", "2", 0).Result(); ok {
+		t.Error("SET XX created a missing key")
+	}
+	if ok, err := client.SetNX(ctx, "b", "2", time.Minute).Result(); !ok || err != nil {
+		t.Fatalf("SET NX EX failed: %v %v", ok, err)
+	}
+	if ttl, _ := client.TTL(ctx, "b").Result(); ttl < 59*time.Second || ttl > time.Minute {
+		t.Errorf("Expected TTL near 60s, got %v", ttl)
+	}
+	if ttl, _ := client.TTL(ctx, "a").Result(); ttl != -1 {
+		t.Errorf("Expected -1 for a key without TTL, got %v", ttl)
+	}
+	if ttl, _ := client.TTL(ctx, "missing").Result(); ttl != -2 {
+		t.Errorf("Expected -2 for a missing key, got %v", ttl)
+	}
+
+	if err := client.Set(ctx, "short", "x", 50*time.Millisecond).Err(); err != nil {
+		t.Fatalf("SET PX failed: %v", err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if n, _ := client.Exists(ctx, "short", "a", "a", "missing").Result(); n != 2 {
+		t.Errorf("Expected EXISTS 2, got %d", n)
+	}
+
+	if err := client.MSet(ctx, "c", "3", "d", "4").Err(); err != nil {
+		t.Fatalf("MSET failed: %v", err)
+	}
+	values, err := client.MGet(ctx, "a", "missing", "d").Result()
+	if err != nil || values[0] != "1" || values[1] != nil || values[2] != "4" {
+		t.Errorf("Unexpected MGET result %v (%v)", values, err)
+	}
+
+	if n, err := client.Incr(ctx, "a").Result(); err != nil || n != 2 {
+		t.Errorf("Expected INCR 2, got %d (%v)", n, err)
+	}
+	if n, err := client.Incr(ctx, "counter").Result(); err != nil || n != 1 {
+		t.Errorf("Expected INCR of a missing key to give 1, got %d (%v)", n, err)
+	}
+	if err := client.Set(ctx, "text", "abc", 0).Err(); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Incr(ctx, "text").Err(); err == nil {
+		t.Error("Expected INCR of a non-integer to fail")
+	}
+
+	if n, _ := client.Del(ctx, "c", "d", "missing", "c").Result(); n != 2 {
+		t.Errorf("Expected DEL 2, got %d", n)
+	}
+}
+
+func TestRedisScan(t *testing.T) {
+	client := redis.NewClient(&redis.Options{Addr: newRedisServer(t)})
+	defer client.Close()
+	ctx := context.Background()
+
+	for _, key := range []string{"user:1", "user:2", "user:10", "order:1", "user:x"} {
+		client.Set(ctx, key, "v", 0)
+	}
+	want := []string{"user:1", "user:10", "user:2"}
+
+	var got []string
+	iter := client.Scan(ctx, 0, "user:[0-9]*", 1).Iterator()
+	for iter.Next(ctx) {
+		got = append(got, iter.Val())
+	}
+	if err := iter.Err(); err != nil {
+		t.Fatalf("SCAN failed: %v", err)
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("Expected %v, got %v", want, got)
+	}
+
+	all, _, err := client.Scan(ctx, 0, "", 100).Result()
+	if err != nil || len(all) != 5 {
+		t.Errorf("Expected all 5 keys and no internal ones, got %q (%v)", all, err)
+	}
+}
+
+func TestRedisRawProtocol(t *testing.T) {
+	conn, err := net.Dial("tcp", newRedisServer(t))
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+
+	// An inline command followed by a pipelined RESP2 array
+	conn.Write([]byte("PING\r\n*2\r\n$3\r\nGET\r\n$4\r\nnone\r\n*1\r\n$3\r\nFOO\r\n"))
+	for _, want := range []string{"+PONG\r\n", "$-1\r\n"} {
+		if line, _ := r.ReadString('\n'); line != want {
+			t.Errorf("Expected %q, got %q", want, line)
+		}
+	}
+	if line, _ := r.ReadString('\n'); line[0] != '-' {
+		t.Errorf("Expected an error for an unknown command, got %q", line)
+	}
+
+	conn.Write([]byte("*2\r\n$5\r\nHELLO\r\n$1\r\n3\r\n"))
+	if line, _ := r.ReadString('\n'); line != "%7\r\n" {
+		t.Fatalf("Expected a RESP3 map, got %q", line)
+	}
+	// The map ends with the empty modules array
+	for line := ""; line != "*0\r\n"; {
+		if line, err = r.ReadString('\n'); err != nil {
+			t.Fatalf("Reading HELLO reply failed: %v", err)
+		}
+	}
+	conn.Write([]byte("GET none\r\n"))
+	if line, _ := r.ReadString('\n'); line != "_\r\n" {
+		t.Errorf("Expected RESP3 null, got %q", line)
+	}
+}
@@ -0,0 +1,65 @@
+package test
+
+import (
+	"bigtable/internal/kvstore"
+	"reflect"
+	"testing"
+)
+
+func TestReverseScanPagination(t *testing.T) {
+	store, err := kvstore.NewKVStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to create KVStore: %v", err)
+	}
+	defer store.Close()
+
+	for _, key := range []string{"log:1", "log:2", "log:3", "log:4", "log:5", "other"} {
+		if err := store.Set(key, "v"); err != nil {
+			t.Fatalf("Set failed: %v", err)
+		}
+	}
+
+	var got []string
+	cursor := ""
+	for {
+		keys, next, err := store.ScanKey("log:", cursor, 2, true, nil)
+		if err != nil {
+			t.Fatalf("ScanKey failed: %v", err)
+		}
+		got = append(got, keys...)
+		if next == "" {
+			break
+		}
+		cursor = next
+	}
+	want := []string{"log:5", "log:4", "log:3", "log:2", "log:1"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %v, got %v", want, got)
+	}
+
+	// The snapshot cursor keeps paging backwards as well
+	got = nil
+	cursor = ""
+	for {
+		keys, next, err := store.ScanKeySnapshot("log:", cursor, 3, true, nil)
+		if err != nil {
+			t.Fatalf("ScanKeySnapshot failed: %v", err)
+		}
+		got = append(got, keys...)
+		if next == "" {
+			break
+		}
+		cursor = next
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %v from snapshot scan, got %v", want, got)
+	}
+
+	pairs, _, err := store.RangeQuery(kvstore.RangeOptions{StartKey: "log:2", EndKey: "log:5", Reverse: true})
+	if err != nil {
+		t.Fatalf("RangeQuery failed: %v", err)
+	}
+	if len(pairs) != 3 || pairs[0].Key != "log:4" || pairs[2].Key != "log:2" {
+		t.Errorf("Expected log:4..log:2 in descending order, got %v", pairs)
+	}
+}
@@ -0,0 +1,80 @@
+package test
+
+import (
+	"bigtable/internal/kvstore"
+	"errors"
+	"strconv"
+	"testing"
+)
+
+func TestSnapshotScanIgnoresConcurrentWrites(t *testing.T) {
+	store, err := kvstore.NewKVStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to create KVStore: %v", err)
+	}
+	defer store.Close()
+
+	for i := 0; i < 10; i++ {
+		if err := store.Set("item:"+strconv.Itoa(i), "v"); err != nil {
+			t.Fatalf("Set failed: %v", err)
+		}
+	}
+
+	keys, cursor, err := store.ScanKeySnapshot("item:", "", 4, false, nil)
+	if err != nil || len(keys) != 4 || cursor == "" {
+		t.Fatalf("Unexpected first page: %v %q (%v)", keys, cursor, err)
+	}
+
+	// Writes after the first page must not show up in later pages
+	if err := store.Delete("item:5"); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if err := store.Set("item:55", "v"); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+
+	total := len(keys)
+	for cursor != "" {
+		keys, cursor, err = store.ScanKeySnapshot("item:", cursor, 4, false, nil)
+		if err != nil {
+			t.Fatalf("ScanKeySnapshot failed: %v", err)
+		}
+		for _, key := range keys {
+			if key == "item:55" {
+				t.Errorf("Saw a key written after the snapshot")
+			}
+		}
+		total += len(keys)
+	}
+	if total != 10 {
+		t.Errorf("Expected 10 keys from the snapshot, got %d", total)
+	}
+
+	_, cursor, err = store.ScanKeySnapshot("item:", "", 2, false, nil)
+	if err != nil {
+		t.Fatalf("ScanKeySnapshot failed: %v", err)
+	}
+	// The cursor only continues the scan it came from
+	if _, _, err := store.ScanKeySnapshot("item:1", cursor, 2, false, nil); !errors.Is(err, kvstore.ErrInvalidCursor) {
+		t.Errorf("Expected ErrInvalidCursor for another prefix, got %v", err)
+	}
+	if _, _, err := store.ScanKeySnapshot("item:", cursor, 2, true, nil); !errors.Is(err, kvstore.ErrInvalidCursor) {
+		t.Errorf("Expected ErrInvalidCursor for another order, got %v", err)
+	}
+	filter := &kvstore.Filter{Type: "key_regex", Pattern: "1"}
+	if _, _, err := store.ScanKeySnapshot("item:", cursor, 2, false, filter); !errors.Is(err, kvstore.ErrInvalidCursor) {
+		t.Errorf("Expected ErrInvalidCursor for another filter, got %v", err)
+	}
+	if _, _, err := store.ScanValueByKeySnapshot("item:", cursor, 2, false, nil); !errors.Is(err, kvstore.ErrInvalidCursor) {
+		t.Errorf("Expected ErrInvalidCursor for another scan kind, got %v", err)
+	}
+	if keys, _, err := store.ScanKeySnapshot("item:", cursor, 3, false, nil); err != nil || len(keys) != 3 {
+		t.Errorf("A new limit should be accepted, got %v (%v)", keys, err)
+	}
+	if err := store.ReleaseSnapshot(cursor); err != nil {
+		t.Fatalf("ReleaseSnapshot failed: %v", err)
+	}
+	if _, _, err := store.ScanKeySnapshot("item:", cursor, 2, false, nil); !errors.Is(err, kvstore.ErrSnapshotExpired) {
+		t.Errorf("Expected ErrSnapshotExpired after release, got %v", err)
+	}
+}
@@ -0,0 +1,186 @@
+package test
+
+import (
+	"bigtable/internal/kvstore"
+	"bigtable/internal/node"
+	"bigtable/internal/rest"
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestScanStream(t *testing.T) {
+	n := newTestNode(t)
+	for i := 0; i < 1000; i++ {
+		if err := n.Set("row:"+strconv.Itoa(1000+i), strconv.Itoa(i)); err != nil {
+			t.Fatalf("Set failed: %v", err)
+		}
+	}
+	if err := n.Set("other", "x"); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(rest.NewKVStoreService(n).HandleScanStream))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "?prefix=row:&reverse=true")
+	if err != nil {
+		t.Fatalf("GET failed: %v", err)
+	}
+	scanner := bufio.NewScanner(resp.Body)
+	count := 0
+	last := ""
+	for scanner.Scan() {
+		var entry struct{ Key, Value string }
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			t.Fatalf("Bad NDJSON line %q: %v", scanner.Text(), err)
+		}
+		if last != "" && entry.Key >= last {
+			t.Fatalf("Keys out of order: %s after %s", entry.Key, last)
+		}
+		last = entry.Key
+		count++
+	}
+	resp.Body.Close()
+	if count != 1000 {
+		t.Errorf("Expected 1000 lines, got %d", count)
+	}
+	if resp.Trailer.Get("X-Stream-Error") != "" {
+		t.Errorf("Unexpected stream error: %s", resp.Trailer.Get("X-Stream-Error"))
+	}
+
+	resp, err = http.Get(server.URL + "?startKey=row:1000&endKey=row:1010&endInclusive=true&format=binary&limit=5")
+	if err != nil {
+		t.Fatalf("GET failed: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	frames := 0
+	for len(body) > 0 {
+		keyLen := binary.BigEndian.Uint32(body)
+		body = body[4+keyLen:]
+		valueLen := binary.BigEndian.Uint32(body)
+		body = body[4+valueLen:]
+		frames++
+	}
+	if frames != 5 {
+		t.Errorf("Expected 5 frames, got %d", frames)
+	}
+	if cursor := resp.Trailer.Get("X-Next-Cursor"); cursor != "row:1005" {
+		t.Errorf("Expected cursor row:1005, got %q", cursor)
+	}
+}
+
+func TestStreamRangeCancellation(t *testing.T) {
+	store, err := kvstore.NewKVStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to create KVStore: %v", err)
+	}
+	defer store.Close()
+
+	for i := 0; i < 1000; i++ {
+		if err := store.Set("k"+strconv.Itoa(i), "v"); err != nil {
+			t.Fatalf("Set failed: %v", err)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	seen := 0
+	_, err = store.StreamRange(ctx, kvstore.RangeOptions{}, func(key, value []byte) error {
+		seen++
+		if seen == 10 {
+			cancel()
+		}
+		return nil
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected context.Canceled, got %v", err)
+	}
+	if seen >= 1000 {
+		t.Errorf("Stream kept going after cancellation")
+	}
+}
+
+// cancelAfterStart is a context that is canceled from its second check on,
+// which is inside the scan.
+type cancelAfterStart struct {
+	context.Context
+	checks int
+}
+
+func (c *cancelAfterStart) Err() error {
+	c.checks++
+	if c.checks > 1 {
+		return context.Canceled
+	}
+	return nil
+}
+
+func TestStreamRangeCancellationWithoutMatches(t *testing.T) {
+	store, err := kvstore.NewKVStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to create KVStore: %v", err)
+	}
+	defer store.Close()
+
+	for i := 0; i < 1000; i++ {
+		if err := store.Set("k"+strconv.Itoa(i), "v"); err != nil {
+			t.Fatalf("Set failed: %v", err)
+		}
+	}
+
+	// A filter nothing passes still notices the client left
+	filter := &kvstore.Filter{Type: "key_regex", Pattern: "^none$"}
+	ctx := &cancelAfterStart{Context: context.Background()}
+	_, err = store.StreamRange(ctx, kvstore.RangeOptions{Filter: filter}, func(key, value []byte) error {
+		t.Errorf("Unexpected entry %q", key)
+		return nil
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected context.Canceled, got %v", err)
+	}
+}
+
+func TestCloseEndsOpenStreams(t *testing.T) {
+	n, err := node.NewKVNode(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to create KVNode: %v", err)
+	}
+
+	for i := 0; i < 1000; i++ {
+		if err := n.Set("k"+strconv.Itoa(i), "v"); err != nil {
+			t.Fatalf("Set failed: %v", err)
+		}
+	}
+
+	// Close must stop the stream and wait for it before closing the db
+	started := make(chan struct{})
+	result := make(chan error, 1)
+	go func() {
+		first := true
+		_, err := n.StreamRange(context.Background(), kvstore.RangeOptions{}, func(key, value []byte) error {
+			if first {
+				first = false
+				close(started)
+				time.Sleep(20 * time.Millisecond)
+			}
+			return nil
+		})
+		result <- err
+	}()
+	<-started
+	if err := n.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	if err := <-result; err == nil {
+		t.Errorf("Expected the stream to end with an error")
+	}
+}
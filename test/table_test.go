@@ -0,0 +1,218 @@
+package test
+
+import (
+	"bigtable/internal/kvstore"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTableMutateAndReadRows(t *testing.T) {
+	store, err := kvstore.NewKVStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to create KVStore: %v", err)
+	}
+	defer store.Close()
+
+	if err := store.CreateTable("users", []kvstore.ColumnFamily{{Name: "profile"}, {Name: "stats"}}); err != nil {
+		t.Fatalf("CreateTable failed: %v", err)
+	}
+	if err := store.CreateTable("users", nil); err != kvstore.ErrTableExists {
+		t.Fatalf("Expected ErrTableExists, got %v", err)
+	}
+
+	// Row keys that would collide with a naive separator-based encoding
+	for _, row := range []string{"a", "a\x00b", "ab", "b"} {
+		err := store.MutateRow("users", row, []kvstore.Mutation{
+			{Type: "set", Family: "profile", Qualifier: "name", Value: "name-" + row},
+			{Type: "set", Family: "stats", Qualifier: "visits", Value: "1"},
+		})
+		if err != nil {
+			t.Fatalf("MutateRow %q failed: %v", row, err)
+		}
+	}
+
+	err = store.MutateRow("users", "a", []kvstore.Mutation{{Type: "set", Family: "missing", Qualifier: "x"}})
+	if err == nil {
+		t.Fatalf("Expected error for unknown column family")
+	}
+
+	rows, next, err := store.ReadRows("users", "", "", 3, kvstore.ReadOptions{})
+	if err != nil {
+		t.Fatalf("ReadRows failed: %v", err)
+	}
+	want := []string{"a", "a\x00b", "ab"}
+	if len(rows) != len(want) || next != "b" {
+		t.Fatalf("Unexpected page: %d rows, next %q", len(rows), next)
+	}
+	for i, row := range rows {
+		if row.Key != want[i] || len(row.Cells) != 2 {
+			t.Errorf("Row %d: got %q with %d cells", i, row.Key, len(row.Cells))
+		}
+	}
+
+	if err := store.MutateRow("users", "a", []kvstore.Mutation{{Type: "delete_family", Family: "stats"}}); err != nil {
+		t.Fatalf("delete_family failed: %v", err)
+	}
+	row, err := store.ReadRow("users", "a", kvstore.ReadOptions{})
+	if err != nil {
+		t.Fatalf("ReadRow failed: %v", err)
+	}
+	if len(row.Cells) != 1 || row.Cells[0].Value != "name-a" {
+		t.Errorf("Unexpected cells after delete_family: %+v", row.Cells)
+	}
+
+	if err := store.DeleteTable("users"); err != nil {
+		t.Fatalf("DeleteTable failed: %v", err)
+	}
+	tables, err := store.ListTables()
+	if err != nil || len(tables) != 0 {
+		t.Fatalf("Expected no tables, got %v (%v)", tables, err)
+	}
+}
+
+func TestCellVersions(t *testing.T) {
+	store, err := kvstore.NewKVStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to create KVStore: %v", err)
+	}
+	defer store.Close()
+
+	if err := store.CreateTable("metrics", []kvstore.ColumnFamily{{Name: "cf"}}); err != nil {
+		t.Fatalf("CreateTable failed: %v", err)
+	}
+	for ts := int64(100); ts <= 500; ts += 100 {
+		err := store.MutateRow("metrics", "r1", []kvstore.Mutation{
+			{Type: "set", Family: "cf", Qualifier: "q", Value: strconv.FormatInt(ts, 10), Timestamp: ts},
+		})
+		if err != nil {
+			t.Fatalf("MutateRow failed: %v", err)
+		}
+	}
+
+	row, err := store.ReadRow("metrics", "r1", kvstore.ReadOptions{MaxVersions: 2})
+	if err != nil {
+		t.Fatalf("ReadRow failed: %v", err)
+	}
+	if len(row.Cells) != 2 || row.Cells[0].Timestamp != 500 || row.Cells[1].Timestamp != 400 {
+		t.Fatalf("Expected versions 500 and 400, got %+v", row.Cells)
+	}
+
+	row, err = store.ReadRow("metrics", "r1", kvstore.ReadOptions{StartTimestamp: 200, EndTimestamp: 400})
+	if err != nil {
+		t.Fatalf("ReadRow failed: %v", err)
+	}
+	if len(row.Cells) != 2 || row.Cells[0].Value != "300" || row.Cells[1].Value != "200" {
+		t.Fatalf("Expected versions 300 and 200, got %+v", row.Cells)
+	}
+
+	err = store.MutateRow("metrics", "r1", []kvstore.Mutation{
+		{Type: "delete_cell", Family: "cf", Qualifier: "q", StartTimestamp: 200, EndTimestamp: 500},
+	})
+	if err != nil {
+		t.Fatalf("delete_cell failed: %v", err)
+	}
+	row, err = store.ReadRow("metrics", "r1", kvstore.ReadOptions{})
+	if err != nil {
+		t.Fatalf("ReadRow failed: %v", err)
+	}
+	if len(row.Cells) != 2 || row.Cells[0].Timestamp != 500 || row.Cells[1].Timestamp != 100 {
+		t.Fatalf("Expected versions 500 and 100 to survive, got %+v", row.Cells)
+	}
+}
+
+func TestGCRules(t *testing.T) {
+	store, err := kvstore.NewKVStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to create KVStore: %v", err)
+	}
+	defer store.Close()
+
+	families := []kvstore.ColumnFamily{
+		{Name: "recent", GCRule: &kvstore.GCRule{MaxVersions: 2}},
+		{Name: "events", GCRule: &kvstore.GCRule{Union: []kvstore.GCRule{{MaxVersions: 3}, {MaxAge: 3600}}}},
+	}
+	if err := store.CreateTable("gc", families); err != nil {
+		t.Fatalf("CreateTable failed: %v", err)
+	}
+	for _, rule := range []string{`{"union":[]}`, `{"intersection":[]}`, `{"union":[{"maxVersions":1},{"intersection":[]}]}`} {
+		var gcRule kvstore.GCRule
+		if err := json.Unmarshal([]byte(rule), &gcRule); err != nil {
+			t.Fatalf("Unmarshal %s failed: %v", rule, err)
+		}
+		if err := store.SetColumnFamily("gc", kvstore.ColumnFamily{Name: "empty", GCRule: &gcRule}); err == nil {
+			t.Errorf("Expected %s to be rejected", rule)
+		}
+	}
+
+	now := time.Now().UnixMicro()
+	var mutations []kvstore.Mutation
+	for i := int64(0); i < 5; i++ {
+		mutations = append(mutations,
+			kvstore.Mutation{Type: "set", Family: "recent", Qualifier: "q", Value: "v", Timestamp: now - i},
+			// Only the two newest versions are younger than one hour
+			kvstore.Mutation{Type: "set", Family: "events", Qualifier: "q", Value: "v", Timestamp: now - i*int64(40*time.Minute/time.Microsecond)},
+		)
+	}
+	if err := store.MutateRow("gc", "r1", mutations); err != nil {
+		t.Fatalf("MutateRow failed: %v", err)
+	}
+
+	countCells := func() map[string]int {
+		row, err := store.ReadRow("gc", "r1", kvstore.ReadOptions{})
+		if err != nil {
+			t.Fatalf("ReadRow failed: %v", err)
+		}
+		counts := make(map[string]int)
+		for _, cell := range row.Cells {
+			counts[cell.Family]++
+		}
+		return counts
+	}
+
+	// Reads hide garbage before the collector runs
+	if counts := countCells(); counts["recent"] != 2 || counts["events"] != 2 {
+		t.Fatalf("Unexpected visible versions: %v", counts)
+	}
+
+	trimmed, err := store.CollectGarbage()
+	if err != nil {
+		t.Fatalf("CollectGarbage failed: %v", err)
+	}
+	if trimmed != 2 {
+		t.Errorf("Expected 2 trimmed columns, got %d", trimmed)
+	}
+
+	// Removing the rule must not resurrect collected versions
+	if err := store.SetColumnFamily("gc", kvstore.ColumnFamily{Name: "recent"}); err != nil {
+		t.Fatalf("SetColumnFamily failed: %v", err)
+	}
+	if counts := countCells(); counts["recent"] != 2 {
+		t.Fatalf("Expected collected versions to stay deleted, got %v", counts)
+	}
+}
+
+func TestTableRoutesRequirePost(t *testing.T) {
+	ts := newV1Server(t)
+
+	resp, body := doRequest(t, http.MethodPost, ts.URL+"/createtable", `{"name":"t1","columnFamilies":[{"name":"cf"}]}`)
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("createtable: expected 201, got %d: %s", resp.StatusCode, body)
+	}
+	for _, path := range []string{"/deletetable?table=t1", "/dropcolumnfamily?table=t1&family=cf", "/mutaterow"} {
+		if resp, body := doRequest(t, http.MethodGet, ts.URL+path, ""); resp.StatusCode != http.StatusMethodNotAllowed {
+			t.Errorf("GET %s: expected 405, got %d: %s", path, resp.StatusCode, body)
+		}
+	}
+
+	_, body = doRequest(t, http.MethodGet, ts.URL+"/listtables", "")
+	if !strings.Contains(body, `"cf"`) {
+		t.Errorf("Table or family was dropped by a GET: %s", body)
+	}
+	if resp, body := doRequest(t, http.MethodDelete, ts.URL+"/deletetable?table=t1", ""); resp.StatusCode != http.StatusOK {
+		t.Errorf("DELETE /deletetable: expected 200, got %d: %s", resp.StatusCode, body)
+	}
+}
@@ -0,0 +1,240 @@
+package test
+
+import (
+	"bigtable/internal/kvstore"
+	"bigtable/internal/rpc/pb"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"sync"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestTransactionConflicts(t *testing.T) {
+	node := newTestNode(t)
+	node.Set("a", "1")
+	node.Set("b", "1")
+
+	// read-write: a key read by t1 is changed before t1 commits
+	t1, err := node.BeginTransaction(0)
+	if err != nil {
+		t.Fatalf("Begin failed: %v", err)
+	}
+	if v, _, err := node.TxnGet(t1, "a"); err != nil || v != "1" {
+		t.Fatalf("Expected 1, got %q (%v)", v, err)
+	}
+	node.Set("a", "2")
+	if v, _, _ := node.TxnGet(t1, "a"); v != "1" {
+		t.Errorf("Expected the snapshot value 1, got %q", v)
+	}
+	node.TxnWrite(t1, []kvstore.BatchOperation{{Type: "set", Key: "c", Value: "x"}})
+	if err := node.CommitTransaction(t1); !errors.Is(err, kvstore.ErrTxnConflict) {
+		t.Fatalf("Expected a conflict, got %v", err)
+	}
+	if _, err := node.Get("c"); err == nil {
+		t.Error("An aborted transaction wrote c")
+	}
+	if err := node.CommitTransaction(t1); !errors.Is(err, kvstore.ErrTxnNotFound) {
+		t.Errorf("Expected the transaction to be gone, got %v", err)
+	}
+
+	// write-write: two blind writes to b, the first commit wins
+	t2, _ := node.BeginTransaction(0)
+	t3, _ := node.BeginTransaction(0)
+	node.TxnWrite(t2, []kvstore.BatchOperation{{Type: "set", Key: "b", Value: "t2"}})
+	node.TxnWrite(t3, []kvstore.BatchOperation{{Type: "set", Key: "b", Value: "t3"}})
+	if err := node.CommitTransaction(t2); err != nil {
+		t.Fatalf("Commit failed: %v", err)
+	}
+	if err := node.CommitTransaction(t3); !errors.Is(err, kvstore.ErrTxnConflict) {
+		t.Fatalf("Expected a write-write conflict, got %v", err)
+	}
+	if v, _ := node.Get("b"); v != "t2" {
+		t.Errorf("Expected t2, got %q", v)
+	}
+
+	// reads see the transaction's own writes; inserting a key read as missing conflicts
+	t4, _ := node.BeginTransaction(0)
+	node.TxnWrite(t4, []kvstore.BatchOperation{{Type: "delete", Key: "a"}})
+	if _, _, err := node.TxnGet(t4, "a"); err == nil {
+		t.Error("Expected the buffered delete to hide a")
+	}
+	if _, _, err := node.TxnGet(t4, "new"); err == nil {
+		t.Error("Expected new to be missing")
+	}
+	node.Set("new", "1")
+	if err := node.CommitTransaction(t4); !errors.Is(err, kvstore.ErrTxnConflict) {
+		t.Errorf("Expected a conflict on the inserted key, got %v", err)
+	}
+
+	t5, _ := node.BeginTransaction(0)
+	if err := node.RollbackTransaction(t5); err != nil {
+		t.Errorf("Rollback failed: %v", err)
+	}
+	if _, _, err := node.TxnGet(t5, "a"); !errors.Is(err, kvstore.ErrTxnNotFound) {
+		t.Errorf("Expected ErrTxnNotFound after rollback, got %v", err)
+	}
+}
+
+// TestTransactionTransfers moves money between accounts from many goroutines,
+// retrying aborted transactions. The total must not change.
+func TestTransactionTransfers(t *testing.T) {
+	node := newTestNode(t)
+	accounts := []string{"acct:0", "acct:1", "acct:2", "acct:3"}
+	for _, key := range accounts {
+		node.Set(key, "100")
+	}
+
+	transfer := func(from, to string) error {
+		for {
+			id, err := node.BeginTransaction(0)
+			if err != nil {
+				return err
+			}
+			a, _, err := node.TxnGet(id, from)
+			if err != nil {
+				return err
+			}
+			b, _, err := node.TxnGet(id, to)
+			if err != nil {
+				return err
+			}
+			x, _ := strconv.Atoi(a)
+			y, _ := strconv.Atoi(b)
+			node.TxnWrite(id, []kvstore.BatchOperation{
+				{Type: "set", Key: from, Value: strconv.Itoa(x - 1)},
+				{Type: "set", Key: to, Value: strconv.Itoa(y + 1)},
+			})
+			err = node.CommitTransaction(id)
+			if !errors.Is(err, kvstore.ErrTxnConflict) {
+				return err
+			}
+		}
+	}
+
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 25; i++ {
+				if err := transfer(accounts[(g+i)%4], accounts[(g+i+1)%4]); err != nil {
+					t.Errorf("Transfer failed: %v", err)
+					return
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+
+	total := 0
+	for _, key := range accounts {
+		v, _ := node.Get(key)
+		n, _ := strconv.Atoi(v)
+		total += n
+	}
+	if total != 400 {
+		t.Errorf("Expected a total of 400, got %d", total)
+	}
+}
+
+func TestTransactionREST(t *testing.T) {
+	ts := newV1Server(t)
+
+	resp, body := doRequest(t, http.MethodPost, ts.URL+"/v1/txn?timeout=5", "")
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("Expected 201, got %d: %s", resp.StatusCode, body)
+	}
+	var txn struct {
+		ID      string `json:"id"`
+		Timeout int64  `json:"timeout"`
+	}
+	if err := json.Unmarshal([]byte(body), &txn); err != nil || txn.ID == "" || txn.Timeout != 5 {
+		t.Fatalf("Unexpected begin response %s", body)
+	}
+
+	base := ts.URL + "/v1/txn/" + txn.ID
+	if resp, body := doRequest(t, http.MethodPut, base+"/kv/user/1", `{"balance":10}`); resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("Expected 204, got %d: %s", resp.StatusCode, body)
+	}
+	if resp, body := doRequest(t, http.MethodGet, base+"/kv/user/1", ""); resp.StatusCode != http.StatusOK || body != `{"balance":10}` {
+		t.Errorf("Expected own write, got %d: %s", resp.StatusCode, body)
+	}
+	if resp, body := doRequest(t, http.MethodGet, ts.URL+"/v1/kv/user/1", ""); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("Uncommitted write is visible: %d %s", resp.StatusCode, body)
+	}
+	resp, body = doRequest(t, http.MethodPost, base+"/batch", `{"operations":[{"type":"increment","key":"n","value":1}]}`)
+	expectError(t, resp, body, http.StatusBadRequest, "invalid_argument")
+
+	if resp, body := doRequest(t, http.MethodPost, base+"/commit", ""); resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("Expected 204, got %d: %s", resp.StatusCode, body)
+	}
+	if resp, body := doRequest(t, http.MethodGet, ts.URL+"/v1/kv/user/1", ""); resp.StatusCode != http.StatusOK || body != `{"balance":10}` {
+		t.Errorf("Expected committed value, got %d: %s", resp.StatusCode, body)
+	}
+	resp, body = doRequest(t, http.MethodPost, base+"/commit", "")
+	expectError(t, resp, body, http.StatusNotFound, "not_found")
+
+	// A conflicting commit answers 409 aborted
+	_, body = doRequest(t, http.MethodPost, ts.URL+"/v1/txn", "")
+	json.Unmarshal([]byte(body), &txn)
+	base = ts.URL + "/v1/txn/" + txn.ID
+	doRequest(t, http.MethodGet, base+"/kv/user/1", "")
+	doRequest(t, http.MethodPut, ts.URL+"/v1/kv/user/1", `{"balance":0}`)
+	doRequest(t, http.MethodPut, base+"/kv/user/2", `1`)
+	resp, body = doRequest(t, http.MethodPost, base+"/commit", "")
+	expectError(t, resp, body, http.StatusConflict, "aborted")
+
+	resp, body = doRequest(t, http.MethodPost, ts.URL+"/v1/txn?timeout=-1", "")
+	expectError(t, resp, body, http.StatusBadRequest, "invalid_argument")
+}
+
+func TestTransactionGRPC(t *testing.T) {
+	client := pb.NewTransactionsClient(newGRPCClient(t))
+	ctx := context.Background()
+
+	begin, err := client.Begin(ctx, &pb.BeginRequest{})
+	if err != nil || begin.TimeoutSeconds != 30 {
+		t.Fatalf("Begin failed: %v %v", begin, err)
+	}
+	if _, err := client.Get(ctx, &pb.TxnGetRequest{Id: begin.Id, Key: []byte("k")}); status.Code(err) != codes.NotFound {
+		t.Errorf("Expected NotFound, got %v", err)
+	}
+	_, err = client.Write(ctx, &pb.TxnWriteRequest{Id: begin.Id, Operations: []*pb.Operation{
+		{Type: pb.Operation_SET, Key: []byte("k"), Value: []byte("v")},
+	}})
+	if err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	if _, err := client.Commit(ctx, &pb.CommitRequest{Id: begin.Id}); err != nil {
+		t.Fatalf("Commit failed: %v", err)
+	}
+
+	begin, _ = client.Begin(ctx, &pb.BeginRequest{TimeoutSeconds: 5})
+	client.Get(ctx, &pb.TxnGetRequest{Id: begin.Id, Key: []byte("k")})
+	client.Write(ctx, &pb.TxnWriteRequest{Id: begin.Id, Operations: []*pb.Operation{
+		{Type: pb.Operation_DELETE, Key: []byte("k")},
+	}})
+	other, _ := client.Begin(ctx, &pb.BeginRequest{})
+	client.Write(ctx, &pb.TxnWriteRequest{Id: other.Id, Operations: []*pb.Operation{
+		{Type: pb.Operation_SET, Key: []byte("k"), Value: []byte("w")},
+	}})
+	if _, err := client.Commit(ctx, &pb.CommitRequest{Id: other.Id}); err != nil {
+		t.Fatalf("Commit failed: %v", err)
+	}
+	if _, err := client.Commit(ctx, &pb.CommitRequest{Id: begin.Id}); status.Code(err) != codes.Aborted {
+		t.Errorf("Expected Aborted, got %v", err)
+	}
+	begin, _ = client.Begin(ctx, &pb.BeginRequest{})
+	_, err = client.Write(ctx, &pb.TxnWriteRequest{Id: begin.Id, Operations: []*pb.Operation{
+		{Type: pb.Operation_INCREMENT, Key: []byte("n"), Delta: 1},
+	}})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("Expected InvalidArgument for increment, got %v", err)
+	}
+}
@@ -0,0 +1,176 @@
+package test
+
+import (
+	"bigtable/internal/kvstore"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestKeyTTL(t *testing.T) {
+	store, err := kvstore.NewKVStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to create KVStore: %v", err)
+	}
+	defer store.Close()
+
+	if err := store.SetWithTTL("session:1", "a", 50*time.Millisecond); err != nil {
+		t.Fatalf("SetWithTTL failed: %v", err)
+	}
+	if err := store.SetWithTTL("session:2", "b", 50*time.Millisecond); err != nil {
+		t.Fatalf("SetWithTTL failed: %v", err)
+	}
+	// Values that look like the internal header must round-trip
+	if err := store.Set("session:3", "\x00raw"); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	err = store.BatchOperation([]kvstore.BatchOperation{
+		{Type: "set", Key: "session:4", Value: "d", TTL: 3600},
+	})
+	if err != nil {
+		t.Fatalf("BatchOperation failed: %v", err)
+	}
+
+	if v, err := store.Get("session:1"); err != nil || v != "a" {
+		t.Fatalf("Expected live value, got %q (%v)", v, err)
+	}
+
+	// Overwriting without a TTL must keep the key alive
+	if err := store.Set("session:2", "b2"); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+
+	if _, err := store.Get("session:1"); err == nil {
+		t.Errorf("Expected session:1 to be expired")
+	}
+	if v, err := store.Get("session:3"); err != nil || v != "\x00raw" {
+		t.Errorf("Expected raw value to round-trip, got %q (%v)", v, err)
+	}
+
+	keys, _, err := store.ScanKey("session:", "", 10, false, nil)
+	if err != nil {
+		t.Fatalf("ScanKey failed: %v", err)
+	}
+	if len(keys) != 3 || keys[0] != "session:2" {
+		t.Errorf("Unexpected keys after expiry: %v", keys)
+	}
+	if total, err := store.TotalKey("session:"); err != nil || total != 3 {
+		t.Errorf("Expected 3 live keys, got %d (%v)", total, err)
+	}
+
+	reaped, err := store.ReapExpired()
+	if err != nil {
+		t.Fatalf("ReapExpired failed: %v", err)
+	}
+	if reaped != 1 {
+		t.Errorf("Expected 1 reaped key, got %d", reaped)
+	}
+	if v, err := store.Get("session:2"); err != nil || v != "b2" {
+		t.Errorf("Overwritten key was reaped: %q (%v)", v, err)
+	}
+}
+
+func TestScanKeysLowerSkipsExpired(t *testing.T) {
+	store, err := kvstore.NewKVStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to create KVStore: %v", err)
+	}
+	defer store.Close()
+
+	for i := 1; i <= 6; i++ {
+		ttl := time.Duration(0)
+		if i <= 3 {
+			ttl = 20 * time.Millisecond
+		}
+		if err := store.SetWithTTL("log "+strconv.Itoa(i)+":", "v", ttl); err != nil {
+			t.Fatalf("SetWithTTL failed: %v", err)
+		}
+	}
+	time.Sleep(50 * time.Millisecond)
+
+	keys, next, err := store.ScanKeysLower("log", 10, "", 3)
+	if err != nil {
+		t.Fatalf("ScanKeysLower failed: %v", err)
+	}
+	if len(keys) != 3 || keys[0] != "log 4:" || keys[2] != "log 6:" || next != "" {
+		t.Errorf("Expired keys used up the page: %q, next %q", keys, next)
+	}
+}
+
+func TestReaperKeepsRefreshedKeys(t *testing.T) {
+	n := newTestNode(t)
+
+	for i := 0; i < 100; i++ {
+		key := "cache:" + strconv.Itoa(i)
+		if err := n.SetWithTTL(key, "old", time.Millisecond); err != nil {
+			t.Fatalf("SetWithTTL failed: %v", err)
+		}
+	}
+	time.Sleep(5 * time.Millisecond)
+
+	// Refill the expired keys while the reaper deletes them
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		if _, err := n.ReapExpired(); err != nil {
+			t.Errorf("ReapExpired failed: %v", err)
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		if err := n.Set("cache:"+strconv.Itoa(i), "new"); err != nil {
+			t.Fatalf("Set failed: %v", err)
+		}
+	}
+	wg.Wait()
+
+	for i := 0; i < 100; i++ {
+		if v, err := n.Get("cache:" + strconv.Itoa(i)); err != nil || v != "new" {
+			t.Fatalf("Refilled key cache:%d was lost: %q (%v)", i, v, err)
+		}
+	}
+}
+
+func TestReaperKeepsKeysOfRangeBatches(t *testing.T) {
+	n := newTestNode(t)
+
+	const keys = 2000
+
+	for i := 0; i < keys; i++ {
+		key := "cache:" + strconv.Itoa(i)
+		if err := n.SetWithTTL(key, "old", time.Millisecond); err != nil {
+			t.Fatalf("SetWithTTL failed: %v", err)
+		}
+	}
+	time.Sleep(5 * time.Millisecond)
+
+	// Batches with a range delete lock the node exclusively, and must still
+	// keep the reaper away from their point keys
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		if _, err := n.ReapExpired(); err != nil {
+			t.Errorf("ReapExpired failed: %v", err)
+		}
+	}()
+	for i := 0; i < keys; i++ {
+		err := n.BatchWrite([]kvstore.BatchOperation{
+			{Type: "delete_range", Key: "tmp:a", EndKey: "tmp:b"},
+			{Type: "set", Key: "cache:" + strconv.Itoa(i), Value: "new"},
+		})
+		if err != nil {
+			t.Fatalf("BatchWrite failed: %v", err)
+		}
+	}
+	wg.Wait()
+
+	for i := 0; i < keys; i++ {
+		if v, err := n.Get("cache:" + strconv.Itoa(i)); err != nil || v != "new" {
+			t.Fatalf("Key cache:%d of a range batch was lost: %q (%v)", i, v, err)
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package test
+
+import (
+	"bigtable/internal/rest"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func newV1Server(t *testing.T) *httptest.Server {
+	t.Helper()
+	server := rest.NewServer(rest.NewKVStoreService(newTestNode(t)))
+	server.SetupRoutes()
+	ts := httptest.NewServer(server.Handler())
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+func doRequest(t *testing.T, method, url, body string) (*http.Response, string) {
+	t.Helper()
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("NewRequest failed: %v", err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("%s %s failed: %v", method, url, err)
+	}
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(resp.Body)
+	return resp, string(data)
+}
+
+func expectError(t *testing.T, resp *http.Response, body string, status int, code string) {
+	t.Helper()
+	if resp.StatusCode != status {
+		t.Fatalf("Expected %d, got %d: %s", status, resp.StatusCode, body)
+	}
+	var envelope rest.ErrorResponse
+	if err := json.Unmarshal([]byte(body), &envelope); err != nil {
+		t.Fatalf("Bad error envelope %q: %v", body, err)
+	}
+	if envelope.Error.Code != code || envelope.Error.Message == "" {
+		t.Errorf("Expected code %s, got %+v", code, envelope.Error)
+	}
+}
+
+func TestV1KV(t *testing.T) {
+	ts := newV1Server(t)
+
+	resp, body := doRequest(t, http.MethodGet, ts.URL+"/v1/kv/missing", "")
+	expectError(t, resp, body, http.StatusNotFound, rest.CodeNotFound)
+
+	resp, body = doRequest(t, http.MethodPut, ts.URL+"/v1/kv/user/1", `{"name":"kim"}`)
+	if resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("Expected 204, got %d: %s", resp.StatusCode, body)
+	}
+
+	resp, body = doRequest(t, http.MethodGet, ts.URL+"/v1/kv/user/1", "")
+	if resp.StatusCode != http.StatusOK || body != `{"name":"kim"}` {
+		t.Errorf("Unexpected GET response %d %s", resp.StatusCode, body)
+	}
+	if resp.Header.Get("X-Version") == "" {
+		t.Error("Missing X-Version header")
+	}
+
+	resp, body = doRequest(t, http.MethodPost, ts.URL+"/v1/kv/user/1", "")
+	expectError(t, resp, body, http.StatusMethodNotAllowed, rest.CodeMethodNotAllowed)
+	if resp.Header.Get("Allow") != "DELETE, GET, PUT" {
+		t.Errorf("Unexpected Allow header %q", resp.Header.Get("Allow"))
+	}
+
+	resp, body = doRequest(t, http.MethodPut, ts.URL+"/v1/kv/user/1", `{"name":`)
+	expectError(t, resp, body, http.StatusBadRequest, rest.CodeInvalidArgument)
+
+	resp, _ = doRequest(t, http.MethodDelete, ts.URL+"/v1/kv/user/1", "")
+	if resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("Expected 204, got %d", resp.StatusCode)
+	}
+	resp, body = doRequest(t, http.MethodGet, ts.URL+"/v1/kv/user/1", "")
+	expectError(t, resp, body, http.StatusNotFound, rest.CodeNotFound)
+
+	resp, body = doRequest(t, http.MethodGet, ts.URL+"/v1/nothing", "")
+	expectError(t, resp, body, http.StatusNotFound, rest.CodeNotFound)
+}
+
+func TestV1Batch(t *testing.T) {
+	ts := newV1Server(t)
+
+	resp, body := doRequest(t, http.MethodPost, ts.URL+"/v1/batch",
+		`{"operations":[{"type":"set","key":"a","value":1},{"type":"increment","key":"n","value":5}]}`)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", resp.StatusCode, body)
+	}
+	var batch rest.BatchResponse
+	if err := json.Unmarshal([]byte(body), &batch); err != nil {
+		t.Fatalf("Bad batch response: %v", err)
+	}
+	if len(batch.Results) != 2 || batch.Results[1] != "5" {
+		t.Errorf("Unexpected batch results %v", batch.Results)
+	}
+
+	resp, body = doRequest(t, http.MethodGet, ts.URL+"/v1/batch", "")
+	expectError(t, resp, body, http.StatusMethodNotAllowed, rest.CodeMethodNotAllowed)
+
+	for _, op := range []string{`{"type":"bogus","key":"a"}`, `{"type":"set","key":"a","value":1,"ttl":-5}`, `{"type":"increment","key":"n","value":1.5}`} {
+		resp, body = doRequest(t, http.MethodPost, ts.URL+"/v1/batch", `{"operations":[`+op+`]}`)
+		expectError(t, resp, body, http.StatusBadRequest, rest.CodeInvalidArgument)
+	}
+	_, body = doRequest(t, http.MethodPost, ts.URL+"/v1/txn", "")
+	var txn rest.TxnResponse
+	if err := json.Unmarshal([]byte(body), &txn); err != nil {
+		t.Fatalf("Bad txn response %q: %v", body, err)
+	}
+	resp, body = doRequest(t, http.MethodPost, ts.URL+"/v1/txn/"+txn.ID+"/batch", `{"operations":[{"type":"set","key":"a","value":1,"ttl":-5}]}`)
+	expectError(t, resp, body, http.StatusBadRequest, rest.CodeInvalidArgument)
+
+	// The old endpoints still answer as before
+	resp, body = doRequest(t, http.MethodGet, ts.URL+"/get?key=a", "")
+	if resp.StatusCode != http.StatusOK || body != "1" {
+		t.Errorf("Unexpected legacy GET response %d %s", resp.StatusCode, body)
+	}
+}
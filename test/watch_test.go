@@ -0,0 +1,269 @@
+package test
+
+import (
+	"bigtable/internal/kvstore"
+	"bigtable/internal/rest"
+	"bigtable/internal/rpc/pb"
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/net/websocket"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// collectChanges watches until n changes arrived or a second passed.
+func collectChanges(t *testing.T, store *kvstore.KVStore, prefix string, after uint64, n int) []kvstore.Change {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	var changes []kvstore.Change
+	done := errors.New("done")
+	err := store.WatchChanges(ctx, prefix, after, func(change kvstore.Change) error {
+		changes = append(changes, change)
+		if len(changes) == n {
+			return done
+		}
+		return nil
+	})
+	if err != done {
+		t.Fatalf("Expected %d changes, got %d (%v)", n, len(changes), err)
+	}
+	return changes
+}
+
+func TestChangeLog(t *testing.T) {
+	dir := t.TempDir()
+	store, err := kvstore.NewKVStore(dir)
+	if err != nil {
+		t.Fatalf("Failed to create KVStore: %v", err)
+	}
+
+	store.SetWithTTL("user/1", "a", time.Hour)
+	store.Set("other", "x")
+	store.Delete("user/1")
+	store.BatchOperation([]kvstore.BatchOperation{
+		{Type: "set", Key: "user/2", Value: "b"},
+		{Type: "increment", Key: "user/n", Value: int64(3)},
+		{Type: "delete_prefix", Key: "user/"},
+	})
+	if last := store.LastChangeSeq(); last != 6 {
+		t.Fatalf("Expected 6 changes, got %d", last)
+	}
+
+	changes := collectChanges(t, store, "user/", 0, 5)
+	want := []struct {
+		seq       uint64
+		typ, key  string
+		value     string
+		expiresAt bool
+	}{
+		{1, "set", "user/1", "a", true},
+		{3, "delete", "user/1", "", false},
+		{4, "set", "user/2", "b", false},
+		{5, "set", "user/n", "3", false},
+		{6, "delete_range", "user/", "", false},
+	}
+	for i, w := range want {
+		c := changes[i]
+		if c.Seq != w.seq || c.Type != w.typ || c.Key != w.key || c.Value != w.value || (c.ExpiresAt != 0) != w.expiresAt || c.Time == 0 {
+			t.Errorf("Change %d: expected %+v, got %+v", i, w, c)
+		}
+	}
+	if changes[0].Version == 0 || changes[4].EndKey != "user0" {
+		t.Errorf("Expected a version and the prefix end, got %+v and %+v", changes[0], changes[4])
+	}
+
+	// Live changes arrive after the ones in the log, and numbering survives
+	// a restart
+	store.Close()
+	if store, err = kvstore.NewKVStore(dir); err != nil {
+		t.Fatalf("Failed to reopen KVStore: %v", err)
+	}
+	defer store.Close()
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		store.Set("user/3", "c")
+	}()
+	if changes := collectChanges(t, store, "user/", 5, 2); changes[1].Seq != 7 || changes[1].Key != "user/3" {
+		t.Errorf("Expected user/3 as change 7, got %+v", changes[1])
+	}
+
+	if n, err := store.TrimChanges(0); err != nil || n != 6 {
+		t.Fatalf("Expected 6 trimmed changes, got %d (%v)", n, err)
+	}
+	err = store.WatchChanges(context.Background(), "", 0, func(kvstore.Change) error { return nil })
+	if !errors.Is(err, kvstore.ErrChangesTrimmed) {
+		t.Errorf("Expected ErrChangesTrimmed, got %v", err)
+	}
+	if changes := collectChanges(t, store, "", 6, 1); changes[0].Seq != 7 {
+		t.Errorf("Expected the newest change to stay, got %+v", changes[0])
+	}
+}
+
+func TestWatchConcurrentWriters(t *testing.T) {
+	store, err := kvstore.NewKVStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to create KVStore: %v", err)
+	}
+	defer store.Close()
+
+	const writers, writes = 8, 50
+	var wg sync.WaitGroup
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < writes; i++ {
+				if err := store.Set("w"+strconv.Itoa(w)+"/"+strconv.Itoa(i), "v"); err != nil {
+					t.Errorf("Set failed: %v", err)
+				}
+			}
+		}(w)
+	}
+
+	// The watch runs alongside the writers and must see every change once,
+	// in sequence order
+	changes := collectChanges(t, store, "", 0, writers*writes)
+	wg.Wait()
+	seen := make(map[string]bool)
+	for i, c := range changes {
+		if c.Seq != uint64(i+1) {
+			t.Fatalf("Change %d has sequence number %d", i, c.Seq)
+		}
+		seen[c.Key] = true
+	}
+	if len(seen) != writers*writes {
+		t.Errorf("Expected %d distinct keys, got %d", writers*writes, len(seen))
+	}
+}
+
+func TestWatchSSE(t *testing.T) {
+	ts := newV1Server(t)
+	doRequest(t, http.MethodPut, ts.URL+"/v1/kv/app/old", `"o"`)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, ts.URL+"/v1/watch?prefix=app/", nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("Watch failed: %v %v", resp, err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("Expected an event stream, got %s", ct)
+	}
+
+	doRequest(t, http.MethodPut, ts.URL+"/v1/kv/skip", `1`)
+	doRequest(t, http.MethodPut, ts.URL+"/v1/kv/app/1", `{"n":1}`)
+	doRequest(t, http.MethodDelete, ts.URL+"/v1/kv/app/1", "")
+
+	reader := bufio.NewReader(resp.Body)
+	var events []rest.ChangeEvent
+	var ids []string
+	for len(events) < 2 {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatalf("Read failed: %v", err)
+		}
+		if id, ok := strings.CutPrefix(line, "id: "); ok {
+			ids = append(ids, strings.TrimSpace(id))
+		}
+		if data, ok := strings.CutPrefix(line, "data: "); ok {
+			var event rest.ChangeEvent
+			if err := json.Unmarshal([]byte(data), &event); err != nil {
+				t.Fatalf("Bad event %q: %v", data, err)
+			}
+			events = append(events, event)
+		}
+	}
+	if events[0].Type != "set" || events[0].Key != "app/1" || events[0].Value != `{"n":1}` || events[1].Type != "delete" {
+		t.Errorf("Unexpected events %+v", events)
+	}
+	if ids[0] != "3" || ids[1] != "4" {
+		t.Errorf("Expected ids 3 and 4, got %v", ids)
+	}
+
+	// An EventSource reconnects with Last-Event-ID
+	resumeCtx, stop := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer stop()
+	req, _ = http.NewRequestWithContext(resumeCtx, http.MethodGet, ts.URL+"/v1/watch?prefix=app/", nil)
+	req.Header.Set("Last-Event-ID", "0")
+	resumed, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Resume failed: %v", err)
+	}
+	line, _ := bufio.NewReader(resumed.Body).ReadString('\n')
+	resumed.Body.Close()
+	if line != "id: 1\n" {
+		t.Errorf("Expected the resumed stream to start at change 1, got %q", line)
+	}
+
+	resp2, body := doRequest(t, http.MethodGet, ts.URL+"/v1/watch?after=x", "")
+	expectError(t, resp2, body, http.StatusBadRequest, rest.CodeInvalidArgument)
+	resp2, body = doRequest(t, http.MethodGet, ts.URL+"/v1/watch?after=99", "")
+	expectError(t, resp2, body, http.StatusBadRequest, rest.CodeInvalidArgument)
+}
+
+func TestWatchWebSocket(t *testing.T) {
+	ts := newV1Server(t)
+
+	conn, err := websocket.Dial("ws"+strings.TrimPrefix(ts.URL, "http")+"/v1/watch/ws?prefix=YQ%3D%3D&encoding=base64", "", ts.URL)
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	defer conn.Close()
+
+	// The watch starts before Dial returns
+	doRequest(t, http.MethodPut, ts.URL+"/v1/kv/ab", `"v"`)
+	var event rest.ChangeEvent
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	if err := websocket.JSON.Receive(conn, &event); err != nil {
+		t.Fatalf("Receive failed: %v", err)
+	}
+	if event.Seq != 1 || event.Key != "YWI=" || event.Value != "InYi" {
+		t.Errorf("Unexpected event %+v", event)
+	}
+}
+
+func TestGRPCWatch(t *testing.T) {
+	client := pb.NewKVClient(newGRPCClient(t))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	client.Set(ctx, &pb.SetRequest{Key: []byte("k/1"), Value: []byte("1")})
+	after := uint64(0)
+	stream, err := client.Watch(ctx, &pb.WatchRequest{Prefix: []byte("k/"), After: &after})
+	if err != nil {
+		t.Fatalf("Watch failed: %v", err)
+	}
+	if _, err := stream.Header(); err != nil {
+		t.Fatalf("Header failed: %v", err)
+	}
+	client.DeletePrefix(ctx, &pb.DeletePrefixRequest{Prefix: []byte("k/")})
+
+	for _, want := range []string{"set", "delete_range"} {
+		event, err := stream.Recv()
+		if err != nil {
+			t.Fatalf("Recv failed: %v", err)
+		}
+		if event.Type != want {
+			t.Errorf("Expected %s, got %+v", want, event)
+		}
+	}
+
+	far := uint64(100)
+	stream, _ = client.Watch(ctx, &pb.WatchRequest{After: &far})
+	if _, err := stream.Recv(); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("Expected InvalidArgument resuming ahead of the log, got %v", err)
+	}
+}